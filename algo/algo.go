@@ -0,0 +1,108 @@
+package algo
+
+import (
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// Orders is the order service executors trade through. *api.Orders and the
+// paper trading engine satisfy it.
+type Orders interface {
+	PlaceOrder(params *models.OrderParams, order *models.Order) error
+	GetOrderStatus(orderID int64, order *models.Order) error
+	CancelOrder(orderID int64) (string, error)
+}
+
+// ModifyOrders is the order service of executors that reprice their
+// orders in place. *api.Orders and the paper trading engine satisfy it.
+type ModifyOrders interface {
+	Orders
+	ModifyOrder(orderID int64, params *models.ModifyOrderParams, order *models.Order) error
+	ModifyOrderByClientID(
+		clientID models.ClientOrderID, params *models.ModifyOrderParams, order *models.Order) error
+}
+
+// TopOfBook provides the best bid and ask of a market. *orderbook.Books
+// and the paper trading engine satisfy it.
+type TopOfBook interface {
+	Book(market string) (bid, ask decimal.Decimal, ok bool)
+}
+
+// PriceHistory provides the candles volume curves are built from.
+// *api.Markets satisfies it.
+type PriceHistory interface {
+	GetHistoricalPrices(
+		market string, params *models.GetHistoricalPricesParams) ([]*models.HistoricalPrice, error)
+}
+
+var (
+	ErrAlreadyStarted  = errors.New("executor already started")
+	ErrInvalidParent   = errors.New("invalid parent order")
+	ErrNoPriceHistory  = errors.New("price history required")
+	ErrNoVolume        = errors.New("no volume in the price history")
+	ErrFillTimeout     = errors.New("child order not closed before the fill timeout")
+	ErrExecutorStopped = errors.New("executor stopped")
+	ErrChildUnresolved = errors.New("child order could not be confirmed closed")
+)
+
+type State string
+
+const (
+	StatePending   = State("pending")
+	StateRunning   = State("running")
+	StatePaused    = State("paused")
+	StateCompleted = State("completed")
+	StateExpired   = State("expired")
+	StateCancelled = State("cancelled")
+	StateFailed    = State("failed")
+)
+
+func (s State) IsTerminal() bool {
+	return s == StateCompleted || s == StateExpired || s == StateCancelled || s == StateFailed
+}
+
+type EventType string
+
+const (
+	ChildPlaced   = EventType("child_placed")
+	ChildClosed   = EventType("child_closed")
+	ChildFailed   = EventType("child_failed")
+	ChildRepriced = EventType("child_repriced")
+	StateChanged  = EventType("state_changed")
+	LegPlaced     = EventType("leg_placed")
+	LegModified   = EventType("leg_modified")
+	LegCancelled  = EventType("leg_cancelled")
+	LegTriggered  = EventType("leg_triggered")
+)
+
+// Event reports executor progress. Child is set for child order events,
+// Leg for linked order legs and Err for failures.
+type Event struct {
+	Type       EventType
+	State      State
+	Child      *models.Order
+	Leg        *Leg
+	FilledSize decimal.Decimal
+	Remaining  decimal.Decimal
+	Err        error
+}
+
+// fills accumulates child executions into a size and average price.
+type fills struct {
+	size     decimal.Decimal
+	notional decimal.Decimal
+}
+
+func (f *fills) add(size, price decimal.Decimal) {
+	f.size = f.size.Add(size)
+	f.notional = f.notional.Add(size.Mul(price))
+}
+
+func (f *fills) avgPrice() decimal.Decimal {
+	if f.size.Sign() == 0 {
+		return decimal.Zero
+	}
+	return f.notional.Div(f.size)
+}
@@ -0,0 +1,522 @@
+package algo
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/normalize"
+)
+
+const (
+	defaultSlices       = 10
+	defaultLookbackDays = 5
+	defaultBufferSize   = 256
+	defaultPollInterval = 250 * time.Millisecond
+	defaultFillTimeout  = 10 * time.Second
+)
+
+type config struct {
+	normalizer   *normalize.Normalizer
+	clientIDs    models.ClientIDGenerator
+	history      PriceHistory
+	fills        <-chan *models.FillResponse
+	orderUpdates <-chan *models.OrdersResponse
+	rand         *rand.Rand
+	lookbackDays int
+	pollInterval time.Duration
+	fillTimeout  time.Duration
+	bufferSize   int
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		lookbackDays: defaultLookbackDays,
+		pollInterval: defaultPollInterval,
+		fillTimeout:  defaultFillTimeout,
+		bufferSize:   defaultBufferSize,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.rand == nil {
+		c.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return c
+}
+
+type Option func(c *config)
+
+// WithNormalizer rounds child orders onto the market grid. Children that
+// round below the minimum size are skipped and carried into later slices.
+func WithNormalizer(n *normalize.Normalizer) Option {
+	return func(c *config) {
+		c.normalizer = n
+	}
+}
+
+func WithClientIDs(gen models.ClientIDGenerator) Option {
+	return func(c *config) {
+		c.clientIDs = gen
+	}
+}
+
+// WithHistory sets the candle source, required by VWAP and by a
+// participation cap.
+func WithHistory(history PriceHistory) Option {
+	return func(c *config) {
+		c.history = history
+	}
+}
+
+// WithFills lets executors follow their children on the fills channel
+// instead of polling alone: a fill of a child refreshes it at once. The
+// channel should not be shared with other readers.
+func WithFills(fills <-chan *models.FillResponse) Option {
+	return func(c *config) {
+		c.fills = fills
+	}
+}
+
+// WithOrderUpdates lets executors follow their children on the orders
+// channel, a closed update ending the wait without a poll. Like the fills
+// channel it should not be shared.
+func WithOrderUpdates(updates <-chan *models.OrdersResponse) Option {
+	return func(c *config) {
+		c.orderUpdates = updates
+	}
+}
+
+// WithRand sets the source for clip randomization.
+func WithRand(r *rand.Rand) Option {
+	return func(c *config) {
+		c.rand = r
+	}
+}
+
+func WithLookbackDays(days int) Option {
+	return func(c *config) {
+		c.lookbackDays = days
+	}
+}
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.pollInterval = interval
+	}
+}
+
+// WithFillTimeout sets how long an IOC child may stay open before it is
+// cancelled.
+func WithFillTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.fillTimeout = timeout
+	}
+}
+
+func WithBufferSize(size int) Option {
+	return func(c *config) {
+		c.bufferSize = size
+	}
+}
+
+// Report is the execution summary of a parent order.
+type Report struct {
+	Market       string
+	Side         models.OrderSide
+	Size         decimal.Decimal
+	State        State
+	FilledSize   decimal.Decimal
+	AvgFillPrice decimal.Decimal
+	Children     []models.Order
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Err          error
+}
+
+// executor holds the lifecycle shared by every algorithm: state, pause,
+// cancel, progress events and the aggregate fill.
+type executor struct {
+	mu       *sync.Mutex
+	market   string
+	side     models.OrderSide
+	size     decimal.Decimal
+	state    State
+	resumeC  chan struct{}
+	cancelC  chan struct{}
+	cancel   *sync.Once
+	done     chan struct{}
+	events   chan Event
+	closed   bool
+	dropped  int
+	filled   fills
+	children []models.Order
+	started  time.Time
+	finished time.Time
+	err      error
+}
+
+func newExecutor(market string, side models.OrderSide, size decimal.Decimal, bufferSize int) *executor {
+	return &executor{
+		mu:      &sync.Mutex{},
+		market:  market,
+		side:    side,
+		size:    size,
+		state:   StatePending,
+		cancelC: make(chan struct{}),
+		cancel:  &sync.Once{},
+		done:    make(chan struct{}),
+		events:  make(chan Event, bufferSize),
+	}
+}
+
+func (e *executor) start() error {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state != StatePending {
+		return ErrAlreadyStarted
+	}
+	e.state = StateRunning
+	e.started = time.Now()
+
+	return nil
+}
+
+// emit sends an event carrying the aggregate fill.
+func (e *executor) emit(event Event) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	event.FilledSize = e.filled.size
+	event.Remaining = decimal.Max(e.size.Sub(e.filled.size), decimal.Zero)
+
+	e.send(event)
+}
+
+func (e *executor) send(event Event) {
+
+	if e.closed {
+		return
+	}
+
+	event.State = e.state
+
+	select {
+	case e.events <- event:
+	default:
+		e.dropped++
+	}
+}
+
+func (e *executor) setState(state State) bool {
+
+	e.mu.Lock()
+	if e.state.IsTerminal() || e.state == state {
+		e.mu.Unlock()
+		return false
+	}
+	e.state = state
+	e.mu.Unlock()
+
+	e.emit(Event{Type: StateChanged})
+
+	return true
+}
+
+func (e *executor) finish(state State, err error) {
+
+	if !e.setState(state) {
+		return
+	}
+
+	e.mu.Lock()
+	e.finished = time.Now()
+	if err != nil {
+		e.err = err
+	}
+	e.closed = true
+	close(e.events)
+	close(e.done)
+	e.mu.Unlock()
+}
+
+// stop finishes as cancelled, recording the context error if any.
+func (e *executor) stop(ctx context.Context) {
+	e.finish(StateCancelled, ctx.Err())
+}
+
+func (e *executor) fail(err error) {
+	e.emit(Event{Type: ChildFailed, Err: err})
+	e.mu.Lock()
+	e.err = err
+	e.mu.Unlock()
+}
+
+// record adds a closed child to the aggregate fill.
+func (e *executor) record(order *models.Order) {
+	e.mu.Lock()
+	e.filled.add(order.FilledSize, order.AvgFillPrice)
+	e.children = append(e.children, *order)
+	e.mu.Unlock()
+}
+
+func (e *executor) filledSize() decimal.Decimal {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.filled.size
+}
+
+func (e *executor) remaining() decimal.Decimal {
+	return decimal.Max(e.size.Sub(e.filledSize()), decimal.Zero)
+}
+
+// wait blocks until t while honouring pause, cancel and ctx.
+func (e *executor) wait(ctx context.Context, t time.Time) error {
+
+	for {
+
+		e.mu.Lock()
+		paused, resumeC := e.state == StatePaused, e.resumeC
+		e.mu.Unlock()
+
+		if paused {
+			select {
+			case <-resumeC:
+				continue
+			case <-e.cancelC:
+				return ErrExecutorStopped
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		d := time.Until(t)
+		if d <= 0 {
+			// Already due, but a cancel since the last wait still stops
+			select {
+			case <-e.cancelC:
+				return ErrExecutorStopped
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+				return nil
+			}
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-e.cancelC:
+			timer.Stop()
+			return ErrExecutorStopped
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Pause stops new children from being placed. A child in flight is left
+// to complete.
+func (e *executor) Pause() {
+
+	e.mu.Lock()
+	if e.state != StateRunning {
+		e.mu.Unlock()
+		return
+	}
+	e.resumeC = make(chan struct{})
+	e.mu.Unlock()
+
+	e.setState(StatePaused)
+}
+
+func (e *executor) Resume() {
+
+	e.mu.Lock()
+	if e.state != StatePaused {
+		e.mu.Unlock()
+		return
+	}
+	e.state = StateRunning
+	close(e.resumeC)
+	e.mu.Unlock()
+
+	e.emit(Event{Type: StateChanged})
+}
+
+// Cancel stops the executor and cancels a child in flight.
+func (e *executor) Cancel() {
+	e.cancel.Do(func() { close(e.cancelC) })
+}
+
+// Events returns the progress events. It is closed when the executor is
+// done; events are dropped, see Dropped, if it is not drained.
+func (e *executor) Events() <-chan Event {
+	return e.events
+}
+
+func (e *executor) Dropped() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+func (e *executor) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *executor) State() State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.state
+}
+
+// Report returns the execution summary so far; it is final once Done is
+// closed.
+func (e *executor) Report() Report {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return Report{
+		Market:       e.market,
+		Side:         e.side,
+		Size:         e.size,
+		State:        e.state,
+		FilledSize:   e.filled.size,
+		AvgFillPrice: e.filled.avgPrice(),
+		Children:     append([]models.Order(nil), e.children...),
+		StartedAt:    e.started,
+		FinishedAt:   e.finished,
+		Err:          e.err,
+	}
+}
+
+// place normalizes and places a child. It returns a nil order if the child
+// rounds below the minimum size.
+func place(cfg *config, orders Orders, b *models.OrderBuilder) (*models.Order, error) {
+
+	if cfg.clientIDs != nil {
+		b.ClientID(cfg.clientIDs.Next())
+	}
+
+	params, err := b.Order()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.normalizer != nil {
+		if err = cfg.normalizer.Order(params); err != nil {
+			if errors.Is(err, normalize.ErrBelowMinSize) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	order := &models.Order{}
+	if err = orders.PlaceOrder(params, order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// awaitClose follows order until it is closed: on the orders and fills
+// channels if set, and by polling. Orders still open after the timeout or a
+// stop, or whose status cannot be polled, are cancelled first so that no
+// child is left working.
+func awaitClose(
+	ctx context.Context, cfg *config, orders Orders, order *models.Order, stop <-chan struct{}) error {
+
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	deadline := time.NewTimer(cfg.fillTimeout)
+	defer deadline.Stop()
+
+	fillsC, updatesC := cfg.fills, cfg.orderUpdates
+
+	for order.Status != models.Closed {
+
+		var result error
+
+		select {
+		case u, ok := <-updatesC:
+			if !ok {
+				updatesC = nil
+			} else if u != nil && u.ID == order.ID {
+				*order = u.Order
+			}
+			continue
+		case f, ok := <-fillsC:
+			if !ok {
+				fillsC = nil
+				continue
+			}
+			if f == nil || f.OrderID != order.ID {
+				continue
+			}
+			if result = orders.GetOrderStatus(order.ID, order); result == nil {
+				continue
+			}
+		case <-ticker.C:
+			if result = orders.GetOrderStatus(order.ID, order); result == nil {
+				continue
+			}
+		case <-deadline.C:
+			result = ErrFillTimeout
+		case <-stop:
+			result = ErrExecutorStopped
+		case <-ctx.Done():
+			result = ErrExecutorStopped
+		}
+
+		if err := cancelAndRefresh(cfg, orders, order); err != nil {
+			return err
+		}
+
+		return result
+	}
+
+	return nil
+}
+
+// cancelAndRefresh cancels order and polls it until the venue reports it
+// closed, so that its final fill is known. It fails with
+// ErrChildUnresolved if that does not happen within the fill timeout.
+func cancelAndRefresh(cfg *config, orders Orders, order *models.Order) error {
+
+	if _, err := orders.CancelOrder(order.ID); err != nil {
+		// The cancel fails for a child that closed in the meantime
+		if orders.GetOrderStatus(order.ID, order) == nil && order.Status == models.Closed {
+			return nil
+		}
+		return errors.Wrapf(ErrChildUnresolved, "cancel order %d: %v", order.ID, err)
+	}
+
+	deadline := time.Now().Add(cfg.fillTimeout)
+
+	for {
+		err := orders.GetOrderStatus(order.ID, order)
+		if err == nil && order.Status == models.Closed {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			if err == nil {
+				err = errors.New("still open")
+			}
+			return errors.Wrapf(ErrChildUnresolved, "order %d: %v", order.ID, err)
+		}
+		time.Sleep(cfg.pollInterval)
+	}
+}
@@ -0,0 +1,236 @@
+package algo
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/normalize"
+)
+
+var ErrChildCancelled = errors.New("child order closed by the venue before it filled")
+
+// IcebergParams describes an iceberg of Size shown Clip at a time at
+// Price. ClipVariance randomizes each clip by up to that fraction, e.g. 0.2
+// for 20%, and PriceVariance moves each clip away from the market by up to
+// that amount. Randomized clips are rounded down to SizeIncrement if set;
+// use WithNormalizer to keep them on the full market grid.
+type IcebergParams struct {
+	Market        string
+	Side          models.OrderSide
+	Size          decimal.Decimal
+	Price         decimal.Decimal
+	Clip          decimal.Decimal
+	ClipVariance  decimal.Decimal
+	PriceVariance decimal.Decimal
+	SizeIncrement decimal.Decimal
+	PostOnly      bool
+	ReduceOnly    bool
+}
+
+func (p *IcebergParams) validate() error {
+	if p.Market == "" || (p.Side != models.Buy && p.Side != models.Sell) ||
+		p.Size.Sign() <= 0 || p.Price.Sign() <= 0 || p.Clip.Sign() <= 0 ||
+		p.ClipVariance.Sign() < 0 || p.ClipVariance.GreaterThanOrEqual(decimal.NewFromInt(1)) ||
+		p.PriceVariance.Sign() < 0 || p.SizeIncrement.Sign() < 0 {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+// IcebergExecutor rests one clip at a time and posts the next clip once
+// the current one has filled. A last clip below the size increment or the
+// minimum size is not placed: the iceberg completes and the Report shows
+// the residual as Size less FilledSize.
+type IcebergExecutor struct {
+	*executor
+	cfg    config
+	orders Orders
+	params IcebergParams
+}
+
+func NewIceberg(orders Orders, params IcebergParams, opts ...Option) *IcebergExecutor {
+	cfg := newConfig(opts)
+	return &IcebergExecutor{
+		executor: newExecutor(params.Market, params.Side, params.Size, cfg.bufferSize),
+		cfg:      cfg,
+		orders:   orders,
+		params:   params,
+	}
+}
+
+// Start works the iceberg in the background. Cancel or ctx ending cancels
+// the resting clip.
+func (e *IcebergExecutor) Start(ctx context.Context) error {
+
+	if err := e.params.validate(); err != nil {
+		return err
+	}
+
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	go e.run(ctx)
+
+	return nil
+}
+
+// uniform returns a random value in [-1, 1).
+func (e *IcebergExecutor) uniform() decimal.Decimal {
+	return decimal.NewFromFloat(2*e.cfg.rand.Float64() - 1)
+}
+
+func (e *IcebergExecutor) nextClip(remaining decimal.Decimal) (size, price decimal.Decimal) {
+
+	p := &e.params
+
+	size = p.Clip.Mul(decimal.NewFromInt(1).Add(e.uniform().Mul(p.ClipVariance)))
+	size = decimal.Min(size, remaining)
+
+	if p.SizeIncrement.Sign() > 0 {
+		if rounded := normalize.Round(size, p.SizeIncrement, normalize.RoundDown); rounded.Sign() > 0 {
+			size = rounded
+		} else {
+			size = normalize.Round(remaining, p.SizeIncrement, normalize.RoundDown)
+			size = decimal.Min(size, p.SizeIncrement)
+		}
+	}
+
+	offset := e.uniform().Abs().Mul(p.PriceVariance)
+	if p.Side == models.Buy {
+		return size, p.Price.Sub(offset)
+	}
+
+	return size, p.Price.Add(offset)
+}
+
+func (e *IcebergExecutor) run(ctx context.Context) {
+
+	p := &e.params
+
+	for {
+
+		remaining := e.remaining()
+		if remaining.Sign() <= 0 {
+			e.finish(StateCompleted, nil)
+			return
+		}
+
+		// Blocks only while paused
+		if err := e.wait(ctx, time.Time{}); err != nil {
+			e.stop(ctx)
+			return
+		}
+
+		size, price := e.nextClip(remaining)
+		if size.Sign() <= 0 {
+			// The residual is below the size increment
+			e.finish(StateCompleted, nil)
+			return
+		}
+
+		b := models.NewLimitOrder(p.Market, p.Side, price, size)
+		if p.PostOnly {
+			b.PostOnly()
+		}
+		if p.ReduceOnly {
+			b.ReduceOnly()
+		}
+
+		order, err := place(&e.cfg, e.orders, b)
+		if err == nil && order == nil {
+			if last := remaining.Sub(size); last.Sign() == 0 || last.LessThan(p.SizeIncrement) {
+				// The residual is below the minimum size
+				e.finish(StateCompleted, nil)
+				return
+			}
+			err = normalize.ErrBelowMinSize
+		}
+		if err != nil {
+			e.finish(StateFailed, err)
+			return
+		}
+		e.emit(Event{Type: ChildPlaced, Child: order})
+
+		err = e.follow(ctx, order)
+
+		// A clip whose final fill is unknown is not counted
+		if order.Status == models.Closed {
+			e.record(order)
+			e.emit(Event{Type: ChildClosed, Child: order})
+		}
+
+		switch {
+		case errors.Is(err, ErrExecutorStopped):
+			e.stop(ctx)
+			return
+		case err != nil:
+			e.finish(StateFailed, err)
+			return
+		case order.FilledSize.LessThan(order.Size):
+			e.finish(StateFailed, ErrChildCancelled)
+			return
+		}
+	}
+}
+
+// follow waits for a clip to fill, from the fills channel if set and by
+// polling. A stop or a failed poll cancels the clip.
+func (e *IcebergExecutor) follow(ctx context.Context, order *models.Order) error {
+
+	ticker := time.NewTicker(e.cfg.pollInterval)
+	defer ticker.Stop()
+
+	clip, seen := fills{}, make(map[int64]struct{})
+
+	for order.Status != models.Closed {
+
+		if clip.size.GreaterThanOrEqual(order.Size) {
+			order.Status = models.Closed
+			break
+		}
+
+		select {
+		case f, ok := <-e.cfg.fills:
+			if !ok {
+				e.cfg.fills = nil
+				continue
+			}
+			if f == nil || f.OrderID != order.ID {
+				continue
+			}
+			if _, dup := seen[f.ID]; !dup {
+				seen[f.ID] = struct{}{}
+				clip.add(f.Size, f.Price)
+			}
+		case <-ticker.C:
+			if err := e.orders.GetOrderStatus(order.ID, order); err != nil {
+				if err := cancelAndRefresh(&e.cfg, e.orders, order); err != nil {
+					return err
+				}
+				return err
+			}
+		case <-e.cancelC:
+			if err := cancelAndRefresh(&e.cfg, e.orders, order); err != nil {
+				return err
+			}
+			return ErrExecutorStopped
+		case <-ctx.Done():
+			if err := cancelAndRefresh(&e.cfg, e.orders, order); err != nil {
+				return err
+			}
+			return ErrExecutorStopped
+		}
+	}
+
+	if clip.size.GreaterThan(order.FilledSize) {
+		order.FilledSize, order.AvgFillPrice = clip.size, clip.avgPrice()
+		order.RemainingSize = decimal.Max(order.Size.Sub(clip.size), decimal.Zero)
+	}
+
+	return nil
+}
@@ -0,0 +1,683 @@
+package algo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// LinkedOrders is the order service OCO and bracket orders trade through.
+// *api.Orders satisfies it.
+type LinkedOrders interface {
+	Orders
+	PlaceOrderOnce(params *models.OrderParams, order *models.Order) (placed bool, err error)
+	GetOpenTriggerOrders(
+		market *string, triggerType *models.TriggerOrderType) ([]*models.TriggerOrder, error)
+	PlaceTriggerOrder(params *models.TriggerOrderParams, order *models.TriggerOrder) error
+	ModifyTriggerOrder(
+		orderID int64, params *models.ModifyTriggerOrderParams, order *models.TriggerOrder) error
+	CancelTriggerOrder(orderID int64) (string, error)
+	GetTriggerOrderTriggers(orderID int64) ([]*models.Trigger, error)
+}
+
+var (
+	ErrInvalidLegs = errors.New("linked orders need trigger legs on the market")
+	ErrFinished    = errors.New("linked order already finished")
+	ErrRejected    = errors.New("order rejected by the venue")
+)
+
+// Leg is one trigger order of a linked order. OrderID changes when the leg
+// is resized because the venue replaces modified trigger orders. Once the
+// leg has triggered, Exiting is the size its orders are still working.
+// Pending is saved before the leg is placed or resized so that a restart
+// looks for the order on the venue rather than sending it again.
+type Leg struct {
+	Params    models.TriggerOrderParams `json:"params"`
+	OrderID   int64                     `json:"orderId"`
+	Size      decimal.Decimal           `json:"size"`
+	Filled    decimal.Decimal           `json:"filled"`
+	Exiting   decimal.Decimal           `json:"exiting"`
+	Triggered bool                      `json:"triggered"`
+	Pending   bool                      `json:"pending,omitempty"`
+}
+
+func (l *Leg) active() bool {
+	return l.OrderID != 0 && !l.Triggered
+}
+
+// LinkedState is the persisted state of an OCO or bracket order. For a
+// bracket the protected size is the filled size of the entry, for an OCO
+// it is Size.
+type LinkedState struct {
+	ID           string              `json:"id"`
+	Market       string              `json:"market"`
+	Size         decimal.Decimal     `json:"size"`
+	Entry        *models.OrderParams `json:"entry,omitempty"`
+	EntryOrderID int64               `json:"entryOrderId,omitempty"`
+	EntryFilled  decimal.Decimal     `json:"entryFilled"`
+	EntryClosed  bool                `json:"entryClosed"`
+	Legs         []Leg               `json:"legs"`
+	State        State               `json:"state"`
+	UpdatedAt    time.Time           `json:"updatedAt"`
+}
+
+func (s *LinkedState) copy() LinkedState {
+	result := *s
+	result.Legs = append([]Leg(nil), s.Legs...)
+	return result
+}
+
+func (s *LinkedState) protected() decimal.Decimal {
+	if s.Entry != nil {
+		return s.EntryFilled
+	}
+	return s.Size
+}
+
+func (s *LinkedState) exited() decimal.Decimal {
+	result := decimal.Zero
+	for i := range s.Legs {
+		result = result.Add(s.Legs[i].Filled)
+	}
+	return result
+}
+
+// exiting is exited plus what triggered legs are still working.
+func (s *LinkedState) exiting() decimal.Decimal {
+	result := s.exited()
+	for i := range s.Legs {
+		result = result.Add(s.Legs[i].Exiting)
+	}
+	return result
+}
+
+func entryClientID(id string) models.ClientOrderID {
+	return models.ClientOrderID(id + ".entry")
+}
+
+// rejected reports whether the venue refused a request, as opposed to the
+// request failing on the way.
+func rejected(err error) bool {
+	var apiErr *api.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusBadRequest &&
+		apiErr.StatusCode < http.StatusInternalServerError &&
+		apiErr.StatusCode != http.StatusTooManyRequests
+}
+
+// Linked manages an OCO or bracket order on the client. Untriggered legs
+// are kept sized to the position left open: they are placed once the entry
+// fills, resized as the entry fills or another leg triggers and cancelled
+// once nothing is left open. Every change is saved to the store. A venue
+// rejection of the entry or of a leg placement fails the linked order.
+//
+// state is only touched by the run goroutine; readers get published, a
+// copy taken on every save.
+type Linked struct {
+	x         *executor
+	cfg       config
+	orders    LinkedOrders
+	store     Store
+	state     LinkedState
+	published LinkedState
+}
+
+func newLinked(orders LinkedOrders, store Store, state LinkedState, opts []Option) *Linked {
+	cfg := newConfig(opts)
+	return &Linked{
+		x:         newExecutor(state.Market, "", state.Size, cfg.bufferSize),
+		cfg:       cfg,
+		orders:    orders,
+		store:     store,
+		state:     state,
+		published: state.copy(),
+	}
+}
+
+func validateLegs(market string, legs []models.TriggerOrderParams) error {
+	if market == "" || len(legs) == 0 {
+		return ErrInvalidLegs
+	}
+	for i := range legs {
+		if legs[i].Type == nil || legs[i].Side == nil ||
+			(legs[i].Market != nil && *legs[i].Market != market) {
+			return ErrInvalidLegs
+		}
+	}
+	return nil
+}
+
+func newLegs(market string, legs []models.TriggerOrderParams) []Leg {
+	result := make([]Leg, len(legs))
+	for i := range legs {
+		result[i].Params = legs[i]
+		result[i].Params.Market = &market
+	}
+	return result
+}
+
+// NewOCO links trigger orders protecting size: when one fills the others
+// are resized to what is left and cancelled once nothing is.
+func NewOCO(
+	orders LinkedOrders, store Store, id, market string, size decimal.Decimal,
+	legs []models.TriggerOrderParams, opts ...Option) (*Linked, error) {
+
+	if err := validateLegs(market, legs); err != nil {
+		return nil, err
+	}
+	if id == "" || size.Sign() <= 0 {
+		return nil, ErrInvalidParent
+	}
+
+	state := LinkedState{
+		ID: id, Market: market, Size: size, Legs: newLegs(market, legs), State: StatePending,
+	}
+
+	return newLinked(orders, store, state, opts), nil
+}
+
+// NewBracket places entry and protects its fills with a reduce only stop
+// loss and take profit on the other side. An entry without a client ID is
+// given one derived from id, so that a restart cannot place it twice.
+func NewBracket(
+	orders LinkedOrders, store Store, id string, entry models.OrderParams,
+	stopLoss, takeProfit models.TriggerOrderParams, opts ...Option) (*Linked, error) {
+
+	if id == "" || entry.Size.Sign() <= 0 || (entry.Side != models.Buy && entry.Side != models.Sell) {
+		return nil, ErrInvalidParent
+	}
+
+	exit := models.Sell
+	if entry.Side == models.Sell {
+		exit = models.Buy
+	}
+
+	if entry.ClientID == "" {
+		entry.ClientID = entryClientID(id)
+	}
+
+	legs := []models.TriggerOrderParams{stopLoss, takeProfit}
+	for i := range legs {
+		legs[i].Side, legs[i].ReduceOnly = &exit, api.PtrBool(true)
+	}
+	if err := validateLegs(entry.Market, legs); err != nil {
+		return nil, err
+	}
+
+	state := LinkedState{
+		ID:     id,
+		Market: entry.Market,
+		Size:   entry.Size,
+		Entry:  &entry,
+		Legs:   newLegs(entry.Market, legs),
+		State:  StatePending,
+	}
+
+	return newLinked(orders, store, state, opts), nil
+}
+
+// ResumeLinked loads a linked order saved by an earlier process. Start it
+// to pick up where it left off.
+func ResumeLinked(orders LinkedOrders, store Store, id string, opts ...Option) (*Linked, error) {
+
+	state, err := store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if state.State.IsTerminal() {
+		return nil, ErrFinished
+	}
+	state.State = StatePending
+
+	return newLinked(orders, store, *state, opts), nil
+}
+
+// Start runs the linked order in the background. Cancel cancels the entry
+// and the untriggered legs; ctx ending only stops following them so the
+// saved state can be resumed.
+func (l *Linked) Start(ctx context.Context) error {
+
+	if err := l.x.start(); err != nil {
+		return err
+	}
+
+	l.state.State = StateRunning
+	if err := l.save(); err != nil {
+		l.x.finish(StateFailed, err)
+		return err
+	}
+
+	go l.run(ctx)
+
+	return nil
+}
+
+func (l *Linked) run(ctx context.Context) {
+
+	ticker := time.NewTicker(l.cfg.pollInterval)
+	defer ticker.Stop()
+
+	for {
+
+		done, err := l.sync()
+		if errors.Is(err, ErrRejected) {
+			l.reject(err)
+			return
+		}
+		if err != nil {
+			l.event(Event{Type: ChildFailed, Err: err})
+		}
+		if done {
+			l.x.finish(l.state.State, nil)
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case _, ok := <-l.cfg.fills:
+			if !ok {
+				l.cfg.fills = nil
+			}
+		case <-l.x.cancelC:
+			err = l.cancelAll()
+			l.state.State = StateCancelled
+			if serr := l.save(); err == nil {
+				err = serr
+			}
+			l.x.finish(StateCancelled, err)
+			return
+		case <-ctx.Done():
+			l.x.stop(ctx)
+			return
+		}
+	}
+}
+
+// sync refreshes the entry and legs from the venue and brings the legs in
+// line with the open position. It reports whether the order is done.
+func (l *Linked) sync() (done bool, err error) {
+
+	s := &l.state
+	before := l.fingerprint()
+
+	defer func() {
+		if l.fingerprint() != before {
+			s.UpdatedAt = time.Now()
+			if serr := l.save(); err == nil {
+				err = serr
+			}
+		}
+	}()
+
+	if err = l.syncEntry(); err != nil {
+		return false, err
+	}
+
+	for i := range s.Legs {
+		if err = l.syncLeg(&s.Legs[i]); err != nil {
+			return false, err
+		}
+	}
+
+	open := s.protected().Sub(s.exiting())
+	entryDone := s.Entry == nil || s.EntryClosed
+
+	for i := range s.Legs {
+
+		leg := &s.Legs[i]
+		if leg.Triggered {
+			continue
+		}
+
+		switch {
+		case leg.Pending:
+			err = l.recoverLeg(leg)
+		case open.Sign() <= 0:
+			if leg.active() {
+				err = l.cancelLeg(leg)
+			}
+		case leg.OrderID == 0:
+			err = l.placeLeg(leg, open)
+		case !leg.Size.Equal(open):
+			err = l.resizeLeg(leg, open)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if entryDone && open.Sign() <= 0 && s.protected().LessThanOrEqual(s.exited()) {
+		s.State = StateCompleted
+		if s.protected().Sign() == 0 {
+			s.State = StateCancelled
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (l *Linked) fingerprint() string {
+	state := l.state
+	state.UpdatedAt = time.Time{}
+	data, _ := json.Marshal(&state)
+	return string(data)
+}
+
+func (l *Linked) syncEntry() error {
+
+	s := &l.state
+	if s.Entry == nil || s.EntryClosed {
+		return nil
+	}
+
+	order := &models.Order{}
+
+	if s.EntryOrderID == 0 {
+		// The client ID was saved on Start, a retry finds the placed order
+		placed, err := l.orders.PlaceOrderOnce(s.Entry, order)
+		if err != nil {
+			if rejected(err) {
+				return errors.Wrap(ErrRejected, err.Error())
+			}
+			return err
+		}
+		s.EntryOrderID = order.ID
+		if placed {
+			l.event(Event{Type: ChildPlaced, Child: order})
+		}
+	} else if err := l.orders.GetOrderStatus(s.EntryOrderID, order); err != nil {
+		return err
+	}
+
+	s.EntryFilled = order.FilledSize
+	s.EntryClosed = order.Status == models.Closed
+	if s.EntryClosed {
+		l.event(Event{Type: ChildClosed, Child: order})
+	}
+
+	return nil
+}
+
+func (l *Linked) syncLeg(leg *Leg) error {
+
+	if leg.OrderID == 0 {
+		return nil
+	}
+
+	triggers, err := l.orders.GetTriggerOrderTriggers(leg.OrderID)
+	if err != nil {
+		return err
+	}
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	// The orders a trigger sent are working their full size until they
+	// close, so the other legs are shrunk as soon as the leg triggers
+	filled, exiting := decimal.Zero, decimal.Zero
+	for _, t := range triggers {
+		if t == nil {
+			continue
+		}
+		if t.OrderID == 0 {
+			filled = filled.Add(decimal.NewFromFloat(t.FilledSize))
+			continue
+		}
+		order := &models.Order{}
+		if err = l.orders.GetOrderStatus(t.OrderID, order); err != nil {
+			return err
+		}
+		filled = filled.Add(order.FilledSize)
+		if order.Status != models.Closed {
+			exiting = exiting.Add(decimal.Max(order.Size.Sub(order.FilledSize), decimal.Zero))
+		}
+	}
+	leg.Filled, leg.Exiting = filled, exiting
+
+	if !leg.Triggered {
+		leg.Triggered = true
+		l.event(Event{Type: LegTriggered, Leg: leg})
+	}
+
+	return nil
+}
+
+// intend saves that leg is about to be sent.
+func (l *Linked) intend(leg *Leg) error {
+	leg.Pending = true
+	l.state.UpdatedAt = time.Now()
+	if err := l.save(); err != nil {
+		leg.Pending = false
+		return err
+	}
+	return nil
+}
+
+func (l *Linked) placeLeg(leg *Leg, size decimal.Decimal) error {
+
+	if err := l.intend(leg); err != nil {
+		return err
+	}
+
+	params := leg.Params
+	params.Size = &size
+
+	order := &models.TriggerOrder{}
+	if err := l.orders.PlaceTriggerOrder(&params, order); err != nil {
+		if rejected(err) {
+			leg.Pending = false
+			return errors.Wrap(ErrRejected, err.Error())
+		}
+		// Left pending, the next sync looks for the order on the venue
+		return err
+	}
+
+	leg.OrderID, leg.Size, leg.Pending = order.ID, size, false
+	l.event(Event{Type: LegPlaced, Leg: leg})
+
+	return nil
+}
+
+// recoverLeg resolves a leg whose placement or resize may have reached the
+// venue without its response. An open trigger order matching the leg and
+// not held by another leg is adopted; otherwise the leg is placed again
+// unless its old order has triggered.
+func (l *Linked) recoverLeg(leg *Leg) error {
+
+	open, err := l.orders.GetOpenTriggerOrders(leg.Params.Market, leg.Params.Type)
+	if err != nil {
+		return err
+	}
+
+	held := make(map[int64]bool)
+	for i := range l.state.Legs {
+		if other := &l.state.Legs[i]; other != leg && other.OrderID != 0 {
+			held[other.OrderID] = true
+		}
+	}
+
+	for _, o := range open {
+		if o != nil && !held[o.ID] && l.matches(leg, o) {
+			leg.OrderID, leg.Size, leg.Pending = o.ID, o.Size, false
+			return nil
+		}
+	}
+
+	leg.Pending = false
+	if leg.OrderID == 0 {
+		return nil
+	}
+
+	triggers, err := l.orders.GetTriggerOrderTriggers(leg.OrderID)
+	if err != nil {
+		return err
+	}
+	if len(triggers) == 0 {
+		// Cancelled by the resize and not replaced
+		leg.OrderID, leg.Size = 0, decimal.Zero
+	}
+
+	return nil
+}
+
+func (l *Linked) matches(leg *Leg, o *models.TriggerOrder) bool {
+
+	p := &leg.Params
+
+	if p.Side != nil && o.Side != *p.Side {
+		return false
+	}
+	if p.TriggerPrice != nil && !o.TriggerPrice.Equal(*p.TriggerPrice) {
+		return false
+	}
+
+	return (p.ReduceOnly != nil && *p.ReduceOnly) == o.ReduceOnly
+}
+
+func (l *Linked) resizeLeg(leg *Leg, size decimal.Decimal) error {
+
+	// The venue replaces the order, the new ID must not be lost
+	if err := l.intend(leg); err != nil {
+		return err
+	}
+
+	params := &models.ModifyTriggerOrderParams{
+		Size:         &size,
+		TriggerPrice: leg.Params.TriggerPrice,
+		OrderPrice:   leg.Params.OrderPrice,
+		TrailValue:   leg.Params.TrailValue,
+	}
+
+	order := &models.TriggerOrder{}
+	if err := l.orders.ModifyTriggerOrder(leg.OrderID, params, order); err != nil {
+		if rejected(err) {
+			// The old order still rests, retrying would be rejected again
+			leg.Pending = false
+			return errors.Wrap(ErrRejected, err.Error())
+		}
+		return err
+	}
+
+	leg.OrderID, leg.Size, leg.Pending = order.ID, size, false
+	l.event(Event{Type: LegModified, Leg: leg})
+
+	return nil
+}
+
+func (l *Linked) cancelLeg(leg *Leg) error {
+
+	if _, err := l.orders.CancelTriggerOrder(leg.OrderID); err != nil {
+		return err
+	}
+
+	// A later entry fill places the leg again
+	leg.OrderID, leg.Size = 0, decimal.Zero
+	l.event(Event{Type: LegCancelled, Leg: leg})
+
+	return nil
+}
+
+func (l *Linked) cancelAll() error {
+
+	s := &l.state
+
+	if s.Entry != nil && !s.EntryClosed && s.EntryOrderID != 0 {
+		if _, err := l.orders.CancelOrder(s.EntryOrderID); err != nil {
+			return err
+		}
+		s.EntryClosed = true
+	}
+
+	for i := range s.Legs {
+		if s.Legs[i].active() {
+			if err := l.cancelLeg(&s.Legs[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reject fails the linked order after a rejected placement. An entry still
+// working is cancelled so that no more of it fills unprotected; placed legs
+// are left to protect what has.
+func (l *Linked) reject(err error) {
+
+	s := &l.state
+
+	if s.Entry != nil && !s.EntryClosed && s.EntryOrderID != 0 {
+		if _, cerr := l.orders.CancelOrder(s.EntryOrderID); cerr != nil {
+			l.event(Event{Type: ChildFailed, Err: cerr})
+		}
+	}
+
+	s.State, s.UpdatedAt = StateFailed, time.Now()
+	if serr := l.save(); serr != nil {
+		l.event(Event{Type: ChildFailed, Err: serr})
+	}
+
+	l.x.finish(StateFailed, err)
+}
+
+func (l *Linked) save() error {
+
+	state := l.state.copy()
+
+	l.x.mu.Lock()
+	l.published = state
+	l.x.mu.Unlock()
+
+	if l.store == nil {
+		return nil
+	}
+
+	return l.store.Save(&state)
+}
+
+func (l *Linked) event(event Event) {
+
+	l.x.mu.Lock()
+	defer l.x.mu.Unlock()
+
+	if event.Leg != nil {
+		leg := *event.Leg
+		event.Leg = &leg
+	}
+	event.FilledSize = l.state.EntryFilled
+	event.Remaining = decimal.Max(l.state.protected().Sub(l.state.exited()), decimal.Zero)
+
+	l.x.send(event)
+}
+
+func (l *Linked) Cancel() {
+	l.x.Cancel()
+}
+
+func (l *Linked) Events() <-chan Event {
+	return l.x.Events()
+}
+
+func (l *Linked) Done() <-chan struct{} {
+	return l.x.Done()
+}
+
+func (l *Linked) State() State {
+	return l.x.State()
+}
+
+// Snapshot returns a copy of the linked order state.
+func (l *Linked) Snapshot() LinkedState {
+
+	l.x.mu.Lock()
+	defer l.x.mu.Unlock()
+
+	return l.published.copy()
+}
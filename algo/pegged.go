@@ -0,0 +1,344 @@
+package algo
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/normalize"
+)
+
+type Peg string
+
+const (
+	// PegBest follows the best price of the order's own side: the bid for
+	// buys and the ask for sells.
+	PegBest = Peg("best")
+	PegMid  = Peg("mid")
+)
+
+// PegParams describes a limit order of Size kept at the Peg reference
+// price, Offset away from it on the passive side: below the reference for
+// buys and above it for sells. A negative offset is more aggressive.
+// The order is repriced once the target has moved Threshold or more and
+// MinInterval has passed since the last reprice. MaxChase caps how far the
+// price may move against the order from where it was first placed, i.e.
+// up for buys and down for sells. Zero values disable each limit.
+type PegParams struct {
+	Market      string
+	Side        models.OrderSide
+	Size        decimal.Decimal
+	Peg         Peg
+	Offset      decimal.Decimal
+	Threshold   decimal.Decimal
+	MinInterval time.Duration
+	MaxChase    decimal.Decimal
+	PostOnly    bool
+	ReduceOnly  bool
+}
+
+func (p *PegParams) validate() error {
+	if p.Market == "" || (p.Side != models.Buy && p.Side != models.Sell) ||
+		p.Size.Sign() <= 0 || (p.Peg != PegBest && p.Peg != PegMid) ||
+		p.Threshold.Sign() < 0 || p.MinInterval < 0 || p.MaxChase.Sign() < 0 {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+// PeggedExecutor keeps one limit order at the peg, repricing it with
+// ModifyOrder, or ModifyOrderByClientID when it has a client ID, as the
+// book moves. The venue gives a modified order a new ID; OrderIDs keeps
+// every ID the order has had.
+type PeggedExecutor struct {
+	*executor
+	cfg      config
+	orders   ModifyOrders
+	book     TopOfBook
+	params   PegParams
+	ids      []int64
+	anchor   decimal.Decimal
+	repriced time.Time
+}
+
+func NewPegged(
+	orders ModifyOrders, book TopOfBook, params PegParams, opts ...Option) *PeggedExecutor {
+
+	cfg := newConfig(opts)
+	return &PeggedExecutor{
+		executor: newExecutor(params.Market, params.Side, params.Size, cfg.bufferSize),
+		cfg:      cfg,
+		orders:   orders,
+		book:     book,
+		params:   params,
+	}
+}
+
+// Start works the order in the background, waiting for the book if it is
+// not yet there. Cancel or ctx ending cancels the order.
+func (e *PeggedExecutor) Start(ctx context.Context) error {
+
+	if err := e.params.validate(); err != nil {
+		return err
+	}
+
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	go e.run(ctx)
+
+	return nil
+}
+
+// OrderIDs returns the IDs the order has had, the working one last.
+func (e *PeggedExecutor) OrderIDs() []int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]int64(nil), e.ids...)
+}
+
+func (e *PeggedExecutor) track(order *models.Order) {
+	e.mu.Lock()
+	e.ids = append(e.ids, order.ID)
+	e.mu.Unlock()
+}
+
+// target returns the price the order should be at, or false without a
+// book.
+func (e *PeggedExecutor) target() (decimal.Decimal, bool) {
+
+	p := &e.params
+
+	bid, ask, ok := e.book.Book(p.Market)
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	ref := bid
+	switch {
+	case p.Peg == PegMid:
+		ref = bid.Add(ask).Div(decimal.NewFromInt(2))
+	case p.Side == models.Sell:
+		ref = ask
+	}
+
+	if p.Side == models.Buy {
+		price := ref.Sub(p.Offset)
+		if p.MaxChase.Sign() > 0 && !e.anchor.IsZero() {
+			price = decimal.Min(price, e.anchor.Add(p.MaxChase))
+		}
+		return price, price.Sign() > 0
+	}
+
+	price := ref.Add(p.Offset)
+	if p.MaxChase.Sign() > 0 && !e.anchor.IsZero() {
+		price = decimal.Max(price, e.anchor.Sub(p.MaxChase))
+	}
+
+	return price, price.Sign() > 0
+}
+
+// place places the remaining size at the target. It returns a nil order
+// without a book.
+func (e *PeggedExecutor) place() (*models.Order, error) {
+
+	p := &e.params
+
+	price, ok := e.target()
+	if !ok {
+		return nil, nil
+	}
+
+	b := models.NewLimitOrder(p.Market, p.Side, price, e.remaining())
+	if p.PostOnly {
+		b.PostOnly()
+	}
+	if p.ReduceOnly {
+		b.ReduceOnly()
+	}
+
+	order, err := place(&e.cfg, e.orders, b)
+	if err == nil && order == nil {
+		err = normalize.ErrBelowMinSize
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if e.anchor.IsZero() {
+		e.anchor = order.Price
+	}
+	e.track(order)
+
+	return order, nil
+}
+
+// reprice moves order to the target if it is due. It returns the working
+// order, which is nil if the order was lost in a failed modify.
+func (e *PeggedExecutor) reprice(order *models.Order) (*models.Order, error) {
+
+	p := &e.params
+
+	if e.State() != StateRunning || time.Since(e.repriced) < p.MinInterval {
+		return order, nil
+	}
+
+	price, ok := e.target()
+	if !ok {
+		return order, nil
+	}
+
+	params := &models.ModifyOrderParams{Price: &price}
+	if e.cfg.normalizer != nil {
+		if err := e.cfg.normalizer.Modify(p.Market, p.Side, params); err != nil {
+			return order, err
+		}
+	}
+
+	diff := params.Price.Sub(order.Price).Abs()
+	if diff.Sign() == 0 || diff.LessThan(p.Threshold) {
+		return order, nil
+	}
+
+	e.repriced = time.Now()
+
+	replacement := &models.Order{}
+
+	var err error
+	if order.ClientID != "" {
+		err = e.orders.ModifyOrderByClientID(order.ClientID, params, replacement)
+	} else {
+		err = e.orders.ModifyOrder(order.ID, params, replacement)
+	}
+
+	if err != nil {
+		// The venue cancels before it replaces, so the order may be gone
+		if err := e.orders.GetOrderStatus(order.ID, order); err != nil {
+			return order, err
+		}
+		if order.Status != models.Closed {
+			e.fail(err)
+			return order, nil
+		}
+		e.record(order)
+		e.emit(Event{Type: ChildClosed, Child: order, Err: err})
+		return nil, nil
+	}
+
+	if err = e.orders.GetOrderStatus(order.ID, order); err != nil {
+		return replacement, err
+	}
+	e.record(order)
+	e.track(replacement)
+	e.emit(Event{Type: ChildRepriced, Child: replacement})
+
+	return replacement, nil
+}
+
+func (e *PeggedExecutor) run(ctx context.Context) {
+
+	ticker := time.NewTicker(e.cfg.pollInterval)
+	defer ticker.Stop()
+
+	var order *models.Order
+
+	for {
+
+		if order == nil {
+
+			if e.remaining().Sign() <= 0 {
+				e.finish(StateCompleted, nil)
+				return
+			}
+
+			// Blocks only while paused
+			if err := e.wait(ctx, time.Time{}); err != nil {
+				e.stop(ctx)
+				return
+			}
+
+			placed, err := e.place()
+			if err != nil {
+				e.finish(StateFailed, err)
+				return
+			}
+			if placed != nil {
+				order = placed
+				e.repriced = time.Now()
+				e.emit(Event{Type: ChildPlaced, Child: order})
+			}
+		}
+
+		if order != nil && order.Status == models.Closed {
+
+			e.record(order)
+			e.emit(Event{Type: ChildClosed, Child: order})
+
+			if e.remaining().Sign() > 0 && !e.params.PostOnly {
+				e.finish(StateFailed, ErrChildCancelled)
+				return
+			}
+
+			// Post only orders the venue closed are placed again
+			order = nil
+			continue
+		}
+
+		var err error
+
+		select {
+		case f, ok := <-e.cfg.fills:
+			if !ok {
+				e.cfg.fills = nil
+				continue
+			}
+			if order != nil && f != nil && f.OrderID == order.ID {
+				err = e.orders.GetOrderStatus(order.ID, order)
+			}
+		case u, ok := <-e.cfg.orderUpdates:
+			if !ok {
+				e.cfg.orderUpdates = nil
+				continue
+			}
+			if order != nil && u != nil && u.ID == order.ID {
+				*order = u.Order
+			}
+		case <-ticker.C:
+			if order == nil {
+				continue
+			}
+			if err = e.orders.GetOrderStatus(order.ID, order); err == nil && order.Status != models.Closed {
+				order, err = e.reprice(order)
+			}
+		case <-e.cancelC:
+			e.abandon(ctx, order)
+			return
+		case <-ctx.Done():
+			e.abandon(ctx, order)
+			return
+		}
+
+		if err != nil {
+			e.finish(StateFailed, err)
+			return
+		}
+	}
+}
+
+// abandon cancels the working order and stops.
+func (e *PeggedExecutor) abandon(ctx context.Context, order *models.Order) {
+
+	if order != nil {
+		if err := cancelAndRefresh(&e.cfg, e.orders, order); err != nil {
+			e.finish(StateFailed, err)
+			return
+		}
+		e.record(order)
+		e.emit(Event{Type: ChildClosed, Child: order})
+	}
+
+	e.stop(ctx)
+}
@@ -0,0 +1,104 @@
+package algo
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const day = 24 * time.Hour
+
+var resolutions = []models.Resolution{
+	models.Day, models.Hour4, models.Hour, models.Minute15, models.Minute5, models.Minute, models.Sec15,
+}
+
+// resolutionFor returns the largest candle resolution that fits in a slice.
+func resolutionFor(slice time.Duration) models.Resolution {
+	for _, r := range resolutions {
+		if time.Duration(r)*time.Second <= slice {
+			return r
+		}
+	}
+	return models.Sec15
+}
+
+// sliceTimes splits [start, end) into n equal slices and returns their
+// start times.
+func sliceTimes(start, end time.Time, n int) []time.Time {
+	result, step := make([]time.Time, n), end.Sub(start)/time.Duration(n)
+	for i := range result {
+		result[i] = start.Add(time.Duration(i) * step)
+	}
+	return result
+}
+
+// VolumeProfile returns the average base volume traded per day in each of
+// the n slices of [start, end), matched by time of day over the candles in
+// prices. Candle volume is quote volume and is converted with the close.
+// Windows longer than a day and slices without candles get zero volume.
+func VolumeProfile(
+	prices []*models.HistoricalPrice, start, end time.Time, n int) []decimal.Decimal {
+
+	result := make([]decimal.Decimal, n)
+	for i := range result {
+		result[i] = decimal.Zero
+	}
+
+	length := end.Sub(start)
+	if n <= 0 || length <= 0 || length > day {
+		return result
+	}
+
+	step, days := length/time.Duration(n), make(map[int64]struct{})
+
+	for _, p := range prices {
+		if p == nil || p.Close.Sign() <= 0 {
+			continue
+		}
+		offset := p.StartTime.Sub(start) % day
+		if offset < 0 {
+			offset += day
+		}
+		if offset >= length {
+			continue
+		}
+		i := int(offset / step)
+		if i >= n {
+			i = n - 1
+		}
+		result[i] = result[i].Add(p.Volume.Div(p.Close))
+		days[int64(p.StartTime.Sub(start.Add(offset))/day)] = struct{}{}
+	}
+
+	if len(days) > 1 {
+		count := decimal.NewFromInt(int64(len(days)))
+		for i := range result {
+			result[i] = result[i].Div(count)
+		}
+	}
+
+	return result
+}
+
+// Weights normalizes a volume profile so that it sums to one. A profile
+// without volume gives equal weights.
+func Weights(profile []decimal.Decimal) []decimal.Decimal {
+
+	total := decimal.Zero
+	for _, v := range profile {
+		total = total.Add(v)
+	}
+
+	result := make([]decimal.Decimal, len(profile))
+	for i, v := range profile {
+		if total.Sign() == 0 {
+			result[i] = decimal.NewFromInt(1).Div(decimal.NewFromInt(int64(len(profile))))
+		} else {
+			result[i] = v.Div(total)
+		}
+	}
+
+	return result
+}
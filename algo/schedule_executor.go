@@ -0,0 +1,223 @@
+package algo
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// Parent is an order to be worked over [Start, End). Children are IOC
+// limit orders at LimitPrice, or market orders if it is nil.
+// ParticipationCap limits each child to that fraction of the expected
+// slice volume; zero means no cap. A capped parent needs volume in the
+// price history to start.
+type Parent struct {
+	Market           string
+	Side             models.OrderSide
+	Size             decimal.Decimal
+	Start            time.Time
+	End              time.Time
+	LimitPrice       *decimal.Decimal
+	ParticipationCap decimal.Decimal
+	Slices           int
+}
+
+func (p *Parent) validate() error {
+	if p.Market == "" || (p.Side != models.Buy && p.Side != models.Sell) ||
+		p.Size.Sign() <= 0 || !p.End.After(p.Start) || p.Slices < 0 ||
+		p.ParticipationCap.Sign() < 0 || (p.LimitPrice != nil && p.LimitPrice.Sign() <= 0) {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+// ScheduleExecutor works a parent order along a schedule of target
+// weights, one child per slice. Shortfalls from pauses, rounding or partial
+// fills roll into the next slice.
+type ScheduleExecutor struct {
+	*executor
+	cfg    config
+	orders Orders
+	parent Parent
+	vwap   bool
+}
+
+func newScheduleExecutor(orders Orders, parent Parent, opts []Option) *ScheduleExecutor {
+
+	cfg := newConfig(opts)
+	if parent.Slices == 0 {
+		parent.Slices = defaultSlices
+	}
+
+	return &ScheduleExecutor{
+		executor: newExecutor(parent.Market, parent.Side, parent.Size, cfg.bufferSize),
+		cfg:      cfg,
+		orders:   orders,
+		parent:   parent,
+	}
+}
+
+// NewTWAP works the parent in equal slices between Start and End.
+func NewTWAP(orders Orders, parent Parent, opts ...Option) *ScheduleExecutor {
+	return newScheduleExecutor(orders, parent, opts)
+}
+
+// NewVWAP weights the slices by the volume traded at the same time of day
+// over the lookback days.
+func NewVWAP(orders Orders, history PriceHistory, parent Parent, opts ...Option) *ScheduleExecutor {
+	e := newScheduleExecutor(orders, parent, append([]Option{WithHistory(history)}, opts...))
+	e.vwap = true
+	return e
+}
+
+// profile loads the expected volume per slice, or nil if not needed.
+func (e *ScheduleExecutor) profile() ([]decimal.Decimal, error) {
+
+	p := &e.parent
+	if !e.vwap && p.ParticipationCap.Sign() == 0 {
+		return nil, nil
+	}
+	if e.cfg.history == nil {
+		return nil, ErrNoPriceHistory
+	}
+
+	step := p.End.Sub(p.Start) / time.Duration(p.Slices)
+	start := p.Start.Add(-time.Duration(e.cfg.lookbackDays) * day).Unix()
+	end := p.Start.Unix()
+
+	prices, err := e.cfg.history.GetHistoricalPrices(p.Market, &models.GetHistoricalPricesParams{
+		Resolution: resolutionFor(step),
+		StartTime:  &start,
+		EndTime:    &end,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	profile := VolumeProfile(prices, p.Start, p.End, p.Slices)
+	if p.ParticipationCap.Sign() == 0 {
+		return profile, nil
+	}
+
+	// A cap on no volume would place nothing and expire the parent
+	for _, v := range profile {
+		if v.Sign() > 0 {
+			return profile, nil
+		}
+	}
+	return nil, ErrNoVolume
+}
+
+// Start validates the parent, loads the volume profile if needed and works
+// the order in the background until it is done, cancelled or ctx is done.
+func (e *ScheduleExecutor) Start(ctx context.Context) error {
+
+	if err := e.parent.validate(); err != nil {
+		return err
+	}
+
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	profile, err := e.profile()
+	if err != nil {
+		e.finish(StateFailed, err)
+		return err
+	}
+
+	weights := Weights(make([]decimal.Decimal, e.parent.Slices))
+	if e.vwap {
+		weights = Weights(profile)
+	}
+
+	go e.run(ctx, weights, profile)
+
+	return nil
+}
+
+func (e *ScheduleExecutor) run(ctx context.Context, weights, profile []decimal.Decimal) {
+
+	p := &e.parent
+	times := sliceTimes(p.Start, p.End, p.Slices)
+	target := decimal.Zero
+
+	for i := range times {
+
+		if err := e.wait(ctx, times[i]); err != nil {
+			e.stop(ctx)
+			return
+		}
+
+		target = target.Add(p.Size.Mul(weights[i]))
+		if i == len(times)-1 {
+			target = p.Size
+		} else if !time.Now().Before(times[i+1]) {
+			// Slices missed while paused are caught up in one child
+			continue
+		}
+
+		size := target.Sub(e.filledSize())
+		if profile != nil && p.ParticipationCap.Sign() > 0 {
+			size = decimal.Min(size, profile[i].Mul(p.ParticipationCap))
+		}
+		if size.Sign() <= 0 {
+			continue
+		}
+
+		if err := e.child(ctx, size); err != nil {
+			switch {
+			case errors.Is(err, ErrChildUnresolved):
+				// The child may still be working, another could overfill
+				e.finish(StateFailed, err)
+				return
+			case errors.Is(err, ErrExecutorStopped):
+				e.stop(ctx)
+				return
+			}
+			e.fail(err)
+		}
+
+		if e.filledSize().GreaterThanOrEqual(p.Size) {
+			e.finish(StateCompleted, nil)
+			return
+		}
+	}
+
+	if err := e.wait(ctx, p.End); err != nil {
+		e.stop(ctx)
+		return
+	}
+
+	e.finish(StateExpired, nil)
+}
+
+func (e *ScheduleExecutor) child(ctx context.Context, size decimal.Decimal) error {
+
+	p := &e.parent
+
+	b := models.NewMarketOrder(p.Market, p.Side, size)
+	if p.LimitPrice != nil {
+		b = models.NewLimitOrder(p.Market, p.Side, *p.LimitPrice, size).IOC()
+	}
+
+	order, err := place(&e.cfg, e.orders, b)
+	if err != nil || order == nil {
+		return err
+	}
+	e.emit(Event{Type: ChildPlaced, Child: order})
+
+	err = awaitClose(ctx, &e.cfg, e.orders, order, e.cancelC)
+
+	// A child whose final fill is unknown is not counted
+	if order.Status == models.Closed {
+		e.record(order)
+		e.emit(Event{Type: ChildClosed, Child: order})
+	}
+
+	return err
+}
@@ -0,0 +1,223 @@
+package algo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNotFound = errors.New("linked order not found")
+
+// Store persists linked order state so it can be resumed after a restart.
+type Store interface {
+	Save(state *LinkedState) error
+	Load(id string) (*LinkedState, error)
+	Delete(id string) error
+	List() ([]*LinkedState, error)
+}
+
+// FileStore keeps one JSON file per linked order in a directory. Writes
+// go to a synced temporary file that is renamed over the state, and the
+// directory is synced after, so a crash never leaves a partial state
+// behind.
+type FileStore struct {
+	dir string
+	mu  *sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &FileStore{dir: dir, mu: &sync.Mutex{}}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) Save(state *LinkedState) error {
+
+	if state == nil || state.ID == "" || strings.ContainsAny(state.ID, `/\`) {
+		return errors.New("invalid linked order id")
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path(state.ID) + ".tmp"
+	if err = writeSynced(tmp, data); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, s.path(state.ID)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The rename itself is only durable once the directory is synced
+	return syncDir(s.dir)
+}
+
+func writeSynced(path string, data []byte) error {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return errors.WithStack(err)
+}
+
+func syncDir(dir string) error {
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	return errors.WithStack(f.Sync())
+}
+
+func (s *FileStore) Load(id string) (*LinkedState, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	state := &LinkedState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return state, nil
+}
+
+func (s *FileStore) Delete(id string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) List() ([]*LinkedState, error) {
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Strings(matches)
+
+	result := make([]*LinkedState, 0, len(matches))
+	for _, m := range matches {
+		state, err := s.Load(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, state)
+	}
+
+	return result, nil
+}
+
+// MemoryStore is a Store for tests and for callers that do not need to
+// survive a restart.
+type MemoryStore struct {
+	mu     *sync.Mutex
+	states map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{mu: &sync.Mutex{}, states: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Save(state *LinkedState) error {
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	s.states[state.ID] = data
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) Load(id string) (*LinkedState, error) {
+
+	s.mu.Lock()
+	data, ok := s.states[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	state := &LinkedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return state, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.states, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) List() ([]*LinkedState, error) {
+
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.states))
+	for id := range s.states {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+
+	result := make([]*LinkedState, 0, len(ids))
+	for _, id := range ids {
+		state, err := s.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, state)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const defaultBatchConcurrency = 8
+
+var (
+	ErrNotAttempted = errors.New("not attempted after an earlier failure")
+	ErrRolledBack   = errors.New("cancelled after another order in the batch failed")
+)
+
+// RollbackError is set on a placed order whose rollback cancel failed,
+// leaving the order live.
+type RollbackError struct {
+	OrderID int64
+	Err     error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("rollback cancel of order %d failed: %v", e.OrderID, e.Err)
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned when at least one item of a batch failed.
+// The per item errors are in the results.
+type BatchError struct {
+	Failed int
+	Total  int
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d batch items failed", e.Failed, e.Total)
+}
+
+type batchConfig struct {
+	concurrency  int
+	allOrNothing bool
+}
+
+type BatchOption func(c *batchConfig)
+
+func WithConcurrency(n int) BatchOption {
+	return func(c *batchConfig) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// AllOrNothing stops starting new items after the first failure. For
+// PlaceOrders the orders already placed are cancelled as well.
+func AllOrNothing() BatchOption {
+	return func(c *batchConfig) {
+		c.allOrNothing = true
+	}
+}
+
+// IsAllOrNothing reports whether opts include AllOrNothing, for wrappers
+// that filter a batch before sending it.
+func IsAllOrNothing(opts ...BatchOption) bool {
+	return newBatchConfig(opts).allOrNothing
+}
+
+func newBatchConfig(opts []BatchOption) *batchConfig {
+	c := &batchConfig{concurrency: defaultBatchConcurrency}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type PlaceResult struct {
+	Params *models.OrderParams
+	Order  *models.Order
+	Err    error
+}
+
+type CancelResult struct {
+	OrderID int64
+	Result  string
+	Err     error
+}
+
+type ModifyRequest struct {
+	OrderID int64
+	Params  *models.ModifyOrderParams
+}
+
+type ModifyResult struct {
+	OrderID int64
+	Order   *models.Order
+	Err     error
+}
+
+// fanOut runs f for every index with at most concurrency calls in flight.
+// f returns false on failure. In all or nothing mode no new calls are started
+// after a failure and skip is called for the remaining indices instead.
+func fanOut(n int, cfg *batchConfig, f func(i int) bool, skip func(i int)) int {
+
+	var (
+		mu     sync.Mutex
+		failed int
+		wg     sync.WaitGroup
+	)
+
+	sem := make(chan struct{}, cfg.concurrency)
+
+	for i := 0; i < n; i++ {
+
+		sem <- struct{}{}
+
+		mu.Lock()
+		abort := cfg.allOrNothing && failed > 0
+		mu.Unlock()
+
+		if abort {
+			<-sem
+			skip(i)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if !f(i) {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return failed
+}
+
+// NewBatchError counts the items of a batch of total whose errs is set. It
+// returns nil if none is, so wrappers can return it like the batch calls.
+func NewBatchError(total int, errs func(i int) error) error {
+	failed := 0
+	for i := 0; i < total; i++ {
+		if errs(i) != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return &BatchError{Failed: failed, Total: total}
+}
+
+// PlaceOrders places the orders concurrently under the client rate limiter
+// and returns one result per order, in input order.
+func (o *Orders) PlaceOrders(
+	params []*models.OrderParams, opts ...BatchOption) ([]PlaceResult, error) {
+
+	cfg, results := newBatchConfig(opts), make([]PlaceResult, len(params))
+
+	failed := fanOut(len(params), cfg,
+		func(i int) bool {
+			results[i].Params = params[i]
+			order := &models.Order{}
+			if err := o.PlaceOrder(params[i], order); err != nil {
+				results[i].Err = err
+				return false
+			}
+			results[i].Order = order
+			return true
+		},
+		func(i int) {
+			results[i].Params, results[i].Err = params[i], ErrNotAttempted
+		})
+
+	if cfg.allOrNothing && failed > 0 {
+		o.rollback(results, cfg)
+	}
+
+	return results, NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
+
+func (o *Orders) rollback(results []PlaceResult, cfg *batchConfig) {
+
+	placed := make([]int, 0, len(results))
+	for i := range results {
+		if results[i].Err == nil && results[i].Order != nil {
+			placed = append(placed, i)
+		}
+	}
+
+	fanOut(len(placed), &batchConfig{concurrency: cfg.concurrency},
+		func(j int) bool {
+			i := placed[j]
+			id := results[i].Order.ID
+			if _, err := o.CancelOrder(id); err != nil {
+				results[i].Err = &RollbackError{OrderID: id, Err: err}
+				return false
+			}
+			results[i].Err = ErrRolledBack
+			return true
+		},
+		func(int) {})
+}
+
+func (o *Orders) CancelOrders(ids []int64, opts ...BatchOption) ([]CancelResult, error) {
+
+	cfg, results := newBatchConfig(opts), make([]CancelResult, len(ids))
+
+	fanOut(len(ids), cfg,
+		func(i int) bool {
+			results[i].OrderID = ids[i]
+			results[i].Result, results[i].Err = o.CancelOrder(ids[i])
+			return results[i].Err == nil
+		},
+		func(i int) {
+			results[i].OrderID, results[i].Err = ids[i], ErrNotAttempted
+		})
+
+	return results, NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
+
+// ModifyOrders modifies the orders concurrently. Modified orders get new
+// IDs, see ModifyResult.Order. AllOrNothing only stops further modifies.
+func (o *Orders) ModifyOrders(
+	requests []ModifyRequest, opts ...BatchOption) ([]ModifyResult, error) {
+
+	cfg, results := newBatchConfig(opts), make([]ModifyResult, len(requests))
+
+	fanOut(len(requests), cfg,
+		func(i int) bool {
+			results[i].OrderID = requests[i].OrderID
+			if requests[i].Params == nil {
+				results[i].Err = models.ErrNilPtr
+				return false
+			}
+			order := &models.Order{}
+			if err := o.ModifyOrder(requests[i].OrderID, requests[i].Params, order); err != nil {
+				results[i].Err = err
+				return false
+			}
+			results[i].Order = order
+			return true
+		},
+		func(i int) {
+			results[i].OrderID, results[i].Err = requests[i].OrderID, ErrNotAttempted
+		})
+
+	return results, NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
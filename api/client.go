@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -56,6 +57,7 @@ type Client struct {
 	apiKey         string
 	secret         string
 	serverTimeDiff time.Duration
+	limiter        *RateLimiter
 	SubAccount     *string
 	Logger         *clog.Logger
 	Buf            *bytes.Buffer
@@ -78,9 +80,10 @@ type Client struct {
 func New(opts ...Option) *Client {
 
 	client := &Client{
-		client: http.DefaultClient,
-		Logger: clog.New(),
-		Buf:    bytes.NewBuffer(make([]byte, 128)),
+		client:  http.DefaultClient,
+		limiter: NewRateLimiter(defaultRatePerSecond, defaultRateBurst),
+		Logger:  clog.New(),
+		Buf:     bytes.NewBuffer(make([]byte, 128)),
 	}
 	for _, opt := range opts {
 		opt(client)
@@ -102,6 +105,26 @@ func New(opts ...Option) *Client {
 	return client
 }
 
+// Clone returns a client with the same credentials, subaccount and server
+// time offset but its own rate limiter and stream, with opts applied on
+// top. Use it for a subaccount or to give a task its own HTTP client.
+func (c *Client) Clone(opts ...Option) *Client {
+
+	all := make([]Option, 0, len(opts)+2)
+	all = append(all, WithAuth(c.apiKey, c.secret), WithHTTPClient(c.client))
+	all = append(all, opts...)
+
+	clone := New(all...)
+	clone.serverTimeDiff = c.serverTimeDiff
+	clone.Logger = c.Logger
+	if clone.SubAccount == nil && c.SubAccount != nil {
+		nickname := *c.SubAccount
+		clone.SubAccount = &nickname
+	}
+
+	return clone
+}
+
 func (c *Client) Get(params interface{}, url string, auth bool) ([]byte, error) {
 	return c.GetResponse(params, url, http.MethodGet, auth)
 }
@@ -199,6 +222,25 @@ type Response struct {
 	Error   string          `json:"error,omitempty"`
 }
 
+// APIError is returned when the venue answers with success false.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Status Code: %d	Error: %v", e.StatusCode, e.Message)
+}
+
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound ||
+		strings.Contains(strings.ToLower(apiErr.Message), "not found")
+}
+
 type Request struct {
 	Auth       bool
 	Method     string
@@ -223,20 +265,20 @@ func (c *Client) prepareRequest(request Request) (*http.Request, error) {
 	req.URL.RawQuery = query.Encode()
 
 	if request.Auth {
-		c.Buf.Reset()
+		// Requests may be prepared concurrently so the payload is built locally
+		buf := bytes.NewBuffer(make([]byte, 0, 128))
 		nonce := strconv.FormatInt(time.Now().UTC().Add(c.serverTimeDiff).Unix()*1000, 10)
-		c.Buf.WriteString(nonce)
-		c.Buf.WriteString(req.Method)
-		c.Buf.WriteString(req.URL.Path)
+		buf.WriteString(nonce)
+		buf.WriteString(req.Method)
+		buf.WriteString(req.URL.Path)
 		if req.URL.RawQuery != "" {
-			c.Buf.WriteRune('?')
-			c.Buf.WriteString(req.URL.RawQuery)
+			buf.WriteRune('?')
+			buf.WriteString(req.URL.RawQuery)
 		}
 		if len(request.Body) > 0 {
-			c.Buf.WriteString(string(request.Body))
+			buf.Write(request.Body)
 		}
-		payload := c.Buf.String()
-		c.Buf.Reset()
+		payload := buf.String()
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set(keyHeader, c.apiKey)
 		req.Header.Set(signHeader, c.signature(payload))
@@ -255,6 +297,12 @@ func (c *Client) prepareRequest(request Request) (*http.Request, error) {
 
 func (c *Client) do(req *http.Request) ([]byte, error) {
 
+	if c.limiter != nil {
+		if err := c.limiter.Wait(req.Context()); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
 	resp, err := c.client.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
@@ -275,7 +323,7 @@ func (c *Client) do(req *http.Request) ([]byte, error) {
 	}
 
 	if !response.Success {
-		return nil, errors.Errorf("Status Code: %d	Error: %v", resp.StatusCode, response.Error)
+		return nil, errors.WithStack(&APIError{StatusCode: resp.StatusCode, Message: response.Error})
 	}
 
 	return response.Result, nil
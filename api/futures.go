@@ -85,11 +85,13 @@ func (f *Futures) GetFutureStats(future string, stats *models.FutureStats) (err
 	return nil
 }
 
-func (f *Futures) GetFundingRates() ([]*models.FundingRates, error) {
+// GetFundingRates returns the funding rates of params' range, the most recent
+// first. params may be nil for the latest rates of every perpetual.
+func (f *Futures) GetFundingRates(params *models.FundingRatesParams) ([]*models.FundingRates, error) {
 
 	url := FormURL(apiGetFundingRates)
 
-	response, err := f.client.Get(nil, url, false)
+	response, err := f.client.Get(params, url, false)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/pkg/errors"
 	"github.com/sanjujosh/go-ftx/models"
@@ -19,16 +20,18 @@ const (
 	apiPlaceOrder               = apiGetOpenOrders
 	apiPlaceTriggerOrder        = apiGetTriggerOrders
 	apiModifyOrder              = "/orders/%d/modify"
-	apiModifyOrderByClientID    = "/orders/by_client_id/%d/modify"
+	apiModifyOrderByClientID    = "/orders/by_client_id/%s/modify"
 	apiModifyTriggerOrder       = "/conditional_orders/%d/modify"
 	apiGetOrderStatus           = "/orders/%d"
-	apiGetOrderStatusByClientID = "/orders/by_client_id/%d"
+	apiGetOrderStatusByClientID = "/orders/by_client_id/%s"
 	apiCancelOrder              = apiGetOrderStatus
 	apiCancelOrderByClientID    = apiGetOrderStatusByClientID
 	apiCancelTriggerOrder       = "/conditional_orders/%d"
 	apiCancelAll                = apiGetOpenOrders
 )
 
+var ErrMissingClientID = errors.New("client order id missing")
+
 type Orders struct {
 	client *Client
 }
@@ -91,11 +94,11 @@ func (o *Orders) GetOrdersHistory(
 }
 
 func (o *Orders) GetOpenTriggerOrders(
-	market, triggerType *string) ([]*models.TriggerOrder, error) {
+	market *string, triggerType *models.TriggerOrderType) ([]*models.TriggerOrder, error) {
 
 	url := FormURL(apiGetTriggerOrders)
 
-	params := &models.TriggerOrderParams{Market: market, Type: triggerType}
+	params := &models.OpenTriggerOrdersParams{Market: market, Type: triggerType}
 	response, err := o.client.Get(params, url, true)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -167,6 +170,39 @@ func (o *Orders) PlaceOrder(params *models.OrderParams, order *models.Order) (er
 	return nil
 }
 
+// PlaceOrderOnce places params unless an order with its client ID already
+// exists, in which case that order is returned and placed is false. Retrying
+// a placement whose response was lost therefore cannot double the order.
+func (o *Orders) PlaceOrderOnce(
+	params *models.OrderParams, order *models.Order) (placed bool, err error) {
+
+	if params == nil || order == nil {
+		return false, errs.NilPtr
+	}
+
+	if params.ClientID == "" {
+		return false, ErrMissingClientID
+	}
+
+	err = o.GetOrderStatusByClientID(params.ClientID, order)
+	if err == nil {
+		return false, nil
+	}
+	if !IsNotFound(err) {
+		return false, err
+	}
+
+	if err = o.PlaceOrder(params, order); err != nil {
+		// A concurrent placement with the same client ID may have won
+		if o.GetOrderStatusByClientID(params.ClientID, order) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
 func (o *Orders) PlaceTriggerOrder(
 	params *models.TriggerOrderParams, order *models.TriggerOrder) (err error) {
 
@@ -212,14 +248,18 @@ func (o *Orders) ModifyOrder(
 }
 
 func (o *Orders) ModifyOrderByClientID(
-	clientID int64, params *models.ModifyOrderParams, order *models.Order,
+	clientID models.ClientOrderID, params *models.ModifyOrderParams, order *models.Order,
 ) (err error) {
 
 	if order == nil {
 		panic(errs.NilPtrArg)
 	}
 
-	url := FormURL(fmt.Sprintf(apiModifyOrderByClientID, clientID))
+	if clientID == "" {
+		return ErrMissingClientID
+	}
+
+	url := FormURL(fmt.Sprintf(apiModifyOrderByClientID, url.PathEscape(string(clientID))))
 
 	params.ClientID = nil
 
@@ -278,13 +318,18 @@ func (o *Orders) GetOrderStatus(orderID int64, order *models.Order) (err error)
 	return nil
 }
 
-func (o *Orders) GetOrderStatusByClientID(clientID int64, order *models.Order) (err error) {
+func (o *Orders) GetOrderStatusByClientID(
+	clientID models.ClientOrderID, order *models.Order) (err error) {
 
 	if order == nil {
 		panic(errs.NilPtrArg)
 	}
 
-	url := FormURL(fmt.Sprintf(apiGetOrderStatusByClientID, clientID))
+	if clientID == "" {
+		return ErrMissingClientID
+	}
+
+	url := FormURL(fmt.Sprintf(apiGetOrderStatusByClientID, url.PathEscape(string(clientID))))
 
 	response, err := o.client.Get(nil, url, true)
 	if err != nil {
@@ -314,9 +359,13 @@ func (o *Orders) CancelOrder(orderID int64) (result string, err error) {
 	return
 }
 
-func (o *Orders) CancelOrderByClientID(clientID int64) (result string, err error) {
+func (o *Orders) CancelOrderByClientID(clientID models.ClientOrderID) (result string, err error) {
+
+	if clientID == "" {
+		return result, ErrMissingClientID
+	}
 
-	url := FormURL(fmt.Sprintf(apiCancelOrderByClientID, clientID))
+	url := FormURL(fmt.Sprintf(apiCancelOrderByClientID, url.PathEscape(string(clientID))))
 
 	response, err := o.client.Delete(nil, url)
 	if err != nil {
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// The venue allows 30 requests per 200ms
+	defaultRatePerSecond float64 = 150
+	defaultRateBurst     int     = 30
+)
+
+// RateLimiter is a token bucket shared by every request of a Client.
+type RateLimiter struct {
+	mu        *sync.Mutex
+	perSecond float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+}
+
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		mu:        &sync.Mutex{},
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		last:      time.Now(),
+	}
+}
+
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		if perSecond <= 0 {
+			c.limiter = nil
+			return
+		}
+		c.limiter = NewRateLimiter(perSecond, burst)
+	}
+}
+
+func (r *RateLimiter) reserve() time.Duration {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.perSecond
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-r.tokens / r.perSecond * float64(time.Second))
+}
+
+// Wait blocks until a request may be sent. A cancelled wait still
+// consumes its token.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+
+	wait := r.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
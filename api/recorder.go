@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	ReplayMaxSpeed      float64 = 0
+	ReplayOriginalSpeed float64 = 1
+)
+
+// Recorder writes every raw websocket message received by a Stream
+// to a gzip compressed JSONL file, one models.RecordedWsResponse per line.
+type Recorder struct {
+	mu   *sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	gz := gzip.NewWriter(file)
+
+	return &Recorder{
+		mu:   &sync.Mutex{},
+		file: file,
+		gz:   gz,
+		enc:  json.NewEncoder(gz),
+	}, nil
+}
+
+func (r *Recorder) Record(receivedAt time.Time, msg *models.WsResponse) error {
+
+	if msg == nil {
+		return errors.New("Nil pointer")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.enc == nil {
+		return errors.New("recorder closed")
+	}
+
+	rec := models.RecordedWsResponse{ReceivedAt: receivedAt, WsResponse: *msg}
+	if err := r.enc.Encode(&rec); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (r *Recorder) Flush() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gz == nil {
+		return nil
+	}
+
+	return errors.WithStack(r.gz.Flush())
+}
+
+func (r *Recorder) Close() (err error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gz == nil {
+		return nil
+	}
+
+	if err = r.gz.Close(); err != nil {
+		r.file.Close()
+		return errors.WithStack(err)
+	}
+
+	if err = r.file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	r.gz, r.enc = nil, nil
+
+	return nil
+}
+
+// Replayer reads a session written by a Recorder and feeds it back
+// with the original spacing between messages divided by speed.
+// A speed of ReplayMaxSpeed replays without waiting.
+type Replayer struct {
+	path  string
+	speed float64
+}
+
+func NewReplayer(path string, speed float64) *Replayer {
+	if speed < 0 {
+		speed = ReplayMaxSpeed
+	}
+	return &Replayer{path: path, speed: speed}
+}
+
+func ReadRecording(path string, f func(rec *models.RecordedWsResponse) error) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+
+	for {
+		rec := models.RecordedWsResponse{}
+		if err = dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		if err = f(&rec); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Replayer) Replay(
+	ctx context.Context, handler func(msg *models.WsResponse) error) error {
+
+	var first time.Time
+	start := time.Now()
+
+	return ReadRecording(r.path, func(rec *models.RecordedWsResponse) error {
+
+		if first.IsZero() {
+			first = rec.ReceivedAt
+		}
+
+		if r.speed > 0 {
+			offset := time.Duration(float64(rec.ReceivedAt.Sub(first)) / r.speed)
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		return handler(&rec.WsResponse)
+	})
+}
+
+// NewReplayStream returns a Stream that serves a recorded session instead of
+// connecting to the exchange. The Subscribe methods return the usual channels,
+// which are closed when the end of the recording is reached.
+func NewReplayStream(client *Client, replayer *Replayer) *Stream {
+	s := NewStream(client)
+	s.replayer = replayer
+	return s
+}
+
+func (s *Stream) replayLoop(ctx context.Context) {
+
+	defer s.wg.Done()
+	defer s.cancel()
+
+	err := s.replayer.Replay(ctx, func(msg *models.WsResponse) error {
+		if !s.isSubscribed(msg) {
+			return nil
+		}
+		ct, response, err := s.MapEventResponse(msg)
+		if err != nil {
+			s.client.Logger.Debugf("replay msg: %+v", err)
+			return nil
+		}
+		// A replay waits for its readers rather than dropping messages
+		if response != nil {
+			s.deliver(ct, response, true)
+		}
+		return nil
+	})
+
+	if err != nil && ctx.Err() == nil {
+		s.setErr(err)
+	}
+}
+
+func (s *Stream) isSubscribed(msg *models.WsResponse) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.WsSub.IsSubscribed(msg.ChannelType, msg.Market)
+}
+
+func (ws *WsSub) IsSubscribed(ct models.ChannelType, market string) bool {
+	symbols, ok := ws.ChannelTypes[ct]
+	if !ok {
+		return false
+	}
+	if len(symbols) == 0 {
+		return true
+	}
+	_, ok = symbols[market]
+	return ok
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
 )
 
 const (
@@ -89,3 +91,11 @@ func PtrBool(b bool) *bool {
 func PtrDuration(d time.Duration) *time.Duration {
 	return &d
 }
+
+func PtrOrderSide(s models.OrderSide) *models.OrderSide {
+	return &s
+}
+
+func PtrTriggerOrderType(t models.TriggerOrderType) *models.TriggerOrderType {
+	return &t
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,10 +23,28 @@ const (
 	pingPeriod            = (websocketTimeout * 9) / 10
 	reconnectCount    int = 10
 	reconnectInterval     = time.Second
+	channelBuffer         = 256
 )
 
+// counters are updated atomically.
+type counters struct {
+	dropped int64
+}
+
+// heartbeat holds unix nanosecond times, updated atomically. unanswered
+// is the first ping sent since the last pong, zero once answered.
+type heartbeat struct {
+	lastMessage int64
+	lastPing    int64
+	lastPong    int64
+	unanswered  int64
+}
+
 type Stream struct {
 	client                 *Client
+	heartbeat              *heartbeat
+	counters               *counters
+	pingPeriod             time.Duration
 	mu                     *sync.Mutex
 	url                    string
 	conn                   *websocket.Conn
@@ -33,6 +52,17 @@ type Stream struct {
 	wsReconnectionCount    int
 	wsReconnectionInterval time.Duration
 	isLoggedIn             bool
+	recorder               *Recorder
+	replayer               *Replayer
+	connMu                 *sync.Mutex
+	wg                     *sync.WaitGroup
+	ctx                    context.Context
+	cancel                 context.CancelFunc
+	running                bool
+	stopped                bool
+	sent                   int
+	done                   chan struct{}
+	err                    error
 	WsSub                  *WsSub
 	tickersC               chan *models.TickerResponse
 	marketsC               chan *models.Market
@@ -50,21 +80,42 @@ type WsSub struct {
 }
 
 func NewStream(client *Client) *Stream {
-	return &Stream{
+	s := &Stream{
 		client:                 client,
+		heartbeat:              &heartbeat{},
+		counters:               &counters{},
+		pingPeriod:             pingPeriod,
 		mu:                     &sync.Mutex{},
 		url:                    wsUrl,
 		dialer:                 websocket.DefaultDialer,
 		wsReconnectionCount:    reconnectCount,
 		wsReconnectionInterval: reconnectInterval,
+		connMu:                 &sync.Mutex{},
+		wg:                     &sync.WaitGroup{},
+		ctx:                    context.Background(),
+		done:                   make(chan struct{}),
 		WsSub:                  NewWsSub(),
-		tickersC:               make(chan *models.TickerResponse),
-		marketsC:               make(chan *models.Market),
-		tradesC:                make(chan *models.TradeResponse),
-		booksC:                 make(chan *models.OrderBookResponse),
-		fillsC:                 make(chan *models.FillResponse),
-		ordersC:                make(chan *models.OrdersResponse),
 	}
+	s.makeChannels()
+	return s
+}
+
+func (s *Stream) makeChannels() {
+	s.tickersC = make(chan *models.TickerResponse, channelBuffer)
+	s.marketsC = make(chan *models.Market, channelBuffer)
+	s.tradesC = make(chan *models.TradeResponse, channelBuffer)
+	s.booksC = make(chan *models.OrderBookResponse, channelBuffer)
+	s.fillsC = make(chan *models.FillResponse, channelBuffer)
+	s.ordersC = make(chan *models.OrdersResponse, channelBuffer)
+}
+
+func (s *Stream) closeChannels() {
+	close(s.tickersC)
+	close(s.marketsC)
+	close(s.tradesC)
+	close(s.booksC)
+	close(s.fillsC)
+	close(s.ordersC)
 }
 
 func NewWsSub() *WsSub {
@@ -126,6 +177,13 @@ func (s *Stream) Authorize() (err error) {
 
 func (s *Stream) Connect(requests ...models.WSRequest) (err error) {
 
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+
 	if err = s.CreateNewConnection(); err != nil {
 		return
 	}
@@ -136,16 +194,10 @@ func (s *Stream) Connect(requests ...models.WSRequest) (err error) {
 		return errors.WithStack(err)
 	}
 
-	lastPong := time.Now()
 	s.conn.SetPongHandler(
 		func(msg string) error {
-			lastPong = time.Now()
-			if time.Since(lastPong) > websocketTimeout {
-				// TODO handle this case
-				errmsg := "PONG response time has been exceeded"
-				s.client.Logger.Debug(errmsg)
-				return errors.New(errmsg) // Handled?
-			}
+			atomic.StoreInt64(&s.heartbeat.lastPong, time.Now().UnixNano())
+			atomic.StoreInt64(&s.heartbeat.unanswered, 0)
 			s.client.Logger.Debug("PONG")
 			return nil
 		})
@@ -212,12 +264,38 @@ func (s *Stream) GetEventResponse(ctx context.Context, msg *models.WsResponse) (
 		return nil
 	}
 
+	atomic.StoreInt64(&s.heartbeat.lastMessage, time.Now().UnixNano())
+
+	if s.recorder != nil {
+		if err := s.recorder.Record(time.Now().UTC(), msg); err != nil {
+			s.client.Logger.Debugf("record msg: %+v", err)
+		}
+	}
+
+	ct, response, err := s.MapEventResponse(msg)
+	if err != nil {
+		s.client.Logger.Debugf("map msg: %+v", err)
+		return nil
+	}
+
+	if response != nil {
+		s.SendToChannel(ct, response)
+	}
+
+	return nil
+}
+
+func (s *Stream) MapEventResponse(
+	msg *models.WsResponse) (ct models.ChannelType, response interface{}, err error) {
+
+	if msg == nil {
+		return ct, nil, errors.New("Nil pointer")
+	}
+
 	if msg.ResponseType == models.Subscribed || msg.ResponseType == models.UnSubscribed {
 		return
 	}
 
-	var response interface{}
-
 	switch msg.ChannelType {
 	case models.TickerChannel:
 		response, err = msg.MapToTickerResponse()
@@ -226,7 +304,8 @@ func (s *Stream) GetEventResponse(ctx context.Context, msg *models.WsResponse) (
 	case models.OrderBookChannel:
 		response, err = msg.MapToOrderBookResponse()
 	case models.MarketsChannel:
-		response = msg.Data
+		// msg is reused between reads so the raw data has to be copied
+		response = append(json.RawMessage(nil), msg.Data...)
 	case models.FillsChannel:
 		response, err = msg.MapToFillResponse()
 	case models.OrdersChannel:
@@ -234,12 +313,10 @@ func (s *Stream) GetEventResponse(ctx context.Context, msg *models.WsResponse) (
 	}
 
 	if err != nil {
-		return
+		return ct, nil, err
 	}
 
-	go s.SendToChannel(msg.ChannelType, response)
-
-	return
+	return msg.ChannelType, response, nil
 }
 
 func (s *Stream) IsLoggedIn() bool {
@@ -249,15 +326,16 @@ func (s *Stream) IsLoggedIn() bool {
 func (s *Stream) Reconnect(ctx context.Context) (err error) {
 
 	for i := 0; i < s.wsReconnectionCount; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
 		if err = s.Connect(); err == nil {
 			return nil
 		}
 		select {
 		case <-time.After(s.wsReconnectionInterval):
-			if err = s.Connect(); err != nil {
-				continue
-			}
-			return nil
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -266,6 +344,52 @@ func (s *Stream) Reconnect(ctx context.Context) (err error) {
 	return errors.New("Reconnection failed")
 }
 
+func (s *Stream) SetRecorder(recorder *Recorder) {
+	s.mu.Lock()
+	s.recorder = recorder
+	s.mu.Unlock()
+}
+
+func (s *Stream) SetURL(url string) {
+	s.mu.Lock()
+	s.url = url
+	s.mu.Unlock()
+}
+
+// SetPingPeriod sets how often pings are sent. It applies from the next
+// start of the stream.
+func (s *Stream) SetPingPeriod(period time.Duration) {
+	s.mu.Lock()
+	s.pingPeriod = period
+	s.mu.Unlock()
+}
+
+func unixTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+// LastMessage returns when the last message was read, or the zero time.
+func (s *Stream) LastMessage() time.Time {
+	return unixTime(atomic.LoadInt64(&s.heartbeat.lastMessage))
+}
+
+func (s *Stream) LastPing() time.Time {
+	return unixTime(atomic.LoadInt64(&s.heartbeat.lastPing))
+}
+
+func (s *Stream) LastPong() time.Time {
+	return unixTime(atomic.LoadInt64(&s.heartbeat.lastPong))
+}
+
+// UnansweredPing returns when the oldest ping not yet answered by a pong
+// was sent, or the zero time if every ping has been answered.
+func (s *Stream) UnansweredPing() time.Time {
+	return unixTime(atomic.LoadInt64(&s.heartbeat.unanswered))
+}
+
 func (s *Stream) SetReconnectionCount(count int) {
 	s.mu.Lock()
 	s.wsReconnectionCount = count
@@ -278,8 +402,14 @@ func (s *Stream) SetReconnectionInterval(interval time.Duration) {
 	s.mu.Unlock()
 }
 
-func (s *Stream) sub() (err error) {
-	for _, r := range s.WsSub.Requests {
+func (s *Stream) requests() []models.WSRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.WSRequest(nil), s.WsSub.Requests...)
+}
+
+func (s *Stream) sub(requests []models.WSRequest) (err error) {
+	for _, r := range requests {
 		if err = s.conn.WriteJSON(r); err != nil {
 			return errors.WithStack(err)
 		}
@@ -288,9 +418,20 @@ func (s *Stream) sub() (err error) {
 }
 
 func (s *Stream) Subscribe() (err error) {
+	s.sent = 0
+	return s.subscribe()
+}
+
+func (s *Stream) subscribe() (err error) {
+
+	requests := s.requests()
+	if s.sent > len(requests) {
+		s.sent = 0
+	}
+	requests = requests[s.sent:]
 
 	if !s.isLoggedIn {
-		for _, r := range s.WsSub.Requests {
+		for _, r := range requests {
 			ct := r.ChannelType
 			if ct == models.FillsChannel || ct == models.OrdersChannel {
 				if err = s.Authorize(); err != nil {
@@ -301,117 +442,347 @@ func (s *Stream) Subscribe() (err error) {
 		}
 	}
 
-	return s.sub()
+	if err = s.sub(requests); err != nil {
+		return
+	}
+
+	s.sent += len(requests)
+
+	return nil
 }
 
+// SendToChannel delivers a response without blocking the read loop, which
+// also serves the pongs and every other subscriber. Each channel buffers
+// channelBuffer messages; a reader that falls further behind loses the
+// overflow, counted by Dropped.
 func (s *Stream) SendToChannel(ct models.ChannelType, response interface{}) {
+	s.deliver(ct, response, false)
+}
+
+// Dropped returns the number of messages lost to full channels.
+func (s *Stream) Dropped() int64 {
+	return atomic.LoadInt64(&s.counters.dropped)
+}
+
+// deliver sends response on the channel of ct. If block is set it waits
+// for a reader or for the stream to stop, otherwise a full channel drops
+// the message.
+func (s *Stream) deliver(ct models.ChannelType, response interface{}, block bool) {
+
+	done := s.ctx.Done()
 
 	switch ct {
 	case models.TickerChannel:
 		ticker, ok := response.(*models.TickerResponse)
 		if ok && ticker != nil {
-			s.tickersC <- ticker
+			select {
+			case s.tickersC <- ticker:
+			default:
+				if !block {
+					s.drop()
+					return
+				}
+				select {
+				case s.tickersC <- ticker:
+				case <-done:
+				}
+			}
 		}
 	case models.TradesChannel:
 		trades, ok := response.(*models.TradesResponse)
 		if ok && trades != nil {
 			for _, t := range trades.Trades {
-				s.tradesC <- &models.TradeResponse{
-					Trade:        t,
-					BaseResponse: trades.BaseResponse,
+				trade := &models.TradeResponse{Trade: t, BaseResponse: trades.BaseResponse}
+				select {
+				case s.tradesC <- trade:
+				default:
+					if !block {
+						s.drop()
+						continue
+					}
+					select {
+					case s.tradesC <- trade:
+					case <-done:
+						return
+					}
 				}
 			}
 		}
 	case models.OrderBookChannel:
 		book, ok := response.(*models.OrderBookResponse)
 		if ok && book != nil {
-			s.booksC <- book
+			select {
+			case s.booksC <- book:
+			default:
+				if !block {
+					s.drop()
+					return
+				}
+				select {
+				case s.booksC <- book:
+				case <-done:
+				}
+			}
 		}
 	case models.MarketsChannel:
 		markets, err := MapToMarketData(response)
 		if err == nil {
 			for _, m := range markets {
-				if m != nil {
-					s.marketsC <- m
+				if m == nil {
+					continue
+				}
+				select {
+				case s.marketsC <- m:
+				default:
+					if !block {
+						s.drop()
+						continue
+					}
+					select {
+					case s.marketsC <- m:
+					case <-done:
+						return
+					}
 				}
 			}
 		}
 	case models.FillsChannel:
 		fill, ok := response.(*models.FillResponse)
 		if ok && fill != nil {
-			s.fillsC <- fill
+			select {
+			case s.fillsC <- fill:
+			default:
+				if !block {
+					s.drop()
+					return
+				}
+				select {
+				case s.fillsC <- fill:
+				case <-done:
+				}
+			}
 		}
 	case models.OrdersChannel:
 		order, ok := response.(*models.OrdersResponse)
 		if ok && order != nil {
-			s.ordersC <- order
+			select {
+			case s.ordersC <- order:
+			default:
+				if !block {
+					s.drop()
+					return
+				}
+				select {
+				case s.ordersC <- order:
+				case <-done:
+				}
+			}
 		}
 	}
 }
 
+func (s *Stream) drop() {
+	n := atomic.AddInt64(&s.counters.dropped, 1)
+	s.client.Logger.Debugf("stream channel full, %d messages dropped", n)
+}
+
+// Serve connects and starts reading in the background. Once the stream is
+// running further calls only send the new subscriptions; the context of the
+// first call controls the lifetime of the stream.
 func (s *Stream) Serve(ctx context.Context) (err error) {
 
-	if err = s.Connect(); err != nil {
-		return errors.WithStack(err)
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		if s.replayer != nil {
+			return nil
+		}
+		s.connMu.Lock()
+		defer s.connMu.Unlock()
+		return s.subscribe()
 	}
+	s.running = true
+	s.mu.Unlock()
+
+	if s.replayer == nil {
+		if err = s.Connect(); err != nil {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+			return errors.WithStack(err)
+		}
+	}
+
+	s.start(ctx)
 
-	msg := models.WsResponse{}
+	return nil
+}
+
+// Run serves the stream and blocks until it has stopped.
+func (s *Stream) Run(ctx context.Context) error {
+
+	if err := s.Serve(ctx); err != nil {
+		return err
+	}
+
+	<-s.Done()
+
+	return s.Err()
+}
+
+// Close stops the stream and waits for all of its goroutines to exit.
+// The output channels are closed once it returns.
+func (s *Stream) Close() error {
+
+	s.mu.Lock()
+	running, cancel, done := s.running, s.cancel, s.done
+	s.mu.Unlock()
+
+	if running && cancel != nil {
+		cancel()
+		<-done
+	}
+
+	return s.Err()
+}
+
+// Done is closed when the stream has stopped and its channels are closed.
+func (s *Stream) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// Err returns the error that stopped the stream. It is nil while the stream
+// is running and after a shutdown requested through the context or Close.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Stream) setErr(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stream) start(ctx context.Context) {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	if s.stopped {
+		s.makeChannels()
+		s.done = make(chan struct{})
+		s.stopped = false
+	}
+	s.ctx, s.cancel, s.err = ctx, cancel, nil
+	s.mu.Unlock()
+
+	if s.replayer != nil {
+		s.wg.Add(1)
+		go s.replayLoop(ctx)
+	} else {
+		s.wg.Add(2)
+		go s.readLoop(ctx)
+		go s.pingLoop(ctx)
+	}
 
 	go func() {
+		s.wg.Wait()
+		s.finish()
+	}()
+}
 
-		go func() {
-			for {
-				s.client.mu.Lock()
-				if err = s.GetEventResponse(ctx, &msg); err != nil {
-					s.client.mu.Unlock()
-					return
-				}
-				s.client.mu.Unlock()
+func (s *Stream) readLoop(ctx context.Context) {
+
+	defer s.wg.Done()
+	defer s.cancel()
+
+	for {
+		msg := &models.WsResponse{}
+		if err := s.GetEventResponse(ctx, msg); err != nil {
+			if ctx.Err() == nil {
+				s.setErr(err)
 			}
-		}()
+			return
+		}
+	}
+}
 
-		for {
+func (s *Stream) pingLoop(ctx context.Context) {
 
-			select {
+	defer s.wg.Done()
+
+	s.mu.Lock()
+	period := s.pingPeriod
+	s.mu.Unlock()
 
-			case <-ctx.Done():
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
 
-				s.client.mu.Lock()
-				err = s.conn.WriteMessage(
+	for {
+
+		select {
+
+		case <-ctx.Done():
+
+			s.connMu.Lock()
+			if s.conn != nil {
+				err := s.conn.WriteMessage(
 					websocket.CloseMessage,
 					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-
 				if err != nil {
 					s.client.Logger.Debugf("write close msg: %v", err)
-					s.client.mu.Unlock()
-					return
 				}
-				s.client.mu.Unlock()
-
-				time.Sleep(time.Second)
+				s.conn.Close()
+			}
+			s.connMu.Unlock()
 
-				return
+			return
 
-			case <-time.After(pingPeriod):
+		case <-ticker.C:
 
-				s.client.Logger.Debug("PING")
+			s.client.Logger.Debug("PING")
 
-				s.client.mu.Lock()
+			s.connMu.Lock()
+			err := websocket.ErrCloseSent
+			if s.conn != nil {
 				err = s.conn.WriteControl(
 					websocket.PingMessage,
 					[]byte(`{"op": "pong"}`),
 					time.Now().UTC().Add(10*time.Second))
-
-				if err != nil && err != websocket.ErrCloseSent {
-					s.client.Logger.Debugf("write ping: %v", err)
-				}
-				s.client.mu.Unlock()
-
+			}
+			s.connMu.Unlock()
+
+			if err == nil {
+				now := time.Now().UnixNano()
+				atomic.StoreInt64(&s.heartbeat.lastPing, now)
+				// Later pings must not hide an earlier one going unanswered
+				atomic.CompareAndSwapInt64(&s.heartbeat.unanswered, 0, now)
+			} else if err != websocket.ErrCloseSent {
+				s.client.Logger.Debugf("write ping: %v", err)
 			}
 		}
-	}()
+	}
+}
+
+func (s *Stream) finish() {
 
-	return err
+	s.connMu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.connMu.Unlock()
+
+	s.mu.Lock()
+	s.closeChannels()
+	s.running, s.stopped = false, true
+	close(s.done)
+	s.mu.Unlock()
 }
 
 func (s *Stream) SubscribeToTickers(
@@ -421,9 +792,7 @@ func (s *Stream) SubscribeToTickers(
 		return nil, errors.New("symbols missing")
 	}
 
-	ct, ws := models.TickerChannel, s.WsSub
-
-	ws.AppendRequests(ct, symbols...)
+	s.appendRequests(models.TickerChannel, symbols...)
 
 	err := s.Serve(ctx)
 	if err != nil {
@@ -435,9 +804,7 @@ func (s *Stream) SubscribeToTickers(
 
 func (s *Stream) SubscribeToMarkets(ctx context.Context) (chan *models.Market, error) {
 
-	ct, ws := models.MarketsChannel, s.WsSub
-
-	ws.AppendRequests(ct)
+	s.appendRequests(models.MarketsChannel)
 
 	err := s.Serve(ctx)
 	if err != nil {
@@ -454,9 +821,7 @@ func (s *Stream) SubscribeToTrades(
 		return nil, errors.New("symbols missing")
 	}
 
-	ct, ws := models.TradesChannel, s.WsSub
-
-	ws.AppendRequests(ct, symbols...)
+	s.appendRequests(models.TradesChannel, symbols...)
 
 	err := s.Serve(ctx)
 	if err != nil {
@@ -473,9 +838,7 @@ func (s *Stream) SubscribeToOrderBooks(
 		return nil, errors.New("symbols is missing")
 	}
 
-	ct, ws := models.OrderBookChannel, s.WsSub
-
-	ws.AppendRequests(ct, symbols...)
+	s.appendRequests(models.OrderBookChannel, symbols...)
 
 	err := s.Serve(ctx)
 	if err != nil {
@@ -489,9 +852,7 @@ func (s *Stream) SubscribeToOrderBooks(
 
 func (s *Stream) SubscribeToFills(ctx context.Context) (chan *models.FillResponse, error) {
 
-	ct, ws := models.FillsChannel, s.WsSub
-
-	ws.AppendRequests(ct)
+	s.appendRequests(models.FillsChannel)
 
 	err := s.Serve(ctx)
 	if err != nil {
@@ -501,16 +862,10 @@ func (s *Stream) SubscribeToFills(ctx context.Context) (chan *models.FillRespons
 	return s.fillsC, nil
 }
 
-func (s *Stream) SubscribeToOrders(
-	ctx context.Context, symbols ...string) (chan *models.OrdersResponse, error) {
-
-	if len(symbols) == 0 {
-		return nil, errors.New("symbols missing")
-	}
-
-	ct, ws := models.OrdersChannel, s.WsSub
+// SubscribeToOrders subscribes to the account wide orders channel.
+func (s *Stream) SubscribeToOrders(ctx context.Context) (chan *models.OrdersResponse, error) {
 
-	ws.AppendRequests(ct, symbols...)
+	s.appendRequests(models.OrdersChannel)
 
 	err := s.Serve(ctx)
 	if err != nil {
@@ -520,6 +875,12 @@ func (s *Stream) SubscribeToOrders(
 	return s.ordersC, nil
 }
 
+func (s *Stream) appendRequests(ct models.ChannelType, symbols ...string) {
+	s.mu.Lock()
+	s.WsSub.AppendRequests(ct, symbols...)
+	s.mu.Unlock()
+}
+
 func (s *Stream) WSConn() *websocket.Conn {
 	return s.conn
 }
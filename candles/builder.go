@@ -0,0 +1,404 @@
+package candles
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	defaultHistory    = 1000
+	defaultBufferSize = 1024
+	flushInterval     = time.Second
+)
+
+// Bar is an OHLCV bar. Volume is quote volume (price * size) to match
+// the volume reported by Markets.GetHistoricalPrices.
+type Bar struct {
+	Market     string
+	Resolution models.Resolution
+	StartTime  time.Time
+	Open       decimal.Decimal
+	High       decimal.Decimal
+	Low        decimal.Decimal
+	Close      decimal.Decimal
+	Volume     decimal.Decimal
+	Trades     int
+	Closed     bool
+	firstTrade time.Time
+	lastTrade  time.Time
+}
+
+func (b *Bar) EndTime() time.Time {
+	return b.StartTime.Add(time.Duration(b.Resolution) * time.Second)
+}
+
+type series struct {
+	open      map[int64]*Bar
+	history   []Bar
+	last      int64
+	seedStart int64
+	seedUntil time.Time
+}
+
+type Option func(b *Builder)
+
+// WithGrace sets how long a bar stays open after its end time to
+// accept late and out-of-order trades.
+func WithGrace(grace time.Duration) Option {
+	return func(b *Builder) {
+		b.grace = grace
+	}
+}
+
+func WithHistory(n int) Option {
+	return func(b *Builder) {
+		b.history = n
+	}
+}
+
+func WithBufferSize(n int) Option {
+	return func(b *Builder) {
+		b.bufferSize = n
+	}
+}
+
+type Builder struct {
+	client     *api.Client
+	resolution models.Resolution
+	grace      time.Duration
+	history    int
+	bufferSize int
+	mu         *sync.Mutex
+	series     map[string]*series
+	dropped    int
+}
+
+func New(client *api.Client, resolution models.Resolution, opts ...Option) *Builder {
+
+	b := &Builder{
+		client:     client,
+		resolution: resolution,
+		history:    defaultHistory,
+		bufferSize: defaultBufferSize,
+		mu:         &sync.Mutex{},
+		series:     make(map[string]*series),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+func (b *Builder) seconds() int64 {
+	return int64(b.resolution)
+}
+
+func (b *Builder) start(t time.Time) int64 {
+	sec, res := t.Unix(), b.seconds()
+	return sec - ((sec%res)+res)%res
+}
+
+func (b *Builder) final(start int64, now time.Time) bool {
+	end := time.Unix(start+b.seconds(), 0)
+	return !now.Before(end.Add(b.grace))
+}
+
+func (b *Builder) getSeries(market string) *series {
+	s, ok := b.series[market]
+	if !ok {
+		s = &series{open: make(map[int64]*Bar)}
+		b.series[market] = s
+	}
+	return s
+}
+
+// Backfill loads recent candles for the markets so that History has no
+// startup gap. The candle still in progress is used to seed the open bar;
+// trades up to the backfill time are assumed to be included in it.
+func (b *Builder) Backfill(limit int, markets ...string) error {
+
+	if b.client == nil {
+		return errors.New("Nil client")
+	}
+
+	for _, market := range markets {
+
+		prices, err := b.client.Markets.GetHistoricalPrices(
+			market,
+			&models.GetHistoricalPricesParams{
+				Resolution: b.resolution,
+				Limit:      api.PtrInt(limit),
+			})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		b.Seed(market, prices, time.Now())
+	}
+
+	return nil
+}
+
+func (b *Builder) Seed(market string, prices []*models.HistoricalPrice, now time.Time) {
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].StartTime.Before(prices[j].StartTime)
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.getSeries(market)
+
+	for _, p := range prices {
+
+		if p == nil {
+			continue
+		}
+
+		start := b.start(p.StartTime)
+		if start <= s.last {
+			continue
+		}
+
+		bar := Bar{
+			Market:     market,
+			Resolution: b.resolution,
+			StartTime:  time.Unix(start, 0).UTC(),
+			Open:       p.Open,
+			High:       p.High,
+			Low:        p.Low,
+			Close:      p.Close,
+			Volume:     p.Volume,
+		}
+
+		if b.final(start, now) {
+			bar.Closed = true
+			b.appendHistory(s, bar)
+			continue
+		}
+
+		bar.firstTrade, bar.lastTrade = bar.StartTime, now
+		s.open[start] = &bar
+		s.seedStart, s.seedUntil = start, now
+	}
+}
+
+func (b *Builder) appendHistory(s *series, bar Bar) {
+	s.history = append(s.history, bar)
+	if b.history > 0 && len(s.history) > b.history {
+		s.history = s.history[len(s.history)-b.history:]
+	}
+	s.last = b.start(bar.StartTime)
+}
+
+// Add applies a trade and returns the updated in-progress bar. Trades for
+// bars that have already been closed are dropped.
+func (b *Builder) Add(trade *models.TradeResponse) []Bar {
+
+	if trade == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, start := b.getSeries(trade.Symbol), b.start(trade.Time)
+
+	if s.last != 0 && start <= s.last {
+		b.dropped++
+		return nil
+	}
+
+	if start == s.seedStart && !trade.Time.After(s.seedUntil) {
+		return nil
+	}
+
+	bar, ok := s.open[start]
+	if !ok {
+		bar = &Bar{
+			Market:     trade.Symbol,
+			Resolution: b.resolution,
+			StartTime:  time.Unix(start, 0).UTC(),
+			Open:       trade.Price,
+			High:       trade.Price,
+			Low:        trade.Price,
+			Close:      trade.Price,
+			firstTrade: trade.Time,
+			lastTrade:  trade.Time,
+		}
+		s.open[start] = bar
+	}
+
+	if trade.Price.GreaterThan(bar.High) {
+		bar.High = trade.Price
+	}
+	if trade.Price.LessThan(bar.Low) {
+		bar.Low = trade.Price
+	}
+	if trade.Time.Before(bar.firstTrade) {
+		bar.Open, bar.firstTrade = trade.Price, trade.Time
+	}
+	if !trade.Time.Before(bar.lastTrade) {
+		bar.Close, bar.lastTrade = trade.Price, trade.Time
+	}
+
+	bar.Volume = bar.Volume.Add(trade.Price.Mul(trade.Size))
+	bar.Trades++
+
+	return []Bar{*bar}
+}
+
+// Flush closes every bar whose end time plus the grace window has passed.
+// Periods without trades are filled with flat bars at the previous close.
+func (b *Builder) Flush(now time.Time) []Bar {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	markets := make([]string, 0, len(b.series))
+	for m := range b.series {
+		markets = append(markets, m)
+	}
+	sort.Strings(markets)
+
+	result := make([]Bar, 0)
+	res := b.seconds()
+
+	for _, market := range markets {
+
+		s := b.series[market]
+
+		var next int64
+		if s.last != 0 {
+			next = s.last + res
+		} else {
+			for start := range s.open {
+				if next == 0 || start < next {
+					next = start
+				}
+			}
+			if next == 0 {
+				continue
+			}
+		}
+
+		for ; b.final(next, now); next += res {
+
+			bar, ok := s.open[next]
+			if ok {
+				delete(s.open, next)
+			} else if len(s.history) > 0 {
+				prev := s.history[len(s.history)-1].Close
+				bar = &Bar{
+					Market:     market,
+					Resolution: b.resolution,
+					StartTime:  time.Unix(next, 0).UTC(),
+					Open:       prev,
+					High:       prev,
+					Low:        prev,
+					Close:      prev,
+				}
+			} else {
+				continue
+			}
+
+			bar.Closed = true
+			b.appendHistory(s, *bar)
+			result = append(result, *bar)
+		}
+	}
+
+	return result
+}
+
+// Run consumes trades and emits in-progress and closed bars until the
+// context is done or the trade channel is closed.
+func (b *Builder) Run(
+	ctx context.Context, tradesC <-chan *models.TradeResponse) <-chan Bar {
+
+	barsC := make(chan Bar, b.bufferSize)
+
+	go func() {
+
+		defer close(barsC)
+
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		for {
+
+			var bars []Bar
+
+			select {
+			case <-ctx.Done():
+				return
+			case trade, ok := <-tradesC:
+				if !ok {
+					return
+				}
+				bars = b.Add(trade)
+			case now := <-ticker.C:
+				bars = b.Flush(now)
+			}
+
+			for _, bar := range bars {
+				select {
+				case barsC <- bar:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return barsC
+}
+
+func (b *Builder) History(market string) []Bar {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.series[market]
+	if !ok {
+		return nil
+	}
+
+	return append([]Bar(nil), s.history...)
+}
+
+func (b *Builder) Current(market string) (Bar, bool) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.series[market]
+	if !ok || len(s.open) == 0 {
+		return Bar{}, false
+	}
+
+	var latest *Bar
+	for _, bar := range s.open {
+		if latest == nil || bar.StartTime.After(latest.StartTime) {
+			latest = bar
+		}
+	}
+
+	return *latest, true
+}
+
+func (b *Builder) Dropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
@@ -0,0 +1,214 @@
+package fees
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/pnl"
+)
+
+const rollingWindow = 30 * 24 * time.Hour
+
+const dayLayout = "2006-01-02"
+
+// Bucket totals the fills of one key. Volume is the notional traded and
+// Fees what was paid, both in the quote currency; in the by currency
+// breakdown Fees is in the fee currency itself and Rate is left zero.
+// Rate is Fees / Volume.
+type Bucket struct {
+	Key    string          `json:"key"`
+	Fills  int             `json:"fills"`
+	Volume decimal.Decimal `json:"volume"`
+	Fees   decimal.Decimal `json:"fees"`
+	Rate   decimal.Decimal `json:"rate"`
+}
+
+func (b *Bucket) add(volume, fee decimal.Decimal) {
+	b.Fills++
+	b.Volume = b.Volume.Add(volume)
+	b.Fees = b.Fees.Add(fee)
+}
+
+// Report summarizes the fees of the fills of [Start, End]. ScheduleRate is
+// the rate the account's maker and taker fees give the period's maker and
+// taker volume, to compare with the effective Total.Rate. RollingVolume is
+// the volume of the 30 days up to End.
+type Report struct {
+	Start         time.Time       `json:"start"`
+	End           time.Time       `json:"end"`
+	Total         Bucket          `json:"total"`
+	ByMarket      []Bucket        `json:"byMarket"`
+	ByLiquidity   []Bucket        `json:"byLiquidity"`
+	ByCurrency    []Bucket        `json:"byCurrency"`
+	ByDay         []Bucket        `json:"byDay"`
+	MakerFee      decimal.Decimal `json:"makerFee"`
+	TakerFee      decimal.Decimal `json:"takerFee"`
+	ScheduleRate  decimal.Decimal `json:"scheduleRate"`
+	RollingVolume decimal.Decimal `json:"rollingVolume"`
+}
+
+// quoteFee returns the fee of a fill in the quote currency.
+func quoteFee(fill *models.Fill) decimal.Decimal {
+	fee := decimal.NewFromFloat(fill.Fee)
+	if fill.FeeCurrency != "" && fill.FeeCurrency == fill.BaseCurrency {
+		return fee.Mul(fill.Price)
+	}
+	return fee
+}
+
+type buckets map[string]*Bucket
+
+func (b buckets) add(key string, volume, fee decimal.Decimal) {
+	bucket, ok := b[key]
+	if !ok {
+		bucket = &Bucket{Key: key}
+		b[key] = bucket
+	}
+	bucket.add(volume, fee)
+}
+
+func (b buckets) sorted() []Bucket {
+	result := make([]Bucket, 0, len(b))
+	for _, bucket := range b {
+		result = append(result, *bucket)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// rated sets the rate of buckets whose fees are in the quote currency.
+func rated(result []Bucket) []Bucket {
+	for i := range result {
+		result[i].Rate = rate(&result[i])
+	}
+	return result
+}
+
+func rate(b *Bucket) decimal.Decimal {
+	if b.Volume.Sign() == 0 {
+		return decimal.Zero
+	}
+	return b.Fees.Div(b.Volume)
+}
+
+// Build reports the fills of [start, end]. Fills before start count
+// towards the rolling volume only. info may be nil.
+func Build(
+	fills []*models.Fill, info *models.AccountInformation, start, end time.Time) *Report {
+
+	r := &Report{Start: start, End: end, Total: Bucket{Key: "total"}}
+	if info != nil {
+		r.MakerFee, r.TakerFee = info.MakerFee, info.TakerFee
+	}
+
+	markets, liquidity, currencies, days := buckets{}, buckets{}, buckets{}, buckets{}
+	maker, taker := decimal.Zero, decimal.Zero
+
+	for _, f := range fills {
+
+		if f == nil || f.Time.After(end) {
+			continue
+		}
+
+		volume := f.Size.Mul(f.Price)
+		if f.Time.After(end.Add(-rollingWindow)) {
+			r.RollingVolume = r.RollingVolume.Add(volume)
+		}
+
+		if f.Time.Before(start) {
+			continue
+		}
+
+		fee := quoteFee(f)
+		r.Total.add(volume, fee)
+		markets.add(f.Market, volume, fee)
+		liquidity.add(f.Liquidity, volume, fee)
+		currencies.add(f.FeeCurrency, volume, decimal.NewFromFloat(f.Fee))
+		days.add(f.Time.UTC().Format(dayLayout), volume, fee)
+
+		if f.Liquidity == string(models.Maker) {
+			maker = maker.Add(volume)
+		} else {
+			taker = taker.Add(volume)
+		}
+	}
+
+	r.Total.Rate = rate(&r.Total)
+	r.ByMarket = rated(markets.sorted())
+	r.ByLiquidity = rated(liquidity.sorted())
+	r.ByCurrency = currencies.sorted()
+	r.ByDay = rated(days.sorted())
+
+	if r.Total.Volume.Sign() > 0 {
+		r.ScheduleRate = maker.Mul(r.MakerFee).Add(taker.Mul(r.TakerFee)).Div(r.Total.Volume)
+	}
+
+	return r
+}
+
+// Load pages through the fills needed for the report of [start, end],
+// including the 30 days before end for the rolling volume.
+func Load(
+	src pnl.FillHistory, info *models.AccountInformation, start, end time.Time) (*Report, error) {
+
+	from := start
+	if rolling := end.Add(-rollingWindow); rolling.Before(from) {
+		from = rolling
+	}
+
+	fills, err := pnl.FetchFills(src, from, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return Build(fills, info, start, end), nil
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	return errors.WithStack(json.NewEncoder(w).Encode(r))
+}
+
+// WriteCSV writes one row per bucket, the total first, under a
+// section,key,fills,volume,fees,rate header.
+func (r *Report) WriteCSV(w io.Writer) error {
+
+	out := csv.NewWriter(w)
+
+	if err := out.Write([]string{"section", "key", "fills", "volume", "fees", "rate"}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	sections := []struct {
+		name    string
+		buckets []Bucket
+	}{
+		{"total", []Bucket{r.Total}},
+		{"market", r.ByMarket},
+		{"liquidity", r.ByLiquidity},
+		{"currency", r.ByCurrency},
+		{"day", r.ByDay},
+	}
+
+	for _, s := range sections {
+		for _, b := range s.buckets {
+			row := []string{
+				s.name, b.Key, decimal.NewFromInt(int64(b.Fills)).String(),
+				b.Volume.String(), b.Fees.String(), b.Rate.String(),
+			}
+			if err := out.Write(row); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	out.Flush()
+
+	return errors.WithStack(out.Error())
+}
@@ -0,0 +1,388 @@
+package flatten
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/normalize"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultPollInterval = 500 * time.Millisecond
+)
+
+var errNoBook = errors.New("no book")
+
+var (
+	ErrTimeout         = errors.New("positions not reduced before the timeout")
+	ErrInvalidFraction = errors.New("fraction must be in [0, 1)")
+)
+
+// Account is the position source. *api.Account and the paper trading
+// engine satisfy it.
+type Account interface {
+	GetPositions() ([]*models.Position, error)
+}
+
+// Orders is the order service positions are reduced through. *api.Orders
+// and the paper trading engine satisfy it.
+type Orders interface {
+	PlaceOrder(params *models.OrderParams, order *models.Order) error
+	GetOrderStatus(orderID int64, order *models.Order) error
+	CancelOrder(orderID int64) (string, error)
+	CancelAllOrders(params *models.CancelAllParams) (string, error)
+}
+
+// TopOfBook provides the best bid and ask of a market. *orderbook.Books
+// and the paper trading engine satisfy it.
+type TopOfBook interface {
+	Book(market string) (bid, ask decimal.Decimal, ok bool)
+}
+
+type config struct {
+	book         TopOfBook
+	slippage     decimal.Decimal
+	normalizer   *normalize.Normalizer
+	markets      []string
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+type Option func(c *config)
+
+// WithSlippageCap sends IOC limit orders at most slippage, a fraction of
+// the touch, through it instead of market orders. Markets without a book
+// are retried until the timeout.
+func WithSlippageCap(book TopOfBook, slippage decimal.Decimal) Option {
+	return func(c *config) {
+		c.book = book
+		c.slippage = slippage
+	}
+}
+
+// WithNormalizer rounds reduce orders onto the market grid. Remainders
+// below the minimum size are left.
+func WithNormalizer(n *normalize.Normalizer) Option {
+	return func(c *config) {
+		c.normalizer = n
+	}
+}
+
+// WithMarkets limits the cancels and reductions to markets.
+func WithMarkets(markets ...string) Option {
+	return func(c *config) {
+		c.markets = append([]string(nil), markets...)
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.pollInterval = interval
+	}
+}
+
+// Result is the outcome for one account. Remaining is the signed size
+// per market still beyond the target; it is empty once done.
+type Result struct {
+	SubAccount string
+	Orders     []models.Order
+	Remaining  map[string]decimal.Decimal
+	Err        error
+}
+
+// Flattener closes or shrinks the positions of one account.
+type Flattener struct {
+	cfg        config
+	account    Account
+	orders     Orders
+	subAccount string
+}
+
+func New(account Account, orders Orders, opts ...Option) *Flattener {
+
+	cfg := config{timeout: defaultTimeout, pollInterval: defaultPollInterval}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Flattener{cfg: cfg, account: account, orders: orders}
+}
+
+// NewForClient returns a flattener for the client's account or subaccount.
+func NewForClient(client *api.Client, opts ...Option) *Flattener {
+	f := New(&client.Account, &client.Orders, opts...)
+	if client.SubAccount != nil {
+		f.subAccount = *client.SubAccount
+	}
+	return f
+}
+
+// Flatten cancels every open and trigger order and closes every position
+// with reduce-only orders, re-checking until flat or the timeout.
+func (f *Flattener) Flatten(ctx context.Context) Result {
+	return f.Reduce(ctx, decimal.Zero)
+}
+
+// Reduce cancels every open and trigger order and shrinks each position
+// to fraction of its current size, e.g. 0.5 to halve it.
+func (f *Flattener) Reduce(ctx context.Context, fraction decimal.Decimal) Result {
+
+	result := Result{SubAccount: f.subAccount}
+
+	if fraction.Sign() < 0 || fraction.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		result.Err = ErrInvalidFraction
+		return result
+	}
+
+	if err := f.cancelAll(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	positions, err := f.positions()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	targets := make(map[string]decimal.Decimal, len(positions))
+	for market, net := range positions {
+		targets[market] = net.Mul(fraction)
+	}
+
+	deadline := time.Now().Add(f.cfg.timeout)
+
+	for {
+
+		result.Remaining = make(map[string]decimal.Decimal)
+		for market, target := range targets {
+			if excess := positions[market].Sub(target); excess.Sign() != 0 && !crossed(target, excess) {
+				result.Remaining[market] = excess
+			}
+		}
+
+		sent, waiting := 0, 0
+		for _, market := range sortedKeys(result.Remaining) {
+			order, err := f.reduce(ctx, market, result.Remaining[market], deadline)
+			if err == errNoBook {
+				waiting++
+				continue
+			}
+			if err != nil {
+				result.Err = err
+				return result
+			}
+			if order != nil {
+				result.Orders = append(result.Orders, *order)
+				sent++
+			}
+		}
+
+		// Without orders to send what is left is below the minimum size
+		if sent == 0 && waiting == 0 {
+			return result
+		}
+
+		if time.Now().After(deadline) {
+			result.Err = ErrTimeout
+			return result
+		}
+
+		select {
+		case <-time.After(f.cfg.pollInterval):
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return result
+		}
+
+		if positions, err = f.positions(); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+}
+
+// crossed reports whether a position has gone through its target, which
+// reduce-only orders cannot fix.
+func crossed(target, excess decimal.Decimal) bool {
+	return target.Sign() != 0 && target.Sign() != excess.Sign()
+}
+
+func (f *Flattener) cancelAll() error {
+
+	if f.cfg.markets == nil {
+		_, err := f.orders.CancelAllOrders(&models.CancelAllParams{})
+		return err
+	}
+
+	for _, market := range f.cfg.markets {
+		m := market
+		if _, err := f.orders.CancelAllOrders(&models.CancelAllParams{Market: &m}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *Flattener) included(market string) bool {
+	if f.cfg.markets == nil {
+		return true
+	}
+	for _, m := range f.cfg.markets {
+		if m == market {
+			return true
+		}
+	}
+	return false
+}
+
+// positions returns the non-zero net sizes by market.
+func (f *Flattener) positions() (map[string]decimal.Decimal, error) {
+
+	positions, err := f.account.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]decimal.Decimal, len(positions))
+	for _, p := range positions {
+		if p == nil || p.NetSize.Sign() == 0 || !f.included(p.Future) {
+			continue
+		}
+		result[p.Future] = p.NetSize
+	}
+
+	return result, nil
+}
+
+// reduce sends a reduce-only order against excess and waits for it to
+// close. It returns a nil order if the excess rounds below the minimum
+// size and errNoBook if a limit order has no price.
+func (f *Flattener) reduce(
+	ctx context.Context, market string, excess decimal.Decimal, deadline time.Time) (*models.Order, error) {
+
+	side := models.Sell
+	if excess.Sign() < 0 {
+		side = models.Buy
+	}
+
+	b := models.NewMarketOrder(market, side, excess.Abs())
+	if f.cfg.book != nil {
+		bid, ask, ok := f.cfg.book.Book(market)
+		if !ok {
+			return nil, errNoBook
+		}
+		one := decimal.NewFromInt(1)
+		price := bid.Mul(one.Sub(f.cfg.slippage))
+		if side == models.Buy {
+			price = ask.Mul(one.Add(f.cfg.slippage))
+		}
+		b = models.NewLimitOrder(market, side, price, excess.Abs()).IOC()
+	}
+
+	params, err := b.ReduceOnly().Order()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.cfg.normalizer != nil {
+		if err = f.cfg.normalizer.Order(params); err != nil {
+			if errors.Is(err, normalize.ErrBelowMinSize) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	order := &models.Order{}
+	if err = f.orders.PlaceOrder(params, order); err != nil {
+		return nil, err
+	}
+
+	for order.Status != models.Closed {
+
+		if time.Now().After(deadline) {
+			if _, err = f.orders.CancelOrder(order.ID); err != nil {
+				return order, err
+			}
+			return order, f.orders.GetOrderStatus(order.ID, order)
+		}
+
+		select {
+		case <-time.After(f.cfg.pollInterval):
+		case <-ctx.Done():
+			return order, ctx.Err()
+		}
+
+		if err = f.orders.GetOrderStatus(order.ID, order); err != nil {
+			return order, err
+		}
+	}
+
+	return order, nil
+}
+
+func sortedKeys(m map[string]decimal.Decimal) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ForSubAccounts returns flatteners for the main account and every
+// subaccount of client.
+func ForSubAccounts(client *api.Client, opts ...Option) ([]*Flattener, error) {
+
+	subAccounts, err := client.SubAccounts.GetSubaccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	main := client.Clone()
+	main.SubAccount = nil
+
+	result := []*Flattener{NewForClient(main, opts...)}
+	for _, s := range subAccounts {
+		if s != nil {
+			result = append(result, NewForClient(client.Clone(api.SetSubAccount(s.Nickname)), opts...))
+		}
+	}
+
+	return result, nil
+}
+
+// ReduceAll runs Reduce on every flattener concurrently. A zero fraction
+// flattens.
+func ReduceAll(ctx context.Context, flatteners []*Flattener, fraction decimal.Decimal) []Result {
+
+	results := make([]Result, len(flatteners))
+
+	wg := &sync.WaitGroup{}
+	for i, f := range flatteners {
+		wg.Add(1)
+		go func(i int, f *Flattener) {
+			defer wg.Done()
+			results[i] = f.Reduce(ctx, fraction)
+		}(i, f)
+	}
+	wg.Wait()
+
+	return results
+}
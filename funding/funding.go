@@ -0,0 +1,351 @@
+package funding
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const defaultConcurrency = 8
+
+// hoursPerYear annualizes hourly funding rates.
+var hoursPerYear = decimal.NewFromInt(24 * 365)
+
+// Futures is satisfied by *api.Futures.
+type Futures interface {
+	GetFutures() ([]*models.Future, error)
+	GetFutureStats(future string, stats *models.FutureStats) error
+	GetFundingRates(params *models.FundingRatesParams) ([]*models.FundingRates, error)
+}
+
+// Positions is satisfied by *api.Account.
+type Positions interface {
+	GetPositions() ([]*models.Position, error)
+}
+
+type Option func(a *Analyzer)
+
+// WithConcurrency bounds the stats requested at once when ranking the
+// perpetuals, 8 by default.
+func WithConcurrency(n int) Option {
+	return func(a *Analyzer) {
+		if n > 0 {
+			a.concurrency = n
+		}
+	}
+}
+
+// Analyzer reports the funding of perpetuals and of the account's
+// positions in them.
+type Analyzer struct {
+	futures     Futures
+	positions   Positions
+	concurrency int
+}
+
+// New builds an analyzer; positions may be nil if Estimate is not used.
+func New(futures Futures, positions Positions, opts ...Option) *Analyzer {
+	a := &Analyzer{futures: futures, positions: positions, concurrency: defaultConcurrency}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func NewForClient(client *api.Client, opts ...Option) *Analyzer {
+	return New(&client.Futures, &client.Account, opts...)
+}
+
+// History returns the funding rates of future in [start, end], oldest
+// first. It pages backwards from end, since the venue returns the most
+// recent rates of a range first.
+func (a *Analyzer) History(future string, start, end time.Time) ([]*models.FundingRates, error) {
+
+	seen := make(map[int64]struct{})
+	var result []*models.FundingRates
+
+	from, to := start.Unix(), end.Unix()
+	for to >= from {
+
+		page, err := a.futures.GetFundingRates(&models.FundingRatesParams{
+			Future: &future, StartTime: &from, EndTime: &to,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		added, oldest := 0, to
+		for _, r := range page {
+			if r == nil || r.Future != future {
+				continue
+			}
+			t := r.Time.Unix()
+			if _, ok := seen[t]; !ok {
+				seen[t] = struct{}{}
+				result = append(result, r)
+				added++
+			}
+			if t < oldest {
+				oldest = t
+			}
+		}
+
+		// The oldest second is fetched again in case the page split it
+		if added == 0 {
+			break
+		}
+		to = oldest
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+
+	return result, nil
+}
+
+// Realized is the funding of a future over the Window up to End. Mean is
+// the average hourly rate and Annualized that rate over a year; Total is
+// the sum of the rates paid. Positive rates are paid by longs.
+type Realized struct {
+	Future     string
+	Window     time.Duration
+	End        time.Time
+	Samples    int
+	Total      decimal.Decimal
+	Mean       decimal.Decimal
+	Annualized decimal.Decimal
+}
+
+// Rolling returns the realized funding of rates over each window up to
+// end. rates are those of a single future, as returned by History.
+func Rolling(rates []*models.FundingRates, end time.Time, windows ...time.Duration) []Realized {
+
+	result := make([]Realized, len(windows))
+	for i, window := range windows {
+
+		r := Realized{Window: window, End: end}
+		start := end.Add(-window)
+
+		for _, rate := range rates {
+			if rate == nil || !rate.Time.After(start) || rate.Time.After(end) {
+				continue
+			}
+			r.Future = rate.Future
+			r.Samples++
+			r.Total = r.Total.Add(decimal.NewFromFloat(rate.Rate))
+		}
+
+		if r.Samples > 0 {
+			r.Mean = r.Total.Div(decimal.NewFromInt(int64(r.Samples)))
+			r.Annualized = r.Mean.Mul(hoursPerYear)
+		}
+		result[i] = r
+	}
+
+	return result
+}
+
+// Carry is the predicted funding of a perpetual for the next hour. Side is
+// the side that receives it.
+type Carry struct {
+	Future       string
+	Underlying   string
+	Mark         decimal.Decimal
+	Rate         decimal.Decimal
+	Annualized   decimal.Decimal
+	Time         time.Time
+	Side         models.OrderSide
+	OpenInterest float64
+}
+
+// perpetuals returns the enabled perpetuals by name.
+func (a *Analyzer) perpetuals() (map[string]*models.Future, error) {
+
+	futures, err := a.futures.GetFutures()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*models.Future)
+	for _, f := range futures {
+		if f != nil && f.Perpetual && f.Enabled && !f.Expired {
+			result[f.Name] = f
+		}
+	}
+
+	return result, nil
+}
+
+// StatsError lists the futures whose stats failed to load, by name.
+type StatsError struct {
+	Errs map[string]error
+}
+
+func (e *StatsError) Error() string {
+	return fmt.Sprintf("stats of %d futures failed to load", len(e.Errs))
+}
+
+// carries loads the stats of every perpetual, concurrency at a time. The
+// carries that loaded are returned with a *StatsError for the others.
+func (a *Analyzer) carries(perpetuals map[string]*models.Future) (map[string]Carry, error) {
+
+	var (
+		mu     = &sync.Mutex{}
+		wg     = &sync.WaitGroup{}
+		tokens = make(chan struct{}, a.concurrency)
+		result = make(map[string]Carry, len(perpetuals))
+		errs   = make(map[string]error)
+	)
+
+	for _, f := range perpetuals {
+
+		wg.Add(1)
+		tokens <- struct{}{}
+
+		go func(f *models.Future) {
+
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			stats := &models.FutureStats{}
+			err := a.futures.GetFutureStats(f.Name, stats)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs[f.Name] = err
+				return
+			}
+
+			rate := decimal.NewFromFloat(stats.NextFundingRate)
+			c := Carry{
+				Future:       f.Name,
+				Underlying:   f.Underlying,
+				Mark:         f.Mark,
+				Rate:         rate,
+				Annualized:   rate.Mul(hoursPerYear),
+				Time:         stats.NextFundingTime,
+				Side:         models.Sell,
+				OpenInterest: stats.OpenInterest,
+			}
+			if rate.Sign() < 0 {
+				c.Side = models.Buy
+			}
+			result[f.Name] = c
+		}(f)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return result, &StatsError{Errs: errs}
+	}
+	return result, nil
+}
+
+// Rank returns the predicted carry of every perpetual, the largest in
+// absolute terms first. Perpetuals whose stats failed to load are left out
+// and listed in the *StatsError returned with the others.
+func (a *Analyzer) Rank() ([]Carry, error) {
+
+	perpetuals, err := a.perpetuals()
+	if err != nil {
+		return nil, err
+	}
+
+	carries, err := a.carries(perpetuals)
+
+	result := make([]Carry, 0, len(carries))
+	for _, c := range carries {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		x, y := result[i].Rate.Abs(), result[j].Rate.Abs()
+		if !x.Equal(y) {
+			return x.GreaterThan(y)
+		}
+		return result[i].Future < result[j].Future
+	})
+
+	return result, err
+}
+
+// Exposure is the predicted funding of a position. Payment is that of the
+// next hour, positive when paid and negative when received, and Annualized
+// that payment over a year.
+type Exposure struct {
+	Future     string
+	NetSize    decimal.Decimal
+	Notional   decimal.Decimal
+	Rate       decimal.Decimal
+	Payment    decimal.Decimal
+	Annualized decimal.Decimal
+}
+
+// Estimate returns the predicted funding of the account's perpetual
+// positions and their total for the next hour.
+func (a *Analyzer) Estimate() ([]Exposure, decimal.Decimal, error) {
+
+	positions, err := a.positions.GetPositions()
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	perpetuals, err := a.perpetuals()
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	held := make(map[string]*models.Future)
+	for _, p := range positions {
+		if p == nil || p.NetSize.Sign() == 0 {
+			continue
+		}
+		if f, ok := perpetuals[p.Future]; ok {
+			held[p.Future] = f
+		}
+	}
+
+	carries, err := a.carries(held)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	var (
+		result []Exposure
+		total  decimal.Decimal
+	)
+	for _, p := range positions {
+
+		if p == nil {
+			continue
+		}
+		c, ok := carries[p.Future]
+		if !ok {
+			continue
+		}
+
+		e := Exposure{
+			Future:   p.Future,
+			NetSize:  p.NetSize,
+			Notional: p.NetSize.Mul(c.Mark),
+			Rate:     c.Rate,
+		}
+		e.Payment = e.Notional.Mul(e.Rate)
+		e.Annualized = e.Payment.Mul(hoursPerYear)
+
+		total = total.Add(e.Payment)
+		result = append(result, e)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Future < result[j].Future })
+
+	return result, total, nil
+}
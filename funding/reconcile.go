@@ -0,0 +1,443 @@
+package funding
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/pnl"
+)
+
+var ErrNoPrice = errors.New("no index price")
+
+var (
+	defaultRelativeTolerance = decimal.NewFromFloat(0.01)
+	defaultAbsoluteTolerance = decimal.NewFromFloat(0.01)
+)
+
+// Index is satisfied by *api.Futures.
+type Index interface {
+	GetHistoricalIndex(indexName string, params *models.HistoricalIndexParams) ([]*models.HistoricalIndex, error)
+}
+
+// Prices returns the price a future's funding is charged on at an hour.
+type Prices interface {
+	Price(future string, hour time.Time) (decimal.Decimal, error)
+}
+
+// Sources are the endpoints a reconciler reads, see NewReconcilerForClient.
+type Sources struct {
+	Fills     pnl.FillHistory
+	Payments  pnl.FundingHistory
+	Positions Positions
+	Futures   Futures
+	Index     Index
+}
+
+type Issue string
+
+const (
+	Missing    = Issue("missing")
+	Duplicate  = Issue("duplicate")
+	Mismatch   = Issue("mismatch")
+	Unexpected = Issue("unexpected")
+	// NoPrice lines have no expected funding, the index price being
+	// unknown. Paid is still set.
+	NoPrice = Issue("no_price")
+)
+
+// Line is the funding of a future at an hour. Expected is NetSize * Price
+// * Rate, the published rate, and Paid the sum of the payments charged;
+// both are positive when paid. Issue is empty when they agree.
+type Line struct {
+	Hour     time.Time
+	NetSize  decimal.Decimal
+	Price    decimal.Decimal
+	Rate     decimal.Decimal
+	Expected decimal.Decimal
+	Paid     decimal.Decimal
+	Payments []*models.FundingPayment
+	Issue    Issue
+}
+
+type FutureReport struct {
+	Future   string
+	Expected decimal.Decimal
+	Paid     decimal.Decimal
+	Issues   int
+	Lines    []Line
+}
+
+// Reconciliation is the funding of a subaccount over [Start, End], ""
+// being the main account.
+type Reconciliation struct {
+	SubAccount string
+	Start      time.Time
+	End        time.Time
+	Issues     int
+	Futures    []FutureReport
+}
+
+type ReconcileOption func(r *Reconciler)
+
+// WithTolerance flags payments off by more than the larger of relative of
+// the expected payment and absolute. The defaults are 1% and 0.01.
+func WithTolerance(relative, absolute decimal.Decimal) ReconcileOption {
+	return func(r *Reconciler) {
+		r.relative, r.absolute = relative, absolute
+	}
+}
+
+// WithPrices replaces the index prices, e.g. with marks.
+func WithPrices(prices Prices) ReconcileOption {
+	return func(r *Reconciler) {
+		r.prices = prices
+	}
+}
+
+func WithSubAccount(nickname string) ReconcileOption {
+	return func(r *Reconciler) {
+		r.subAccount = nickname
+	}
+}
+
+// Reconciler recomputes every hourly funding payment from the position
+// held, rebuilt from the fills, the published rate and the index price.
+type Reconciler struct {
+	sources    Sources
+	subAccount string
+	relative   decimal.Decimal
+	absolute   decimal.Decimal
+	prices     Prices
+}
+
+func NewReconciler(sources Sources, opts ...ReconcileOption) *Reconciler {
+
+	r := &Reconciler{
+		sources:  sources,
+		relative: defaultRelativeTolerance,
+		absolute: defaultAbsoluteTolerance,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.prices == nil {
+		r.prices = NewIndexPrices(sources.Futures, sources.Index)
+	}
+
+	return r
+}
+
+func NewReconcilerForClient(client *api.Client, opts ...ReconcileOption) *Reconciler {
+
+	sources := Sources{
+		Fills:     &client.Fills,
+		Payments:  &client.Funding,
+		Positions: &client.Account,
+		Futures:   &client.Futures,
+		Index:     &client.Futures,
+	}
+	if client.SubAccount != nil {
+		opts = append([]ReconcileOption{WithSubAccount(*client.SubAccount)}, opts...)
+	}
+
+	return NewReconciler(sources, opts...)
+}
+
+// ReconcilersForSubAccounts returns a reconciler for the main account and
+// one for every subaccount.
+func ReconcilersForSubAccounts(client *api.Client, opts ...ReconcileOption) ([]*Reconciler, error) {
+
+	subAccounts, err := client.SubAccounts.GetSubaccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	main := client.Clone()
+	main.SubAccount = nil
+
+	result := []*Reconciler{NewReconcilerForClient(main, opts...)}
+	for _, s := range subAccounts {
+		if s != nil {
+			result = append(result, NewReconcilerForClient(client.Clone(api.SetSubAccount(s.Nickname)), opts...))
+		}
+	}
+
+	return result, nil
+}
+
+type hourKey struct {
+	future string
+	hour   int64
+}
+
+// Reconcile checks the funding of [start, end]. The positions are rebuilt
+// backwards from the current ones, so the fills up to now are loaded.
+func (r *Reconciler) Reconcile(start, end time.Time) (*Reconciliation, error) {
+
+	positions, err := r.sources.Positions.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	fills, err := pnl.FetchFills(r.sources.Fills, start, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := pnl.FetchPayments(r.sources.Payments, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]decimal.Decimal)
+	futures := make(map[string]bool)
+	for _, p := range positions {
+		if p != nil && p.NetSize.Sign() != 0 {
+			current[p.Future] = p.NetSize
+			futures[p.Future] = true
+		}
+	}
+
+	byFuture := make(map[string][]*models.Fill)
+	for _, f := range fills {
+		if f != nil && f.Future != "" {
+			byFuture[f.Future] = append(byFuture[f.Future], f)
+			futures[f.Future] = true
+		}
+	}
+
+	paid := make(map[hourKey][]*models.FundingPayment)
+	for _, p := range payments {
+		if p.Time.Before(start) || p.Time.After(end) {
+			continue
+		}
+		key := hourKey{p.Future, p.Time.Truncate(time.Hour).Unix()}
+		paid[key] = append(paid[key], p)
+		futures[p.Future] = true
+	}
+
+	names := make([]string, 0, len(futures))
+	for name := range futures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	history := New(r.sources.Futures, nil)
+	result := &Reconciliation{SubAccount: r.subAccount, Start: start, End: end}
+
+	for _, name := range names {
+
+		rates, err := history.History(name, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		report, err := r.future(name, rates, current[name], byFuture[name], paid)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Lines) == 0 {
+			continue
+		}
+
+		result.Issues += report.Issues
+		result.Futures = append(result.Futures, report)
+	}
+
+	return result, nil
+}
+
+// size returns the position held at hour from the current one, undoing the
+// fills made since.
+func size(current decimal.Decimal, fills []*models.Fill, hour time.Time) decimal.Decimal {
+	for _, f := range fills {
+		if f.Time.Before(hour) {
+			continue
+		}
+		if f.Side == string(models.Buy) {
+			current = current.Sub(f.Size)
+		} else {
+			current = current.Add(f.Size)
+		}
+	}
+	return current
+}
+
+func (r *Reconciler) future(
+	name string, rates []*models.FundingRates, current decimal.Decimal,
+	fills []*models.Fill, paid map[hourKey][]*models.FundingPayment) (FutureReport, error) {
+
+	report := FutureReport{Future: name}
+
+	for _, rate := range rates {
+
+		hour := rate.Time.Truncate(time.Hour)
+		key := hourKey{name, hour.Unix()}
+		charged := paid[key]
+		delete(paid, key)
+
+		line := Line{
+			Hour:     hour,
+			NetSize:  size(current, fills, hour),
+			Rate:     decimal.NewFromFloat(rate.Rate),
+			Payments: charged,
+		}
+		if line.NetSize.Sign() == 0 && len(charged) == 0 {
+			continue
+		}
+
+		if line.NetSize.Sign() != 0 {
+			price, err := r.prices.Price(name, hour)
+			if errors.Is(err, ErrNoPrice) {
+				for _, p := range charged {
+					line.Paid = line.Paid.Add(p.Payment)
+				}
+				line.Issue = NoPrice
+				report.add(line)
+				continue
+			}
+			if err != nil {
+				return report, err
+			}
+			line.Price = price
+			line.Expected = line.NetSize.Mul(price).Mul(line.Rate)
+		}
+
+		r.check(&line)
+		report.add(line)
+	}
+
+	// Payments at hours without a published rate
+	var orphans []hourKey
+	for key := range paid {
+		if key.future == name {
+			orphans = append(orphans, key)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].hour < orphans[j].hour })
+
+	for _, key := range orphans {
+		line := Line{Hour: time.Unix(key.hour, 0).UTC(), Payments: paid[key], Issue: Unexpected}
+		for _, p := range line.Payments {
+			line.Paid = line.Paid.Add(p.Payment)
+		}
+		report.add(line)
+	}
+
+	sort.SliceStable(report.Lines, func(i, j int) bool { return report.Lines[i].Hour.Before(report.Lines[j].Hour) })
+
+	return report, nil
+}
+
+func (r *Reconciler) check(line *Line) {
+
+	for _, p := range line.Payments {
+		line.Paid = line.Paid.Add(p.Payment)
+	}
+
+	tolerance := decimal.Max(r.absolute, line.Expected.Abs().Mul(r.relative))
+	off := line.Paid.Sub(line.Expected).Abs().GreaterThan(tolerance)
+
+	switch {
+	case len(line.Payments) > 1:
+		line.Issue = Duplicate
+	case len(line.Payments) == 0 && off:
+		line.Issue = Missing
+	case len(line.Payments) == 1 && line.NetSize.Sign() == 0:
+		line.Issue = Unexpected
+	case off:
+		line.Issue = Mismatch
+	}
+}
+
+func (f *FutureReport) add(line Line) {
+	f.Expected = f.Expected.Add(line.Expected)
+	f.Paid = f.Paid.Add(line.Paid)
+	if line.Issue != "" {
+		f.Issues++
+	}
+	f.Lines = append(f.Lines, line)
+}
+
+// IndexPrices prices funding at the average of the open and close of the
+// hourly index candle before the funding hour, approximating the venue's
+// time weighted index.
+type IndexPrices struct {
+	futures     Futures
+	index       Index
+	underlyings map[string]string
+	candles     map[string]map[int64]decimal.Decimal
+}
+
+func NewIndexPrices(futures Futures, index Index) *IndexPrices {
+	return &IndexPrices{futures: futures, index: index, candles: make(map[string]map[int64]decimal.Decimal)}
+}
+
+func (p *IndexPrices) underlying(future string) (string, error) {
+
+	if p.underlyings == nil {
+		list, err := p.futures.GetFutures()
+		if err != nil {
+			return "", err
+		}
+		p.underlyings = make(map[string]string, len(list))
+		for _, f := range list {
+			if f != nil {
+				p.underlyings[f.Name] = f.Underlying
+			}
+		}
+	}
+
+	underlying, ok := p.underlyings[future]
+	if !ok {
+		return "", errors.WithStack(ErrNoPrice)
+	}
+
+	return underlying, nil
+}
+
+// Price loads the hourly candles of the index around hour on first use.
+func (p *IndexPrices) Price(future string, hour time.Time) (decimal.Decimal, error) {
+
+	underlying, err := p.underlying(future)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	open := hour.Add(-time.Hour).Unix()
+
+	candles, ok := p.candles[underlying]
+	if !ok {
+		candles = make(map[int64]decimal.Decimal)
+		p.candles[underlying] = candles
+	}
+
+	if _, ok = candles[open]; !ok {
+		resolution := 3600
+		// A day of candles at a time
+		start, end := open, open+23*3600
+		page, err := p.index.GetHistoricalIndex(underlying, &models.HistoricalIndexParams{
+			Resolution: &resolution, StartTime: &start, EndTime: &end,
+		})
+		if err != nil {
+			return decimal.Zero, err
+		}
+		for _, c := range page {
+			if c != nil {
+				candles[c.StartTime.Unix()] = c.Open.Add(c.Close).Div(decimal.NewFromInt(2))
+			}
+		}
+	}
+
+	price, ok := candles[open]
+	if !ok {
+		return decimal.Zero, errors.WithStack(ErrNoPrice)
+	}
+
+	return price, nil
+}
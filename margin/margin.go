@@ -0,0 +1,283 @@
+package margin
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+var (
+	ErrUnknownFuture = errors.New("unknown future")
+	ErrNoMark        = errors.New("no mark price")
+)
+
+var (
+	// baseMaintenance is the venue's lowest maintenance margin fraction.
+	baseMaintenance = decimal.NewFromFloat(0.03)
+	// maintenanceWeight scales the size dependent part of the initial
+	// margin fraction into the maintenance one.
+	maintenanceWeight = decimal.NewFromFloat(0.6)
+	one               = decimal.NewFromInt(1)
+)
+
+// PositionMargin is the margin of one future. Liquidation is the mark at
+// which the account reaches its maintenance requirement with every other
+// mark unchanged, zero if there is none.
+type PositionMargin struct {
+	Market        string
+	NetSize       decimal.Decimal
+	Mark          decimal.Decimal
+	Notional      decimal.Decimal
+	InitialFactor decimal.Decimal
+	MaintFactor   decimal.Decimal
+	Initial       decimal.Decimal
+	Maintenance   decimal.Decimal
+	Liquidation   decimal.Decimal
+}
+
+// Report is the margin state of the account. Initial includes the
+// requirement of open orders, Maintenance only that of positions.
+type Report struct {
+	AccountValue   decimal.Decimal
+	Notional       decimal.Decimal
+	Initial        decimal.Decimal
+	Maintenance    decimal.Decimal
+	FreeCollateral decimal.Decimal
+	MarginFraction decimal.Decimal
+	Positions      []PositionMargin
+}
+
+// Liquidatable reports whether the account is below its maintenance
+// requirement.
+func (r *Report) Liquidatable() bool {
+	return r.Notional.Sign() > 0 && r.AccountValue.LessThan(r.Maintenance)
+}
+
+// Scenario is a what-if on top of the current account. Orders are taken as
+// filled at their price, or at the mark for market orders, paying the taker
+// fee. Shocks move the mark of every future of an underlying by a
+// fraction, e.g. -0.1 for -10%, before the orders fill.
+type Scenario struct {
+	Orders []*models.OrderParams
+	Shocks map[string]decimal.Decimal
+}
+
+type position struct {
+	net   decimal.Decimal
+	long  decimal.Decimal
+	short decimal.Decimal
+}
+
+// Calculator computes margin requirements like the venue: a position's
+// initial margin fraction is the larger of 1/leverage and
+// imfFactor * sqrt(size), its maintenance fraction the larger of 3% and
+// 0.6 * imfFactor * sqrt(size). Open orders count towards the initial
+// requirement at the larger of the long and short open size.
+type Calculator struct {
+	futures   map[string]*models.Future
+	account   models.AccountInformation
+	positions map[string]*position
+}
+
+// New builds a calculator from the futures and the account information,
+// whose positions are used.
+func New(futures []*models.Future, account *models.AccountInformation) *Calculator {
+
+	c := &Calculator{
+		futures:   make(map[string]*models.Future, len(futures)),
+		positions: make(map[string]*position),
+	}
+	for _, f := range futures {
+		if f != nil {
+			c.futures[f.Name] = f
+		}
+	}
+
+	if account != nil {
+		c.account = *account
+		for _, p := range account.Positions {
+			if p.NetSize.Sign() != 0 || p.LongOrderSize.Sign() != 0 || p.ShortOrderSize.Sign() != 0 {
+				c.positions[p.Future] = &position{
+					net: p.NetSize, long: p.LongOrderSize, short: p.ShortOrderSize,
+				}
+			}
+		}
+	}
+
+	return c
+}
+
+// NewFromClient loads the futures and the account information.
+func NewFromClient(client *api.Client) (*Calculator, error) {
+
+	futures, err := client.Futures.GetFutures()
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.AccountInformation{}
+	if err = client.Account.GetAccountInformation(account); err != nil {
+		return nil, err
+	}
+
+	return New(futures, account), nil
+}
+
+func (c *Calculator) baseInitial() decimal.Decimal {
+	if c.account.Leverage.Sign() > 0 {
+		return one.Div(c.account.Leverage)
+	}
+	return c.account.InitialMarginRequirement
+}
+
+// factors returns the initial and maintenance margin fractions of a
+// position of size in future f.
+func (c *Calculator) factors(f *models.Future, size decimal.Decimal) (initial, maint decimal.Decimal) {
+	abs, _ := size.Abs().Float64()
+	sized := decimal.NewFromFloat(f.ImfFactor * math.Sqrt(abs))
+	return decimal.Max(c.baseInitial(), sized), decimal.Max(baseMaintenance, sized.Mul(maintenanceWeight))
+}
+
+// Current reports the account as it is.
+func (c *Calculator) Current() Report {
+	report, _ := c.Evaluate(Scenario{})
+	return report
+}
+
+// After reports the account as if orders had filled.
+func (c *Calculator) After(orders ...*models.OrderParams) (Report, error) {
+	return c.Evaluate(Scenario{Orders: orders})
+}
+
+func (c *Calculator) Evaluate(s Scenario) (Report, error) {
+
+	report := Report{AccountValue: c.account.Collateral}
+
+	marks := make(map[string]decimal.Decimal, len(c.futures))
+	for name, f := range c.futures {
+		mark := f.Mark
+		if shock, ok := s.Shocks[f.Underlying]; ok {
+			mark = mark.Mul(one.Add(shock))
+		}
+		marks[name] = mark
+	}
+
+	positions := make(map[string]*position, len(c.positions)+len(s.Orders))
+	for market, p := range c.positions {
+		copied := *p
+		positions[market] = &copied
+		// Shocks revalue the positions held
+		if f, ok := c.futures[market]; ok {
+			report.AccountValue = report.AccountValue.Add(p.net.Mul(marks[market].Sub(f.Mark)))
+		}
+	}
+
+	for _, o := range s.Orders {
+
+		if o == nil {
+			return report, models.ErrNilPtr
+		}
+		if _, ok := c.futures[o.Market]; !ok {
+			return report, errors.WithStack(ErrUnknownFuture)
+		}
+
+		price := o.Price
+		if o.Type == models.MarketOrder || price.Sign() <= 0 {
+			price = marks[o.Market]
+		}
+
+		size := o.Size
+		if o.Side == models.Sell {
+			size = size.Neg()
+		}
+
+		p, ok := positions[o.Market]
+		if !ok {
+			p = &position{}
+			positions[o.Market] = p
+		}
+		p.net = p.net.Add(size)
+
+		fee := o.Size.Mul(price).Mul(c.account.TakerFee)
+		report.AccountValue = report.AccountValue.Add(size.Mul(marks[o.Market].Sub(price))).Sub(fee)
+	}
+
+	markets := make([]string, 0, len(positions))
+	for market := range positions {
+		markets = append(markets, market)
+	}
+	sort.Strings(markets)
+
+	for _, market := range markets {
+
+		p := positions[market]
+		f, ok := c.futures[market]
+		if !ok {
+			return report, errors.WithStack(ErrUnknownFuture)
+		}
+
+		mark := marks[market]
+		if mark.Sign() <= 0 {
+			return report, errors.WithStack(ErrNoMark)
+		}
+
+		open := decimal.Max(p.net.Add(p.long).Abs(), p.net.Sub(p.short).Abs())
+		initial, _ := c.factors(f, open)
+		initialFactor, maint := c.factors(f, p.net)
+
+		pm := PositionMargin{
+			Market:        market,
+			NetSize:       p.net,
+			Mark:          mark,
+			Notional:      p.net.Abs().Mul(mark),
+			InitialFactor: initialFactor,
+			MaintFactor:   maint,
+			Initial:       open.Mul(mark).Mul(initial),
+		}
+		pm.Maintenance = pm.Notional.Mul(maint)
+
+		report.Notional = report.Notional.Add(pm.Notional)
+		report.Initial = report.Initial.Add(pm.Initial)
+		report.Maintenance = report.Maintenance.Add(pm.Maintenance)
+		report.Positions = append(report.Positions, pm)
+	}
+
+	report.FreeCollateral = report.AccountValue.Sub(report.Initial)
+	if report.Notional.Sign() > 0 {
+		report.MarginFraction = report.AccountValue.Div(report.Notional)
+	}
+
+	for i := range report.Positions {
+		report.Positions[i].Liquidation = liquidation(&report, &report.Positions[i])
+	}
+
+	return report, nil
+}
+
+// liquidation solves value + n * (P - mark) = others + |n| * P * mmf for
+// the mark P of one position.
+func liquidation(r *Report, p *PositionMargin) decimal.Decimal {
+
+	n := p.NetSize
+	if n.Sign() == 0 {
+		return decimal.Zero
+	}
+
+	others := r.Maintenance.Sub(p.Maintenance)
+	denominator := n.Sub(n.Abs().Mul(p.MaintFactor))
+	if denominator.Sign() == 0 {
+		return decimal.Zero
+	}
+
+	price := others.Sub(r.AccountValue).Add(n.Mul(p.Mark)).Div(denominator)
+	if price.Sign() <= 0 {
+		return decimal.Zero
+	}
+
+	return price
+}
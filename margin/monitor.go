@@ -0,0 +1,376 @@
+package margin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/flatten"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const defaultMonitorInterval = 10 * time.Second
+
+type Action string
+
+const (
+	CancelOrders    = Action("cancel_orders")
+	TopUp           = Action("top_up")
+	ReducePositions = Action("reduce_positions")
+)
+
+// Tier trips when the margin fraction is less than Distance above the
+// maintenance fraction, e.g. 0.05 for five points, and then takes its
+// actions once.
+type Tier struct {
+	Name     string
+	Distance decimal.Decimal
+	Actions  []Action
+}
+
+// ActionResult records an action taken, or that would have been taken in
+// dry run mode.
+type ActionResult struct {
+	Action Action
+	DryRun bool
+	Detail string
+	Err    error
+}
+
+// Alert is emitted when a subaccount enters a tier, or when it is being
+// liquidated, which trips the last tier.
+type Alert struct {
+	SubAccount     string
+	Tier           Tier
+	Time           time.Time
+	MarginFraction decimal.Decimal
+	OpenFraction   decimal.Decimal
+	Maintenance    decimal.Decimal
+	Distance       decimal.Decimal
+	Liquidating    bool
+	Actions        []ActionResult
+}
+
+type topUp struct {
+	from string
+	coin string
+	size decimal.Decimal
+}
+
+type reduce struct {
+	fraction decimal.Decimal
+	count    int
+	opts     []flatten.Option
+}
+
+type MonitorOption func(m *Monitor)
+
+// WithSubAccounts monitors subaccounts, "" being the main account,
+// instead of the client's own account.
+func WithSubAccounts(nicknames ...string) MonitorOption {
+	return func(m *Monitor) {
+		m.subAccounts = append([]string(nil), nicknames...)
+	}
+}
+
+// WithTiers sets the tiers; they are ordered by Distance, the closest to
+// maintenance last.
+func WithTiers(tiers ...Tier) MonitorOption {
+	return func(m *Monitor) {
+		m.tiers = append([]Tier(nil), tiers...)
+	}
+}
+
+func WithInterval(interval time.Duration) MonitorOption {
+	return func(m *Monitor) {
+		m.interval = interval
+	}
+}
+
+// WithDryRun logs the actions of tripped tiers without taking them.
+func WithDryRun() MonitorOption {
+	return func(m *Monitor) {
+		m.dryRun = true
+	}
+}
+
+// WithTopUp sets the TopUp action to move size of coin in from the funding
+// subaccount, "" being the main account.
+func WithTopUp(from, coin string, size decimal.Decimal) MonitorOption {
+	return func(m *Monitor) {
+		m.topUp = &topUp{from: from, coin: coin, size: size}
+	}
+}
+
+// WithReduce sets the ReducePositions action to shrink the count largest
+// positions by notional to fraction of their size.
+func WithReduce(fraction decimal.Decimal, count int, opts ...flatten.Option) MonitorOption {
+	return func(m *Monitor) {
+		m.reduce = &reduce{fraction: fraction, count: count, opts: opts}
+	}
+}
+
+// Monitor polls the margin of subaccounts and de-risks them through the
+// actions of the tiers they enter. Every action is logged to the client's
+// logger.
+type Monitor struct {
+	client      *api.Client
+	subAccounts []string
+	clients     map[string]*api.Client
+	tiers       []Tier
+	interval    time.Duration
+	dryRun      bool
+	topUp       *topUp
+	reduce      *reduce
+	mu          *sync.Mutex
+	tripped     map[string]int
+}
+
+func NewMonitor(client *api.Client, opts ...MonitorOption) *Monitor {
+
+	m := &Monitor{
+		client:   client,
+		clients:  make(map[string]*api.Client),
+		interval: defaultMonitorInterval,
+		mu:       &sync.Mutex{},
+		tripped:  make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	sort.SliceStable(m.tiers, func(i, j int) bool {
+		return m.tiers[i].Distance.GreaterThan(m.tiers[j].Distance)
+	})
+
+	if m.subAccounts == nil {
+		nickname := ""
+		if client.SubAccount != nil {
+			nickname = *client.SubAccount
+		}
+		m.subAccounts = []string{nickname}
+	}
+	for _, nickname := range m.subAccounts {
+		c := client.Clone()
+		c.SubAccount = nil
+		if nickname != "" {
+			name := nickname
+			c.SubAccount = &name
+		}
+		m.clients[nickname] = c
+	}
+
+	return m
+}
+
+// tier returns the index of the closest tier tripped, -1 for none.
+func (m *Monitor) tier(info *models.AccountInformation) int {
+
+	if info.Liquidating {
+		return len(m.tiers) - 1
+	}
+
+	// No positions, nothing to maintain
+	if info.TotalPositionSize.Sign() == 0 || info.MarginFraction.Sign() == 0 {
+		return -1
+	}
+
+	distance := info.MarginFraction.Sub(info.MaintenanceMarginRequirement)
+
+	tripped := -1
+	for i, t := range m.tiers {
+		if distance.LessThan(t.Distance) {
+			tripped = i
+		}
+	}
+
+	return tripped
+}
+
+// Check polls every subaccount once and returns the alerts of those that
+// entered a closer tier. A subaccount re-arms once it is clear of every
+// tier. The error is the first failed poll; the other subaccounts are
+// still checked.
+func (m *Monitor) Check(ctx context.Context) ([]Alert, error) {
+
+	var (
+		alerts []Alert
+		first  error
+	)
+
+	for _, nickname := range m.subAccounts {
+
+		c := m.clients[nickname]
+
+		info := &models.AccountInformation{}
+		if err := c.Account.GetAccountInformation(info); err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+
+		tier := m.tier(info)
+
+		m.mu.Lock()
+		previous, ok := m.tripped[nickname]
+		if !ok {
+			previous = -1
+		}
+		m.tripped[nickname] = tier
+		m.mu.Unlock()
+
+		if tier < 0 || tier <= previous {
+			continue
+		}
+
+		alert := Alert{
+			SubAccount:     nickname,
+			Tier:           m.tiers[tier],
+			Time:           time.Now(),
+			MarginFraction: info.MarginFraction,
+			OpenFraction:   info.OpenMarginFraction,
+			Maintenance:    info.MaintenanceMarginRequirement,
+			Distance:       info.MarginFraction.Sub(info.MaintenanceMarginRequirement),
+			Liquidating:    info.Liquidating,
+		}
+
+		m.client.Logger.Debugf("margin %q entered tier %q: fraction %s, maintenance %s, liquidating %t",
+			nickname, alert.Tier.Name, alert.MarginFraction, alert.Maintenance, alert.Liquidating)
+
+		for _, action := range alert.Tier.Actions {
+			result := m.act(ctx, c, nickname, info, action)
+			m.client.Logger.Debugf("margin %q %s (dry run %t): %s %v",
+				nickname, result.Action, result.DryRun, result.Detail, result.Err)
+			alert.Actions = append(alert.Actions, result)
+		}
+
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, first
+}
+
+func (m *Monitor) act(
+	ctx context.Context, c *api.Client, nickname string,
+	info *models.AccountInformation, action Action) ActionResult {
+
+	result := ActionResult{Action: action, DryRun: m.dryRun}
+
+	switch action {
+
+	case CancelOrders:
+		result.Detail = "cancel every open order"
+		if !m.dryRun {
+			_, result.Err = c.Orders.CancelAllOrders(&models.CancelAllParams{})
+		}
+
+	case TopUp:
+		if m.topUp == nil || m.topUp.from == nickname {
+			result.Detail = "no funding subaccount"
+			return result
+		}
+		t := m.topUp
+		result.Detail = fmt.Sprintf("transfer %s %s from %q", t.size, t.coin, t.from)
+		if !m.dryRun {
+			payload := &models.TransferPayload{Coin: t.coin, Size: t.size}
+			if t.from != "" {
+				payload.Source = &t.from
+			}
+			if nickname != "" {
+				payload.Destination = &nickname
+			}
+			// Transfers are made by the main account
+			main := m.client.Clone()
+			main.SubAccount = nil
+			_, result.Err = main.SubAccounts.Transfer(payload)
+		}
+
+	case ReducePositions:
+		if m.reduce == nil {
+			result.Detail = "no reduction configured"
+			return result
+		}
+		markets := largest(info.Positions, m.reduce.count)
+		result.Detail = fmt.Sprintf("reduce %v to %s", markets, m.reduce.fraction)
+		if !m.dryRun && len(markets) > 0 {
+			opts := append(append([]flatten.Option(nil), m.reduce.opts...), flatten.WithMarkets(markets...))
+			result.Err = flatten.NewForClient(c, opts...).Reduce(ctx, m.reduce.fraction).Err
+		}
+
+	default:
+		result.Detail = "unknown action"
+	}
+
+	return result
+}
+
+// largest returns the futures of the count largest positions by notional.
+func largest(positions []models.Position, count int) []string {
+
+	open := make([]models.Position, 0, len(positions))
+	for _, p := range positions {
+		if p.NetSize.Sign() != 0 {
+			open = append(open, p)
+		}
+	}
+
+	sort.SliceStable(open, func(i, j int) bool {
+		return open[i].Cost.Abs().GreaterThan(open[j].Cost.Abs())
+	})
+
+	if count > 0 && count < len(open) {
+		open = open[:count]
+	}
+
+	result := make([]string, len(open))
+	for i, p := range open {
+		result[i] = p.Future
+	}
+
+	return result
+}
+
+// Run checks every interval until ctx is done. Failed polls are logged
+// and retried on the next tick. The channel is closed when Run returns.
+func (m *Monitor) Run(ctx context.Context) <-chan Alert {
+
+	alerts := make(chan Alert, 16)
+
+	go func() {
+
+		defer close(alerts)
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+
+			tripped, err := m.Check(ctx)
+			if err != nil {
+				m.client.Logger.Debugf("margin check: %+v", err)
+			}
+
+			for _, alert := range tripped {
+				select {
+				case alerts <- alert:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return alerts
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ClientIDSeparator ends the prefix of IDs from NewPrefixedClientIDs. The
+// decimal and UUID generators never produce it.
+const ClientIDSeparator = ":"
+
+// ClientOrderID is the client assigned order ID used to place, modify,
+// look up and cancel an order.
+type ClientOrderID string
+
+func (id ClientOrderID) String() string {
+	return string(id)
+}
+
+func (id ClientOrderID) Ptr() *ClientOrderID {
+	return &id
+}
+
+// Prefix returns the prefix set by NewPrefixedClientIDs, or "" for IDs
+// without one.
+func (id ClientOrderID) Prefix() string {
+	if i := strings.Index(string(id), ClientIDSeparator); i > 0 && i < len(id)-len(ClientIDSeparator) {
+		return string(id[:i])
+	}
+	return ""
+}
+
+type ClientIDGenerator interface {
+	Next() ClientOrderID
+}
+
+type ClientIDGeneratorFunc func() ClientOrderID
+
+func (f ClientIDGeneratorFunc) Next() ClientOrderID {
+	return f()
+}
+
+// MonotonicClientIDs generates increasing decimal IDs. It is safe for
+// concurrent use.
+type MonotonicClientIDs struct {
+	last uint64
+}
+
+// NewMonotonicClientIDs starts after start. Seed it from the clock or a
+// persisted value so IDs are not reused across restarts.
+func NewMonotonicClientIDs(start uint64) *MonotonicClientIDs {
+	return &MonotonicClientIDs{last: start}
+}
+
+func (g *MonotonicClientIDs) Next() ClientOrderID {
+	return ClientOrderID(strconv.FormatUint(atomic.AddUint64(&g.last, 1), 10))
+}
+
+type prefixedClientIDs struct {
+	prefix string
+	gen    ClientIDGenerator
+}
+
+// NewPrefixedClientIDs prefixes the IDs of gen, e.g. with a strategy name,
+// so orders can be attributed from their client ID alone: "mm" and 42 give
+// "mm:42". The prefix must not contain ClientIDSeparator. IDs were joined
+// with "-" before, which UUIDs contain as well; see ClientOrderID.Prefix.
+func NewPrefixedClientIDs(prefix string, gen ClientIDGenerator) ClientIDGenerator {
+	return &prefixedClientIDs{prefix: prefix, gen: gen}
+}
+
+func (g *prefixedClientIDs) Next() ClientOrderID {
+	return ClientOrderID(g.prefix + ClientIDSeparator + string(g.gen.Next()))
+}
+
+// NewRandomClientIDs generates random version 4 UUIDs.
+func NewRandomClientIDs() ClientIDGenerator {
+	return ClientIDGeneratorFunc(func() ClientOrderID {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return ClientOrderID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))
+	})
+}
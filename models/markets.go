@@ -19,6 +19,7 @@ type Market struct {
 	PostOnly       bool            `json:"postOnly"`
 	PriceIncrement decimal.Decimal `json:"priceIncrement"`
 	SizeIncrement  decimal.Decimal `json:"sizeIncrement"`
+	MinProvideSize decimal.Decimal `json:"minProvideSize"`
 	Restricted     bool            `json:"restricted"`
 }
 
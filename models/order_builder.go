@@ -0,0 +1,263 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrMissingMarket        = errors.New("market missing")
+	ErrInvalidOrderSide     = errors.New("invalid side")
+	ErrInvalidOrderSize     = errors.New("size must be positive")
+	ErrInvalidOrderPrice    = errors.New("price must be positive")
+	ErrInvalidTrailValue    = errors.New("trail value must be negative for sells and positive for buys")
+	ErrIOCPostOnly          = errors.New("ioc and post only cannot be combined")
+	ErrMarketPostOnly       = errors.New("market orders cannot be post only")
+	ErrTriggerModifier      = errors.New("trigger orders do not support ioc, post only or price band options")
+	ErrCancelLimitNoPrice   = errors.New("cancel limit on trigger requires a limit price")
+	ErrNotATriggerOrder     = errors.New("not a trigger order")
+	ErrNotARegularOrder     = errors.New("not a regular order")
+	ErrTrailingStopPrice    = errors.New("trailing stops cannot have a limit price")
+	ErrRejectAfterInThePast = errors.New("reject after time is in the past")
+)
+
+type orderKind int
+
+const (
+	limitKind orderKind = iota
+	marketKind
+	stopKind
+	takeProfitKind
+	trailingStopKind
+)
+
+// OrderBuilder builds OrderParams and TriggerOrderParams and refuses
+// combinations the venue would reject.
+//
+//	params, err := models.NewLimitOrder("BTC-PERP", models.Buy, price, size).PostOnly().Order()
+type OrderBuilder struct {
+	kind                 orderKind
+	market               string
+	side                 OrderSide
+	size                 decimal.Decimal
+	price                *decimal.Decimal
+	triggerPrice         decimal.Decimal
+	trailValue           decimal.Decimal
+	ioc                  bool
+	postOnly             bool
+	reduceOnly           bool
+	rejectOnPriceBand    bool
+	rejectAfter          *time.Time
+	retryUntilFilled     *bool
+	cancelLimitOnTrigger *bool
+	clientID             ClientOrderID
+}
+
+func NewLimitOrder(market string, side OrderSide, price, size decimal.Decimal) *OrderBuilder {
+	return &OrderBuilder{kind: limitKind, market: market, side: side, price: &price, size: size}
+}
+
+func NewMarketOrder(market string, side OrderSide, size decimal.Decimal) *OrderBuilder {
+	return &OrderBuilder{kind: marketKind, market: market, side: side, size: size}
+}
+
+func NewStopOrder(
+	market string, side OrderSide, triggerPrice, size decimal.Decimal) *OrderBuilder {
+	return &OrderBuilder{
+		kind: stopKind, market: market, side: side, triggerPrice: triggerPrice, size: size,
+	}
+}
+
+func NewTakeProfitOrder(
+	market string, side OrderSide, triggerPrice, size decimal.Decimal) *OrderBuilder {
+	return &OrderBuilder{
+		kind: takeProfitKind, market: market, side: side, triggerPrice: triggerPrice, size: size,
+	}
+}
+
+func NewTrailingStopOrder(
+	market string, side OrderSide, trailValue, size decimal.Decimal) *OrderBuilder {
+	return &OrderBuilder{
+		kind: trailingStopKind, market: market, side: side, trailValue: trailValue, size: size,
+	}
+}
+
+func (b *OrderBuilder) IOC() *OrderBuilder {
+	b.ioc = true
+	return b
+}
+
+func (b *OrderBuilder) PostOnly() *OrderBuilder {
+	b.postOnly = true
+	return b
+}
+
+func (b *OrderBuilder) ReduceOnly() *OrderBuilder {
+	b.reduceOnly = true
+	return b
+}
+
+func (b *OrderBuilder) RejectOnPriceBand() *OrderBuilder {
+	b.rejectOnPriceBand = true
+	return b
+}
+
+func (b *OrderBuilder) RejectAfter(t time.Time) *OrderBuilder {
+	b.rejectAfter = &t
+	return b
+}
+
+// LimitPrice sets the price of the limit order placed when a stop or
+// take profit order triggers.
+func (b *OrderBuilder) LimitPrice(price decimal.Decimal) *OrderBuilder {
+	b.price = &price
+	return b
+}
+
+func (b *OrderBuilder) RetryUntilFilled(retry bool) *OrderBuilder {
+	b.retryUntilFilled = &retry
+	return b
+}
+
+func (b *OrderBuilder) CancelLimitOnTrigger(cancel bool) *OrderBuilder {
+	b.cancelLimitOnTrigger = &cancel
+	return b
+}
+
+func (b *OrderBuilder) ClientID(id ClientOrderID) *OrderBuilder {
+	b.clientID = id
+	return b
+}
+
+func (b *OrderBuilder) IsTrigger() bool {
+	return b.kind >= stopKind
+}
+
+func (b *OrderBuilder) validate() error {
+
+	if b.market == "" {
+		return ErrMissingMarket
+	}
+	if b.side != Buy && b.side != Sell {
+		return ErrInvalidOrderSide
+	}
+	if b.size.Sign() <= 0 {
+		return ErrInvalidOrderSize
+	}
+	if b.price != nil && b.price.Sign() <= 0 {
+		return ErrInvalidOrderPrice
+	}
+
+	return nil
+}
+
+func (b *OrderBuilder) Order() (*OrderParams, error) {
+
+	if b.IsTrigger() {
+		return nil, ErrNotARegularOrder
+	}
+
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	if b.ioc && b.postOnly {
+		return nil, ErrIOCPostOnly
+	}
+
+	params := &OrderParams{
+		Market:            b.market,
+		Side:              b.side,
+		Size:              b.size,
+		ReduceOnly:        b.reduceOnly,
+		IOC:               b.ioc,
+		PostOnly:          b.postOnly,
+		ClientID:          b.clientID,
+		RejectOnPriceBand: b.rejectOnPriceBand,
+	}
+
+	switch b.kind {
+	case limitKind:
+		if b.price == nil {
+			return nil, ErrInvalidOrderPrice
+		}
+		params.Type, params.Price = LimitOrder, *b.price
+	case marketKind:
+		if b.postOnly {
+			return nil, ErrMarketPostOnly
+		}
+		params.Type = MarketOrder
+	}
+
+	if b.rejectAfter != nil {
+		if b.rejectAfter.Before(time.Now()) {
+			return nil, ErrRejectAfterInThePast
+		}
+		ms := b.rejectAfter.UnixNano() / int64(time.Millisecond)
+		params.RejectAfterTs = &ms
+	}
+
+	return params, nil
+}
+
+func (b *OrderBuilder) Trigger() (*TriggerOrderParams, error) {
+
+	if !b.IsTrigger() {
+		return nil, ErrNotATriggerOrder
+	}
+
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	if b.ioc || b.postOnly || b.rejectOnPriceBand || b.rejectAfter != nil {
+		return nil, ErrTriggerModifier
+	}
+
+	if b.cancelLimitOnTrigger != nil && *b.cancelLimitOnTrigger && b.price == nil {
+		return nil, ErrCancelLimitNoPrice
+	}
+
+	market, side, size, reduceOnly := b.market, b.side, b.size, b.reduceOnly
+
+	params := &TriggerOrderParams{
+		Market:               &market,
+		Side:                 &side,
+		Size:                 &size,
+		ReduceOnly:           &reduceOnly,
+		OrderPrice:           b.price,
+		RetryUntilFilled:     b.retryUntilFilled,
+		CancelLimitOnTrigger: b.cancelLimitOnTrigger,
+	}
+
+	var t TriggerOrderType
+
+	switch b.kind {
+	case stopKind, takeProfitKind:
+		if b.triggerPrice.Sign() <= 0 {
+			return nil, ErrInvalidOrderPrice
+		}
+		t = Stop
+		if b.kind == takeProfitKind {
+			t = TakeProfit
+		}
+		triggerPrice := b.triggerPrice
+		params.TriggerPrice = &triggerPrice
+	case trailingStopKind:
+		if b.price != nil {
+			return nil, ErrTrailingStopPrice
+		}
+		if (side == Sell && b.trailValue.Sign() >= 0) || (side == Buy && b.trailValue.Sign() <= 0) {
+			return nil, ErrInvalidTrailValue
+		}
+		t = TrailingStop
+		trailValue := b.trailValue
+		params.TrailValue = &trailValue
+	}
+
+	params.Type = &t
+
+	return params, nil
+}
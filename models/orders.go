@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -22,7 +23,7 @@ type Order struct {
 	IOC           bool            `json:"ioc"`
 	PostOnly      bool            `json:"postOnly"`
 	Future        string          `json:"future"`
-	ClientID      string          `json:"clientId"`
+	ClientID      ClientOrderID   `json:"clientId"`
 }
 
 type OrdersHistoryParams struct {
@@ -79,33 +80,53 @@ type TriggerOrdersHistoryParams struct {
 	OrderType *string `json:"orderType"`
 }
 
+// Price is sent as null for market orders. RejectAfterTs is in milliseconds.
 type OrderParams struct {
-	Market     string          `json:"market"`
-	Side       OrderSide       `json:"side"`
-	Price      decimal.Decimal `json:"price"`
-	Type       OrderType       `json:"type"`
-	Size       decimal.Decimal `json:"size"`
-	ReduceOnly bool            `json:"reduceOnly,omitempty"`
-	IOC        bool            `json:"ioc,omitempty"`
-	PostOnly   bool            `json:"postOnly,omitempty"`
-	ClientID   string          `json:"clientId,omitempty"`
+	Market            string          `json:"market"`
+	Side              OrderSide       `json:"side"`
+	Price             decimal.Decimal `json:"price"`
+	Type              OrderType       `json:"type"`
+	Size              decimal.Decimal `json:"size"`
+	ReduceOnly        bool            `json:"reduceOnly,omitempty"`
+	IOC               bool            `json:"ioc,omitempty"`
+	PostOnly          bool            `json:"postOnly,omitempty"`
+	ClientID          ClientOrderID   `json:"clientId,omitempty"`
+	RejectOnPriceBand bool            `json:"rejectOnPriceBand,omitempty"`
+	RejectAfterTs     *int64          `json:"rejectAfterTs,omitempty"`
+}
+
+func (p OrderParams) MarshalJSON() ([]byte, error) {
+
+	type orderParams OrderParams
+
+	var price *decimal.Decimal
+	if p.Type != MarketOrder {
+		price = &p.Price
+	}
+
+	return json.Marshal(&struct {
+		orderParams
+		Price *decimal.Decimal `json:"price"`
+	}{orderParams: orderParams(p), Price: price})
 }
 
 type TriggerOrderParams struct {
-	Market       *string          `json:"market"`
-	Side         *string          `json:"side"`
-	Size         *decimal.Decimal `json:"size"`
-	Type         *string          `json:"type"`
-	TriggerPrice *decimal.Decimal `json:"triggerPrice"`
-	OrderPrice   *decimal.Decimal `json:"orderPrice"`
-	ReduceOnly   *bool            `json:"reduceOnly,omitempty"`
-	TrailValue   *decimal.Decimal `json:"trailValue,omitempty"`
+	Market               *string           `json:"market"`
+	Side                 *OrderSide        `json:"side"`
+	Size                 *decimal.Decimal  `json:"size"`
+	Type                 *TriggerOrderType `json:"type"`
+	TriggerPrice         *decimal.Decimal  `json:"triggerPrice,omitempty"`
+	OrderPrice           *decimal.Decimal  `json:"orderPrice,omitempty"`
+	ReduceOnly           *bool             `json:"reduceOnly,omitempty"`
+	RetryUntilFilled     *bool             `json:"retryUntilFilled,omitempty"`
+	CancelLimitOnTrigger *bool             `json:"cancelLimitOnTrigger,omitempty"`
+	TrailValue           *decimal.Decimal  `json:"trailValue,omitempty"`
 }
 
 type ModifyOrderParams struct {
 	Price    *decimal.Decimal `json:"price,omitempty"`
 	Size     *decimal.Decimal `json:"size,omitempty"`
-	ClientID *string          `json:"clientId,omitempty"`
+	ClientID *ClientOrderID   `json:"clientId,omitempty"`
 }
 
 type ModifyTriggerOrderParams struct {
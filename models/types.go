@@ -137,7 +137,7 @@ func (f *FTXTime) UnmarshalJSON(data []byte) error {
 	}
 
 	sec, nsec := math.Modf(t)
-	f.Time = time.Unix(int64(sec), int64(nsec))
+	f.Time = time.Unix(int64(sec), int64(nsec*1e9))
 	return nil
 }
 
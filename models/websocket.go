@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -61,6 +62,11 @@ type WsResponse struct {
 	Data         json.RawMessage `json:"data"`
 }
 
+type RecordedWsResponse struct {
+	ReceivedAt time.Time  `json:"receivedAt"`
+	WsResponse WsResponse `json:"message"`
+}
+
 func (wr *WsResponse) MapToTradesResponse() (*TradesResponse, error) {
 	var trades []Trade
 	err := json.Unmarshal(wr.Data, &trades)
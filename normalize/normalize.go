@@ -0,0 +1,338 @@
+package normalize
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/registry"
+)
+
+type RoundingMode int
+
+const (
+	// RoundReject leaves values untouched and rejects them if off the grid.
+	RoundReject RoundingMode = iota
+	RoundNearest
+	RoundDown
+	RoundUp
+	// RoundPassive rounds prices away from the market (buys down, sells up)
+	// and sizes down.
+	RoundPassive
+)
+
+var (
+	ErrUnknownMarket    = errors.New("unknown market")
+	ErrMarketDisabled   = errors.New("market disabled")
+	ErrPostOnlyRequired = errors.New("market only accepts post only orders")
+	ErrInvalidSide      = errors.New("invalid side")
+	ErrInvalidPrice     = errors.New("invalid price")
+	ErrInvalidSize      = errors.New("invalid size")
+	ErrOffTick          = errors.New("price not a multiple of the tick size")
+	ErrOffLot           = errors.New("size not a multiple of the lot size")
+	ErrBelowMinSize     = errors.New("size below minimum")
+)
+
+type ValidationError struct {
+	Market string
+	Field  string
+	Value  decimal.Decimal
+	Reason error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s %v: %v", e.Market, e.Field, e.Value, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Reason
+}
+
+type Instruments interface {
+	Get(name string) (registry.Instrument, bool)
+}
+
+type Option func(n *Normalizer)
+
+func WithPriceRounding(mode RoundingMode) Option {
+	return func(n *Normalizer) {
+		n.priceMode = mode
+	}
+}
+
+func WithSizeRounding(mode RoundingMode) Option {
+	return func(n *Normalizer) {
+		n.sizeMode = mode
+	}
+}
+
+// Normalizer rounds order prices and sizes onto the market grid and
+// rejects orders the venue would reject, before they are sent.
+type Normalizer struct {
+	instruments Instruments
+	priceMode   RoundingMode
+	sizeMode    RoundingMode
+}
+
+func New(instruments Instruments, opts ...Option) *Normalizer {
+
+	n := &Normalizer{
+		instruments: instruments,
+		priceMode:   RoundPassive,
+		sizeMode:    RoundDown,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
+}
+
+func Round(value, increment decimal.Decimal, mode RoundingMode) decimal.Decimal {
+
+	if increment.Sign() <= 0 {
+		return value
+	}
+
+	q := value.Div(increment)
+
+	switch mode {
+	case RoundNearest:
+		q = q.Round(0)
+	case RoundDown:
+		q = q.Floor()
+	case RoundUp:
+		q = q.Ceil()
+	default:
+		return value
+	}
+
+	return q.Mul(increment)
+}
+
+func OnGrid(value, increment decimal.Decimal) bool {
+	if increment.Sign() <= 0 {
+		return true
+	}
+	return value.Mod(increment).IsZero()
+}
+
+func (n *Normalizer) instrument(market string) (registry.Instrument, error) {
+
+	inst, ok := n.instruments.Get(market)
+	if !ok {
+		return inst, &ValidationError{Market: market, Field: "market", Reason: ErrUnknownMarket}
+	}
+	if !inst.Enabled {
+		return inst, &ValidationError{Market: market, Field: "market", Reason: ErrMarketDisabled}
+	}
+
+	return inst, nil
+}
+
+func (n *Normalizer) priceRounding(side models.OrderSide) RoundingMode {
+	if n.priceMode != RoundPassive {
+		return n.priceMode
+	}
+	if side == models.Buy {
+		return RoundDown
+	}
+	return RoundUp
+}
+
+func (n *Normalizer) sizeRounding() RoundingMode {
+	if n.sizeMode == RoundPassive {
+		return RoundDown
+	}
+	return n.sizeMode
+}
+
+func (n *Normalizer) price(
+	inst *registry.Instrument, field string, side models.OrderSide, price *decimal.Decimal) error {
+
+	if price.Sign() <= 0 {
+		return &ValidationError{Market: inst.Name, Field: field, Value: *price, Reason: ErrInvalidPrice}
+	}
+
+	rounded := Round(*price, inst.TickSize, n.priceRounding(side))
+	if !OnGrid(rounded, inst.TickSize) {
+		return &ValidationError{Market: inst.Name, Field: field, Value: *price, Reason: ErrOffTick}
+	}
+	if rounded.Sign() <= 0 {
+		return &ValidationError{Market: inst.Name, Field: field, Value: *price, Reason: ErrInvalidPrice}
+	}
+
+	*price = rounded
+
+	return nil
+}
+
+// size rounds size onto the lot grid. The instrument's minimum size is the
+// venue's minimum for providing liquidity, so it only applies to orders
+// that may rest on the book; taker orders only need one lot.
+func (n *Normalizer) size(inst *registry.Instrument, size *decimal.Decimal, resting bool) error {
+
+	if size.Sign() <= 0 {
+		return &ValidationError{Market: inst.Name, Field: "size", Value: *size, Reason: ErrInvalidSize}
+	}
+
+	rounded := Round(*size, inst.LotSize, n.sizeRounding())
+	if !OnGrid(rounded, inst.LotSize) {
+		return &ValidationError{Market: inst.Name, Field: "size", Value: *size, Reason: ErrOffLot}
+	}
+	if (resting && rounded.LessThan(inst.MinSize)) || rounded.Sign() <= 0 {
+		return &ValidationError{Market: inst.Name, Field: "size", Value: *size, Reason: ErrBelowMinSize}
+	}
+
+	*size = rounded
+
+	return nil
+}
+
+func side(market string, s models.OrderSide) error {
+	if s != models.Buy && s != models.Sell {
+		return &ValidationError{Market: market, Field: "side", Reason: ErrInvalidSide}
+	}
+	return nil
+}
+
+// Order rounds the price and size of params in place. Market orders have
+// their price left alone.
+func (n *Normalizer) Order(params *models.OrderParams) error {
+
+	if params == nil {
+		return models.ErrNilPtr
+	}
+
+	inst, err := n.instrument(params.Market)
+	if err != nil {
+		return err
+	}
+
+	if err = side(inst.Name, params.Side); err != nil {
+		return err
+	}
+
+	if inst.PostOnly && !params.PostOnly {
+		return &ValidationError{Market: inst.Name, Field: "postOnly", Reason: ErrPostOnlyRequired}
+	}
+
+	if params.Type != models.MarketOrder {
+		if err = n.price(&inst, "price", params.Side, &params.Price); err != nil {
+			return err
+		}
+	}
+
+	resting := params.PostOnly || (params.Type != models.MarketOrder && !params.IOC)
+
+	return n.size(&inst, &params.Size, resting)
+}
+
+// Modify validates params for an order on market. The side is used for
+// passive price rounding.
+func (n *Normalizer) Modify(
+	market string, s models.OrderSide, params *models.ModifyOrderParams) error {
+
+	if params == nil {
+		return models.ErrNilPtr
+	}
+
+	inst, err := n.instrument(market)
+	if err != nil {
+		return err
+	}
+
+	if params.Price != nil {
+		if err = n.price(&inst, "price", s, params.Price); err != nil {
+			return err
+		}
+	}
+
+	if params.Size != nil {
+		if err = n.size(&inst, params.Size, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *Normalizer) Trigger(params *models.TriggerOrderParams) error {
+
+	if params == nil || params.Market == nil {
+		return models.ErrNilPtr
+	}
+
+	inst, err := n.instrument(*params.Market)
+	if err != nil {
+		return err
+	}
+
+	var s models.OrderSide
+	if params.Side != nil {
+		s = *params.Side
+	}
+	if err = side(inst.Name, s); err != nil {
+		return err
+	}
+
+	if params.TriggerPrice != nil {
+		if err = n.price(&inst, "triggerPrice", s, params.TriggerPrice); err != nil {
+			return err
+		}
+	}
+
+	if params.OrderPrice != nil {
+		if err = n.price(&inst, "orderPrice", s, params.OrderPrice); err != nil {
+			return err
+		}
+	}
+
+	if params.TrailValue != nil && !OnGrid(*params.TrailValue, inst.TickSize) {
+		return &ValidationError{
+			Market: inst.Name, Field: "trailValue", Value: *params.TrailValue, Reason: ErrOffTick,
+		}
+	}
+
+	if params.Size == nil {
+		return &ValidationError{Market: inst.Name, Field: "size", Reason: ErrInvalidSize}
+	}
+
+	// Triggered without an order price the order is a market order
+	return n.size(&inst, params.Size, params.OrderPrice != nil)
+}
+
+func (n *Normalizer) ModifyTrigger(
+	market string, s models.OrderSide, params *models.ModifyTriggerOrderParams) error {
+
+	if params == nil {
+		return models.ErrNilPtr
+	}
+
+	inst, err := n.instrument(market)
+	if err != nil {
+		return err
+	}
+
+	if params.TriggerPrice != nil {
+		if err = n.price(&inst, "triggerPrice", s, params.TriggerPrice); err != nil {
+			return err
+		}
+	}
+
+	if params.OrderPrice != nil {
+		if err = n.price(&inst, "orderPrice", s, params.OrderPrice); err != nil {
+			return err
+		}
+	}
+
+	if params.Size != nil {
+		if err = n.size(&inst, params.Size, params.OrderPrice != nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,556 @@
+package oms
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	defaultReconcileInterval = 30 * time.Second
+	defaultRetention         = time.Hour
+	defaultBufferSize        = 256
+)
+
+type State string
+
+const (
+	StateNew             = State("new")
+	StateOpen            = State("open")
+	StatePartiallyFilled = State("partially_filled")
+	StateFilled          = State("filled")
+	StateCancelled       = State("cancelled")
+)
+
+func (s State) IsTerminal() bool {
+	return s == StateFilled || s == StateCancelled
+}
+
+// Order is the locally tracked state of an order. FilledSize, RemainingSize
+// and AvgFillPrice include fills that arrived before the venue order update.
+type Order struct {
+	models.Order
+	State        State
+	UpdatedAt    time.Time
+	fills        map[int64]struct{}
+	fillSize     decimal.Decimal
+	fillNotional decimal.Decimal
+	venueFilled  decimal.Decimal
+	venueAvg     decimal.Decimal
+}
+
+type Update struct {
+	Order    Order
+	Previous State
+}
+
+// Filter matches orders on every non-empty field.
+type Filter struct {
+	Market   string
+	Side     models.OrderSide
+	ClientID models.ClientOrderID
+}
+
+func (f *Filter) Match(o *Order) bool {
+	return (f.Market == "" || f.Market == o.Market) &&
+		(f.Side == "" || f.Side == o.Side) &&
+		(f.ClientID == "" || f.ClientID == o.ClientID)
+}
+
+type Option func(m *Manager)
+
+func WithReconcileInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.reconcileInterval = interval
+	}
+}
+
+// WithRetention sets how long filled and cancelled orders, and fills of
+// orders never seen, are kept before Prune evicts them. One hour by
+// default.
+func WithRetention(retention time.Duration) Option {
+	return func(m *Manager) {
+		m.retention = retention
+	}
+}
+
+func WithStream(stream *api.Stream) Option {
+	return func(m *Manager) {
+		m.stream = stream
+	}
+}
+
+func WithBufferSize(size int) Option {
+	return func(m *Manager) {
+		m.bufferSize = size
+	}
+}
+
+type subscriber struct {
+	filter Filter
+	c      chan Update
+}
+
+// Manager tracks every order of the account. It is seeded and reconciled
+// over REST and kept current from the orders and fills channels.
+type Manager struct {
+	client            *api.Client
+	stream            *api.Stream
+	mu                *sync.RWMutex
+	orders            map[int64]*Order
+	clientIDs         map[models.ClientOrderID]int64
+	triggers          map[int64]models.TriggerOrder
+	pending           map[int64][]models.Fill
+	subscribers       map[int]*subscriber
+	nextSubscriber    int
+	dropped           int
+	reconcileInterval time.Duration
+	retention         time.Duration
+	bufferSize        int
+}
+
+// ReconcileError lists the tracked orders whose final state could not be
+// fetched; the other orders were reconciled.
+type ReconcileError struct {
+	Errors map[int64]error
+}
+
+func (e *ReconcileError) Error() string {
+	return fmt.Sprintf("%d orders could not be reconciled", len(e.Errors))
+}
+
+func New(client *api.Client, opts ...Option) *Manager {
+
+	m := &Manager{
+		client:            client,
+		mu:                &sync.RWMutex{},
+		orders:            make(map[int64]*Order),
+		clientIDs:         make(map[models.ClientOrderID]int64),
+		triggers:          make(map[int64]models.TriggerOrder),
+		pending:           make(map[int64][]models.Fill),
+		subscribers:       make(map[int]*subscriber),
+		reconcileInterval: defaultReconcileInterval,
+		retention:         defaultRetention,
+		bufferSize:        defaultBufferSize,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.stream == nil && client != nil {
+		m.stream = &client.Stream
+	}
+
+	return m
+}
+
+func state(o *models.Order) State {
+
+	switch {
+	case o.Status == models.Closed && o.FilledSize.Equal(o.Size):
+		return StateFilled
+	case o.Status == models.Closed:
+		return StateCancelled
+	case o.FilledSize.Sign() > 0:
+		return StatePartiallyFilled
+	case o.Status == models.Open:
+		return StateOpen
+	}
+
+	return StateNew
+}
+
+// ApplyOrder upserts an order update from the orders channel or REST.
+// Updates never move a closed order back to an open state.
+func (m *Manager) ApplyOrder(order *models.Order) {
+
+	if order == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.applyOrder(order, time.Now())
+}
+
+func (m *Manager) applyOrder(order *models.Order, now time.Time) {
+
+	tracked, ok := m.orders[order.ID]
+	previous := State("")
+
+	if ok {
+		previous = tracked.State
+		if previous.IsTerminal() && order.Status != models.Closed {
+			return
+		}
+		tracked.Order = *order
+	} else {
+		tracked = &Order{Order: *order, fills: make(map[int64]struct{})}
+		m.orders[order.ID] = tracked
+	}
+	tracked.venueFilled, tracked.venueAvg = order.FilledSize, order.AvgFillPrice
+
+	if order.ClientID != "" {
+		m.clientIDs[order.ClientID] = order.ID
+	}
+
+	for _, fill := range m.pending[order.ID] {
+		m.addFill(tracked, &fill)
+	}
+	delete(m.pending, order.ID)
+
+	m.settle(tracked, previous, now)
+}
+
+// ApplyFill applies a fill to its order. Fills for orders not yet seen are
+// held until the order arrives; duplicate fills are ignored.
+func (m *Manager) ApplyFill(fill *models.Fill) {
+
+	if fill == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tracked, ok := m.orders[fill.OrderID]
+	if !ok {
+		m.pending[fill.OrderID] = append(m.pending[fill.OrderID], *fill)
+		return
+	}
+
+	if tracked.State.IsTerminal() {
+		return
+	}
+
+	previous := tracked.State
+	if m.addFill(tracked, fill) {
+		m.settle(tracked, previous, time.Now())
+	}
+}
+
+func (m *Manager) addFill(tracked *Order, fill *models.Fill) bool {
+
+	if _, ok := tracked.fills[fill.ID]; ok {
+		return false
+	}
+	tracked.fills[fill.ID] = struct{}{}
+
+	tracked.fillSize = tracked.fillSize.Add(fill.Size)
+	tracked.fillNotional = tracked.fillNotional.Add(fill.Price.Mul(fill.Size))
+
+	return true
+}
+
+// settle derives the fill totals and state. Order updates and fills report
+// the same executions, so whichever source has seen more of them wins.
+func (m *Manager) settle(tracked *Order, previous State, now time.Time) {
+
+	tracked.FilledSize, tracked.AvgFillPrice = tracked.venueFilled, tracked.venueAvg
+	if tracked.fillSize.GreaterThan(tracked.venueFilled) {
+		tracked.FilledSize = tracked.fillSize
+		tracked.AvgFillPrice = tracked.fillNotional.Div(tracked.fillSize)
+	}
+
+	tracked.RemainingSize = decimal.Max(tracked.Size.Sub(tracked.FilledSize), decimal.Zero)
+	if tracked.Status == models.Closed {
+		tracked.RemainingSize = decimal.Zero
+	}
+
+	tracked.State = state(&tracked.Order)
+	if tracked.Status != models.Closed && tracked.Size.Sign() > 0 &&
+		tracked.FilledSize.GreaterThanOrEqual(tracked.Size) {
+		tracked.State = StateFilled
+	}
+	tracked.UpdatedAt = now
+
+	m.publish(Update{Order: *tracked, Previous: previous})
+}
+
+func (m *Manager) publish(update Update) {
+	for _, s := range m.subscribers {
+		if !s.filter.Match(&update.Order) {
+			continue
+		}
+		select {
+		case s.c <- update:
+		default:
+			m.dropped++
+		}
+	}
+}
+
+// Subscribe returns the updates of orders matching filter. Updates are
+// dropped, see Dropped, if the channel is not drained. Call cancel to
+// unsubscribe.
+func (m *Manager) Subscribe(filter Filter) (updates <-chan Update, cancel func()) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextSubscriber
+	m.nextSubscriber++
+
+	s := &subscriber{filter: filter, c: make(chan Update, m.bufferSize)}
+	m.subscribers[id] = s
+
+	return s.c, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.subscribers[id]; ok {
+			delete(m.subscribers, id)
+			close(s.c)
+		}
+	}
+}
+
+func (m *Manager) Dropped() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.dropped
+}
+
+func (m *Manager) Get(id int64) (Order, bool) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+
+	return *o, true
+}
+
+func (m *Manager) GetByClientID(clientID models.ClientOrderID) (Order, bool) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.clientIDs[clientID]
+	if !ok {
+		return Order{}, false
+	}
+
+	return *m.orders[id], true
+}
+
+// Orders returns the orders matching filter ordered by ID.
+func (m *Manager) Orders(filter Filter) []Order {
+	return m.orderList(func(o *Order) bool { return filter.Match(o) })
+}
+
+// Open returns the orders matching filter that are not filled or cancelled.
+func (m *Manager) Open(filter Filter) []Order {
+	return m.orderList(func(o *Order) bool { return !o.State.IsTerminal() && filter.Match(o) })
+}
+
+func (m *Manager) orderList(f func(o *Order) bool) []Order {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Order, 0)
+	for _, o := range m.orders {
+		if f(o) {
+			result = append(result, *o)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+// Triggers returns the open trigger orders of market, or of every market
+// if market is empty.
+func (m *Manager) Triggers(market string) []models.TriggerOrder {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]models.TriggerOrder, 0)
+	for _, t := range m.triggers {
+		if market == "" || t.Market == market {
+			result = append(result, t)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+// Prune evicts the orders filled or cancelled, and the held fills of
+// orders never seen, more than the retention before now. It returns the
+// number of orders evicted.
+func (m *Manager) Prune(now time.Time) int {
+
+	cutoff := now.Add(-m.retention)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	evicted := 0
+	for id, o := range m.orders {
+		if o.State.IsTerminal() && o.UpdatedAt.Before(cutoff) {
+			delete(m.orders, id)
+			if o.ClientID != "" && m.clientIDs[o.ClientID] == id {
+				delete(m.clientIDs, o.ClientID)
+			}
+			evicted++
+		}
+	}
+
+	for id, fills := range m.pending {
+		kept := fills[:0]
+		for _, f := range fills {
+			if !f.Time.Before(cutoff) {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.pending, id)
+		} else {
+			m.pending[id] = kept
+		}
+	}
+
+	return evicted
+}
+
+// Reconcile loads the open orders and trigger orders over REST. Tracked
+// orders that are no longer open are fetched individually so their final
+// state is recorded; those that fail are returned in a ReconcileError.
+func (m *Manager) Reconcile() error {
+
+	if m.client == nil {
+		return errors.New("Nil client")
+	}
+
+	open, err := m.client.Orders.GetOpenOrders("")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	triggers, err := m.client.Orders.GetOpenTriggerOrders(nil, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	now := time.Now()
+	seen := make(map[int64]struct{}, len(open))
+
+	m.mu.Lock()
+	for _, o := range open {
+		if o != nil {
+			seen[o.ID] = struct{}{}
+			m.applyOrder(o, now)
+		}
+	}
+	m.triggers = make(map[int64]models.TriggerOrder, len(triggers))
+	for _, t := range triggers {
+		if t != nil {
+			m.triggers[t.ID] = *t
+		}
+	}
+	missing := make([]int64, 0)
+	for id, o := range m.orders {
+		if _, ok := seen[id]; !ok && !o.State.IsTerminal() {
+			missing = append(missing, id)
+		}
+	}
+	m.mu.Unlock()
+
+	failed := make(map[int64]error)
+	for _, id := range missing {
+		order := &models.Order{}
+		if err = m.client.Orders.GetOrderStatus(id, order); err != nil {
+			failed[id] = errors.WithStack(err)
+			continue
+		}
+		m.ApplyOrder(order)
+	}
+
+	if len(failed) > 0 {
+		return &ReconcileError{Errors: failed}
+	}
+
+	return nil
+}
+
+// Run seeds the manager over REST, then follows the orders and fills
+// channels until ctx is done. Reconciling and pruning run on their own
+// schedule so a slow REST call does not hold up the channels.
+func (m *Manager) Run(ctx context.Context) error {
+
+	if m.stream == nil {
+		return errors.New("Nil stream")
+	}
+
+	if err := m.Reconcile(); err != nil {
+		return err
+	}
+
+	ordersC, err := m.stream.SubscribeToOrders(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fillsC, err := m.stream.SubscribeToFills(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	go func() {
+
+		ticker := time.NewTicker(m.reconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Reconcile(); err != nil {
+					m.client.Logger.Debugf("oms reconcile: %+v", err)
+				}
+				m.Prune(time.Now())
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case o, ok := <-ordersC:
+				if !ok {
+					return
+				}
+				if o != nil {
+					m.ApplyOrder(&o.Order)
+				}
+			case f, ok := <-fillsC:
+				if !ok {
+					return
+				}
+				if f != nil {
+					m.ApplyFill(&f.Fill)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
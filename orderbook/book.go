@@ -0,0 +1,143 @@
+package orderbook
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+type Level struct {
+	Price decimal.Decimal
+	Size  decimal.Decimal
+}
+
+// Book is the order book of one market, built from the partial and update
+// messages of the orderbook channel. Sides are named by the orders resting
+// on them: models.Buy for bids, kept best first i.e. descending, and
+// models.Sell for asks, ascending. A Book is not safe for concurrent use,
+// see Books.
+type Book struct {
+	Market string
+	Time   time.Time
+	bids   []Level
+	asks   []Level
+	synced bool
+}
+
+func NewBook(market string) *Book {
+	return &Book{Market: market}
+}
+
+func (b *Book) levels(side models.OrderSide) *[]Level {
+	if side == models.Buy {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+// better reports whether price a is better than b for orders on side.
+func better(side models.OrderSide, a, b decimal.Decimal) bool {
+	if side == models.Buy {
+		return a.GreaterThan(b)
+	}
+	return a.LessThan(b)
+}
+
+// Apply replaces the book on a partial and merges the levels of an update.
+// Updates before the first partial are ignored.
+func (b *Book) Apply(resp *models.OrderBookResponse) {
+
+	switch resp.ResponseType {
+	case models.Partial:
+		b.bids, b.asks, b.synced = b.bids[:0], b.asks[:0], true
+	case models.Update:
+		if !b.synced {
+			return
+		}
+	default:
+		return
+	}
+
+	for _, l := range resp.Bids {
+		if len(l) >= 2 {
+			b.Set(models.Buy, l[0], l[1])
+		}
+	}
+	for _, l := range resp.Asks {
+		if len(l) >= 2 {
+			b.Set(models.Sell, l[0], l[1])
+		}
+	}
+
+	b.Time = resp.Time.Time
+}
+
+// Set sets the size at a price level, removing the level for a zero size.
+func (b *Book) Set(side models.OrderSide, price, size decimal.Decimal) {
+
+	levels := b.levels(side)
+
+	i := sort.Search(len(*levels), func(i int) bool {
+		return !better(side, (*levels)[i].Price, price)
+	})
+
+	found := i < len(*levels) && (*levels)[i].Price.Equal(price)
+
+	switch {
+	case found && size.Sign() <= 0:
+		*levels = append((*levels)[:i], (*levels)[i+1:]...)
+	case found:
+		(*levels)[i].Size = size
+	case size.Sign() > 0:
+		*levels = append(*levels, Level{})
+		copy((*levels)[i+1:], (*levels)[i:])
+		(*levels)[i] = Level{Price: price, Size: size}
+	}
+}
+
+// Synced reports whether a partial has been applied.
+func (b *Book) Synced() bool {
+	return b.synced
+}
+
+func (b *Book) Best(side models.OrderSide) (Level, bool) {
+	levels := *b.levels(side)
+	if len(levels) == 0 {
+		return Level{}, false
+	}
+	return levels[0], true
+}
+
+func (b *Book) SizeAt(side models.OrderSide, price decimal.Decimal) decimal.Decimal {
+	for _, l := range *b.levels(side) {
+		if l.Price.Equal(price) {
+			return l.Size
+		}
+		if better(side, price, l.Price) {
+			break
+		}
+	}
+	return decimal.Zero
+}
+
+// Depth returns a copy of the best n levels of side, every level for n <= 0.
+func (b *Book) Depth(side models.OrderSide, n int) []Level {
+	levels := *b.levels(side)
+	if n > 0 && n < len(levels) {
+		levels = levels[:n]
+	}
+	return append([]Level(nil), levels...)
+}
+
+// Mid returns the mid price, or false if either side is empty.
+func (b *Book) Mid() (decimal.Decimal, bool) {
+	bid, okBid := b.Best(models.Buy)
+	ask, okAsk := b.Best(models.Sell)
+	if !okBid || !okAsk {
+		return decimal.Zero, false
+	}
+	return bid.Price.Add(ask.Price).Div(decimal.NewFromInt(2)), true
+}
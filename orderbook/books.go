@@ -0,0 +1,129 @@
+package orderbook
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+type Option func(b *Books)
+
+func WithStream(stream *api.Stream) Option {
+	return func(b *Books) {
+		b.stream = stream
+	}
+}
+
+// Books maintains the books of several markets for concurrent readers.
+type Books struct {
+	stream *api.Stream
+	mu     *sync.RWMutex
+	books  map[string]*Book
+}
+
+func New(opts ...Option) *Books {
+	b := &Books{mu: &sync.RWMutex{}, books: make(map[string]*Book)}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *Books) Apply(resp *models.OrderBookResponse) {
+
+	if resp == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	book, ok := b.books[resp.Symbol]
+	if !ok {
+		book = NewBook(resp.Symbol)
+		b.books[resp.Symbol] = book
+	}
+
+	book.Apply(resp)
+}
+
+// Subscribe maintains the books of markets from the stream set with
+// WithStream until ctx is done. The stream's book channel is consumed.
+func (b *Books) Subscribe(ctx context.Context, markets ...string) error {
+
+	if b.stream == nil {
+		return errors.New("Nil stream")
+	}
+
+	booksC, err := b.stream.SubscribeToOrderBooks(ctx, markets...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp, ok := <-booksC:
+				if !ok {
+					return
+				}
+				b.Apply(resp)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Book returns the best bid and ask. It is false until both sides of a
+// synced book are present.
+func (b *Books) Book(market string) (bid, ask decimal.Decimal, ok bool) {
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	book, found := b.books[market]
+	if !found || !book.Synced() {
+		return bid, ask, false
+	}
+
+	bestBid, okBid := book.Best(models.Buy)
+	bestAsk, okAsk := book.Best(models.Sell)
+
+	return bestBid.Price, bestAsk.Price, okBid && okAsk
+}
+
+func (b *Books) Mid(market string) (decimal.Decimal, bool) {
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	book, found := b.books[market]
+	if !found || !book.Synced() {
+		return decimal.Zero, false
+	}
+
+	return book.Mid()
+}
+
+// Snapshot returns a copy of the best depth levels of each side, every
+// level for depth <= 0.
+func (b *Books) Snapshot(market string, depth int) (bids, asks []Level, ok bool) {
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	book, found := b.books[market]
+	if !found || !book.Synced() {
+		return nil, nil, false
+	}
+
+	return book.Depth(models.Buy, depth), book.Depth(models.Sell, depth), true
+}
@@ -0,0 +1,185 @@
+package paper
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// position is a net position with its average entry price. Realized pnl
+// is booked when the position is reduced.
+type position struct {
+	net      decimal.Decimal
+	entry    decimal.Decimal
+	realized decimal.Decimal
+	buys     decimal.Decimal
+	sells    decimal.Decimal
+}
+
+// apply books a fill and returns the pnl it realized.
+func (p *position) apply(side models.OrderSide, size, price decimal.Decimal) decimal.Decimal {
+
+	qty := size
+	if side == models.Sell {
+		qty = size.Neg()
+		p.sells = p.sells.Add(size)
+	} else {
+		p.buys = p.buys.Add(size)
+	}
+
+	realized := decimal.Zero
+	if p.net.Sign() != 0 && p.net.Sign() != qty.Sign() {
+		closing := decimal.Min(size, p.net.Abs())
+		realized = closing.Mul(price.Sub(p.entry))
+		if p.net.Sign() < 0 {
+			realized = realized.Neg()
+		}
+	}
+
+	next := p.net.Add(qty)
+	switch {
+	case next.Sign() == 0:
+		p.entry = decimal.Zero
+	case p.net.Sign() == 0 || next.Sign() != p.net.Sign():
+		p.entry = price
+	case qty.Sign() == p.net.Sign():
+		p.entry = p.entry.Mul(p.net.Abs()).Add(price.Mul(size)).Div(next.Abs())
+	}
+
+	p.net = next
+	p.realized = p.realized.Add(realized)
+
+	return realized
+}
+
+func (e *Engine) initialFactor() decimal.Decimal {
+	return decimal.NewFromInt(1).Div(e.leverage)
+}
+
+func (e *Engine) positionView(market string, p *position) models.Position {
+
+	mark := e.mark(market, p)
+	size := p.net.Abs()
+
+	side := string(models.Buy)
+	if p.net.Sign() < 0 {
+		side = string(models.Sell)
+	}
+
+	long, short := decimal.Zero, decimal.Zero
+	for _, o := range e.resting[market] {
+		if o.Side == models.Buy {
+			long = long.Add(o.RemainingSize)
+		} else {
+			short = short.Add(o.RemainingSize)
+		}
+	}
+
+	return models.Position{
+		Cost:                         p.net.Mul(p.entry),
+		CumulativeBuySize:            p.buys,
+		CumulativeSellSize:           p.sells,
+		EntryPrice:                   p.entry,
+		Future:                       market,
+		InitialMarginRequirement:     e.initialFactor(),
+		LongOrderSize:                long,
+		MaintenanceMarginRequirement: maintenanceFactor,
+		NetSize:                      p.net,
+		OpenSize:                     size.Add(decimal.Max(long, short)),
+		RealizedPnl:                  p.realized,
+		RecentAverageOpenPrice:       p.entry,
+		RecentBreakEvenPrice:         p.entry,
+		ShortOrderSize:               short,
+		Side:                         side,
+		Size:                         size,
+		UnrealizedPnl:                p.net.Mul(mark.Sub(p.entry)),
+		CollateralUsed:               size.Mul(mark).Mul(e.initialFactor()),
+	}
+}
+
+func (e *Engine) positionViews() []models.Position {
+
+	markets := make([]string, 0, len(e.positions))
+	for m := range e.positions {
+		markets = append(markets, m)
+	}
+	sort.Strings(markets)
+
+	result := make([]models.Position, 0, len(markets))
+	for _, m := range markets {
+		result = append(result, e.positionView(m, e.positions[m]))
+	}
+
+	return result
+}
+
+// GetPositions returns a position for every market traded, flat ones
+// included, like Account.GetPositions.
+func (e *Engine) GetPositions() ([]*models.Position, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	views := e.positionViews()
+	result := make([]*models.Position, len(views))
+	for i := range views {
+		result[i] = &views[i]
+	}
+
+	return result, nil
+}
+
+// GetAccountInformation values positions at the book mid. Collateral is
+// the starting collateral plus realized pnl less fees.
+func (e *Engine) GetAccountInformation(result *models.AccountInformation) error {
+
+	if result == nil {
+		return models.ErrNilPtr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	positions := e.positionViews()
+
+	value, notional, used := e.collateral, decimal.Zero, decimal.Zero
+	for _, p := range positions {
+		value = value.Add(p.UnrealizedPnl)
+		used = used.Add(p.CollateralUsed)
+	}
+	for market, p := range e.positions {
+		notional = notional.Add(p.net.Abs().Mul(e.mark(market, p)))
+	}
+
+	// Only limit orders rest
+	for _, resting := range e.resting {
+		for _, o := range resting {
+			used = used.Add(o.RemainingSize.Mul(o.Price).Mul(e.initialFactor()))
+		}
+	}
+
+	marginFraction := decimal.Zero
+	if notional.Sign() > 0 {
+		marginFraction = value.Div(notional)
+	}
+
+	*result = models.AccountInformation{
+		Collateral:                   e.collateral,
+		FreeCollateral:               value.Sub(used),
+		InitialMarginRequirement:     e.initialFactor(),
+		MaintenanceMarginRequirement: maintenanceFactor,
+		MakerFee:                     e.makerFee,
+		MarginFraction:               marginFraction,
+		OpenMarginFraction:           marginFraction,
+		TakerFee:                     e.takerFee,
+		TotalAccountValue:            value,
+		TotalPositionSize:            notional,
+		Username:                     "paper",
+		Leverage:                     e.leverage,
+		Positions:                    positions,
+	}
+
+	return nil
+}
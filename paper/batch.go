@@ -0,0 +1,99 @@
+package paper
+
+import (
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// PlaceOrders places the orders in input order and returns one result per
+// order, like Orders.PlaceOrders. The engine is synchronous, so
+// api.WithConcurrency has no effect. With api.AllOrNothing the orders after
+// a failure are not attempted and the ones placed are cancelled.
+func (e *Engine) PlaceOrders(
+	params []*models.OrderParams, opts ...api.BatchOption) ([]api.PlaceResult, error) {
+
+	allOrNothing, results := api.IsAllOrNothing(opts...), make([]api.PlaceResult, len(params))
+
+	failed := false
+	for i := range params {
+		results[i].Params = params[i]
+		if failed && allOrNothing {
+			results[i].Err = api.ErrNotAttempted
+			continue
+		}
+		order := &models.Order{}
+		if err := e.PlaceOrder(params[i], order); err != nil {
+			results[i].Err, failed = err, true
+			continue
+		}
+		results[i].Order = order
+	}
+
+	if failed && allOrNothing {
+		e.rollback(results)
+	}
+
+	return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
+
+func (e *Engine) rollback(results []api.PlaceResult) {
+	for i := range results {
+		if results[i].Err != nil || results[i].Order == nil {
+			continue
+		}
+		id := results[i].Order.ID
+		if _, err := e.CancelOrder(id); err != nil {
+			results[i].Err = &api.RollbackError{OrderID: id, Err: err}
+			continue
+		}
+		results[i].Err = api.ErrRolledBack
+	}
+}
+
+// CancelOrders cancels the orders in input order, like Orders.CancelOrders.
+func (e *Engine) CancelOrders(ids []int64, opts ...api.BatchOption) ([]api.CancelResult, error) {
+
+	allOrNothing, results := api.IsAllOrNothing(opts...), make([]api.CancelResult, len(ids))
+
+	failed := false
+	for i := range ids {
+		results[i].OrderID = ids[i]
+		if failed && allOrNothing {
+			results[i].Err = api.ErrNotAttempted
+			continue
+		}
+		results[i].Result, results[i].Err = e.CancelOrder(ids[i])
+		failed = failed || results[i].Err != nil
+	}
+
+	return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
+
+// ModifyOrders modifies the orders in input order, like
+// Orders.ModifyOrders. AllOrNothing only stops further modifies.
+func (e *Engine) ModifyOrders(
+	requests []api.ModifyRequest, opts ...api.BatchOption) ([]api.ModifyResult, error) {
+
+	allOrNothing, results := api.IsAllOrNothing(opts...), make([]api.ModifyResult, len(requests))
+
+	failed := false
+	for i := range requests {
+		results[i].OrderID = requests[i].OrderID
+		if failed && allOrNothing {
+			results[i].Err = api.ErrNotAttempted
+			continue
+		}
+		if requests[i].Params == nil {
+			results[i].Err, failed = models.ErrNilPtr, true
+			continue
+		}
+		order := &models.Order{}
+		if err := e.ModifyOrder(requests[i].OrderID, requests[i].Params, order); err != nil {
+			results[i].Err, failed = err, true
+			continue
+		}
+		results[i].Order = order
+	}
+
+	return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
@@ -0,0 +1,31 @@
+package paper
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// better reports whether a is a better price than b for orders resting on
+// side.
+func better(side models.OrderSide, a, b decimal.Decimal) bool {
+	if side == models.Buy {
+		return a.GreaterThan(b)
+	}
+	return a.LessThan(b)
+}
+
+// crosses reports whether an order on side at limit can trade at price.
+func crosses(side models.OrderSide, limit, price decimal.Decimal) bool {
+	if side == models.Buy {
+		return price.LessThanOrEqual(limit)
+	}
+	return price.GreaterThanOrEqual(limit)
+}
+
+func opposite(side models.OrderSide) models.OrderSide {
+	if side == models.Buy {
+		return models.Sell
+	}
+	return models.Buy
+}
@@ -0,0 +1,645 @@
+package paper
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/orderbook"
+)
+
+const (
+	defaultBufferSize = 1024
+	orderCancelled    = "Order queued for cancellation"
+	ordersCancelled   = "Orders queued for cancellation"
+	triggerCancelled  = models.OrderStatus("cancelled")
+	triggerTriggered  = models.OrderStatus("triggered")
+)
+
+var (
+	defaultMakerFee   = decimal.RequireFromString("0.0002")
+	defaultTakerFee   = decimal.RequireFromString("0.0007")
+	defaultLeverage   = decimal.NewFromInt(10)
+	maintenanceFactor = decimal.RequireFromString("0.03")
+)
+
+// Rejections are venue errors so callers handle them as they would live,
+// e.g. api.IsNotFound works on errOrderNotFound.
+var (
+	errOrderNotFound = &api.APIError{StatusCode: http.StatusNotFound, Message: "Order not found"}
+	errOrderClosed   = &api.APIError{StatusCode: http.StatusBadRequest, Message: "Order already closed"}
+	errDuplicateID   = &api.APIError{StatusCode: http.StatusBadRequest, Message: "Duplicate client order ID"}
+	errNoLiquidity   = &api.APIError{StatusCode: http.StatusBadRequest, Message: "No order book for market"}
+	errReduceOnly    = &api.APIError{StatusCode: http.StatusBadRequest, Message: "Reduce-only order would increase position"}
+	errInvalidOrder  = &api.APIError{StatusCode: http.StatusBadRequest, Message: "Invalid order"}
+)
+
+type Option func(e *Engine)
+
+func WithFees(maker, taker decimal.Decimal) Option {
+	return func(e *Engine) {
+		e.makerFee, e.takerFee = maker, taker
+	}
+}
+
+// WithAccountInformation takes the fee rates, collateral and leverage of
+// an account, typically the live one the strategy will later trade.
+func WithAccountInformation(info *models.AccountInformation) Option {
+	return func(e *Engine) {
+		e.makerFee, e.takerFee = info.MakerFee, info.TakerFee
+		e.collateral = info.Collateral
+		if info.Leverage.Sign() > 0 {
+			e.leverage = info.Leverage
+		}
+	}
+}
+
+func WithCollateral(collateral decimal.Decimal) Option {
+	return func(e *Engine) {
+		e.collateral = collateral
+	}
+}
+
+func WithLeverage(leverage decimal.Decimal) Option {
+	return func(e *Engine) {
+		e.leverage = leverage
+	}
+}
+
+// WithStream sets the stream Subscribe reads books and trades from. A
+// replay stream from api.NewReplayStream runs the engine on a recorded
+// session.
+func WithStream(stream *api.Stream) Option {
+	return func(e *Engine) {
+		e.stream = stream
+	}
+}
+
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+func WithBufferSize(n int) Option {
+	return func(e *Engine) {
+		e.bufferSize = n
+	}
+}
+
+type order struct {
+	models.Order
+	notional decimal.Decimal
+	// queue is the size resting ahead of the order at its price
+	queue decimal.Decimal
+}
+
+type trigger struct {
+	models.TriggerOrder
+	child    *order
+	extreme  decimal.Decimal
+	triggers []models.Trigger
+}
+
+// Engine is a simulated venue. It has the method set of api.Orders and the
+// position queries of api.Account, so code written against interfaces such
+// as algo.Orders runs on it unchanged.
+//
+// Orders are matched against the books and trades fed to the engine: takers
+// walk the book depth, resting limit orders wait behind the size that was
+// at their price when they were placed, and a resting order is filled in
+// full when a trade prints through its price or the book crosses it. Fills
+// taken from the local book are removed from it until the next update for
+// that level.
+type Engine struct {
+	stream     *api.Stream
+	now        func() time.Time
+	makerFee   decimal.Decimal
+	takerFee   decimal.Decimal
+	collateral decimal.Decimal
+	leverage   decimal.Decimal
+	bufferSize int
+	mu         *sync.Mutex
+	books      map[string]*orderbook.Book
+	last       map[string]decimal.Decimal
+	orders     map[int64]*order
+	resting    map[string][]*order
+	triggers   map[int64]*trigger
+	positions  map[string]*position
+	nextID     int64
+	nextFillID int64
+	fillsC     chan *models.FillResponse
+	ordersC    chan *models.OrdersResponse
+	dropped    int
+}
+
+func New(opts ...Option) *Engine {
+
+	e := &Engine{
+		now:        time.Now,
+		makerFee:   defaultMakerFee,
+		takerFee:   defaultTakerFee,
+		leverage:   defaultLeverage,
+		bufferSize: defaultBufferSize,
+		mu:         &sync.Mutex{},
+		books:      make(map[string]*orderbook.Book),
+		last:       make(map[string]decimal.Decimal),
+		orders:     make(map[int64]*order),
+		resting:    make(map[string][]*order),
+		triggers:   make(map[int64]*trigger),
+		positions:  make(map[string]*position),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.fillsC = make(chan *models.FillResponse, e.bufferSize)
+	e.ordersC = make(chan *models.OrdersResponse, e.bufferSize)
+
+	return e
+}
+
+// NewFromAccount creates an engine with the fees, collateral and leverage
+// of the client's account.
+func NewFromAccount(client *api.Client, opts ...Option) (*Engine, error) {
+
+	info := &models.AccountInformation{}
+	if err := client.Account.GetAccountInformation(info); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return New(append([]Option{WithAccountInformation(info)}, opts...)...), nil
+}
+
+// SubscribeToFills returns the channel fills are published on, like
+// Stream.SubscribeToFills. Updates are dropped when the buffer is full.
+func (e *Engine) SubscribeToFills(ctx context.Context) (chan *models.FillResponse, error) {
+	return e.fillsC, nil
+}
+
+// SubscribeToOrders returns the channel order updates are published on,
+// like Stream.SubscribeToOrders.
+func (e *Engine) SubscribeToOrders(ctx context.Context) (chan *models.OrdersResponse, error) {
+	return e.ordersC, nil
+}
+
+func (e *Engine) Dropped() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// Subscribe feeds the engine with the books and trades of markets from
+// the stream set with WithStream until ctx is done. The stream channels are
+// consumed by the engine.
+func (e *Engine) Subscribe(ctx context.Context, markets ...string) error {
+
+	if e.stream == nil {
+		return errors.New("Nil stream")
+	}
+
+	booksC, err := e.stream.SubscribeToOrderBooks(ctx, markets...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tradesC, err := e.stream.SubscribeToTrades(ctx, markets...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	go func() {
+		for booksC != nil || tradesC != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case b, ok := <-booksC:
+				if !ok {
+					booksC = nil
+					continue
+				}
+				e.ApplyBook(b)
+			case t, ok := <-tradesC:
+				if !ok {
+					tradesC = nil
+					continue
+				}
+				e.ApplyTrade(t)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// ApplyBook updates the local book and fills resting orders the book has
+// crossed.
+func (e *Engine) ApplyBook(resp *models.OrderBookResponse) {
+
+	if resp == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, ok := e.books[resp.Symbol]
+	if !ok {
+		b = orderbook.NewBook(resp.Symbol)
+		e.books[resp.Symbol] = b
+	}
+	b.Apply(resp)
+
+	for _, o := range e.restingOrders(resp.Symbol) {
+
+		if o.Status == models.Closed {
+			continue
+		}
+
+		// Size leaving the level is assumed to be ahead of the order
+		ahead := b.SizeAt(o.Side, o.Price).Add(e.oursAhead(o))
+		if ahead.LessThan(o.queue) {
+			o.queue = ahead
+		}
+
+		if best, ok := b.Best(opposite(o.Side)); ok && crosses(o.Side, o.Price, best.Price) {
+			e.fillResting(o, o.RemainingSize)
+		}
+	}
+}
+
+// ApplyTrade fills resting orders the trade reached and fires triggers.
+func (e *Engine) ApplyTrade(resp *models.TradeResponse) {
+
+	if resp == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	market, price := resp.Symbol, resp.Price
+	e.last[market] = price
+
+	taker := models.OrderSide(resp.Side)
+	if taker == models.Buy || taker == models.Sell {
+
+		for _, o := range e.restingOrders(market) {
+
+			if o.Status == models.Closed || o.Side != opposite(taker) {
+				continue
+			}
+
+			switch {
+			case better(o.Side, o.Price, price):
+				// The trade printed through the order's price
+				e.fillResting(o, o.RemainingSize)
+			case o.Price.Equal(price):
+				available := resp.Size.Sub(o.queue)
+				o.queue = decimal.Max(o.queue.Sub(resp.Size), decimal.Zero)
+				if available.Sign() > 0 {
+					e.fillResting(o, decimal.Min(available, o.RemainingSize))
+				}
+			}
+		}
+	}
+
+	e.checkTriggers(market, price)
+}
+
+// restingOrders returns a copy of the market's resting orders, oldest
+// first, so that fills may close orders while iterating.
+func (e *Engine) restingOrders(market string) []*order {
+	return append([]*order(nil), e.resting[market]...)
+}
+
+// oursAhead returns the remaining size of our older orders resting at the
+// same price, which are not part of the book.
+func (e *Engine) oursAhead(o *order) decimal.Decimal {
+	ahead := decimal.Zero
+	for _, r := range e.resting[o.Market] {
+		if r.ID >= o.ID {
+			break
+		}
+		if r.Side == o.Side && r.Price.Equal(o.Price) {
+			ahead = ahead.Add(r.RemainingSize)
+		}
+	}
+	return ahead
+}
+
+func (e *Engine) position(market string) *position {
+	p, ok := e.positions[market]
+	if !ok {
+		p = &position{}
+		e.positions[market] = p
+	}
+	return p
+}
+
+// reduceCap returns how much of the order may still fill.
+func (e *Engine) reduceCap(o *order) decimal.Decimal {
+
+	if !o.ReduceOnly {
+		return o.RemainingSize
+	}
+
+	net := e.position(o.Market).net
+	if o.Side == models.Buy {
+		net = net.Neg()
+	}
+
+	return decimal.Max(decimal.Min(net, o.RemainingSize), decimal.Zero)
+}
+
+func (e *Engine) newID() int64 {
+	e.nextID++
+	return e.nextID
+}
+
+// submit matches a new order and rests what is left of it.
+func (e *Engine) submit(o *order) {
+
+	e.orders[o.ID] = o
+
+	b := e.books[o.Market]
+	if b == nil {
+		b = orderbook.NewBook(o.Market)
+	}
+
+	if best, ok := b.Best(opposite(o.Side)); ok &&
+		(o.Type == models.MarketOrder || crosses(o.Side, o.Price, best.Price)) {
+
+		if o.PostOnly {
+			e.close(o)
+			return
+		}
+
+		e.take(o, b)
+		if o.Status == models.Closed {
+			return
+		}
+	}
+
+	if o.Type == models.MarketOrder || o.IOC || e.reduceCap(o).Sign() <= 0 {
+		e.close(o)
+		return
+	}
+
+	o.Status = models.Open
+	o.queue = b.SizeAt(o.Side, o.Price).Add(e.oursAhead(o))
+	e.resting[o.Market] = append(e.resting[o.Market], o)
+	e.publishOrder(o)
+}
+
+// take fills the order against the opposite side of the book.
+func (e *Engine) take(o *order, b *orderbook.Book) {
+
+	side := opposite(o.Side)
+
+	for o.Status != models.Closed {
+
+		l, ok := b.Best(side)
+		if !ok || o.Type != models.MarketOrder && !crosses(o.Side, o.Price, l.Price) {
+			break
+		}
+
+		size := decimal.Min(e.reduceCap(o), l.Size)
+		if size.Sign() <= 0 {
+			break
+		}
+
+		b.Set(side, l.Price, l.Size.Sub(size))
+		e.fill(o, size, l.Price, models.Taker)
+	}
+}
+
+func (e *Engine) fillResting(o *order, size decimal.Decimal) {
+
+	size = decimal.Min(size, e.reduceCap(o))
+	if size.Sign() > 0 {
+		e.fill(o, size, o.Price, models.Maker)
+	}
+
+	if o.Status != models.Closed && e.reduceCap(o).Sign() <= 0 {
+		e.close(o)
+	}
+}
+
+func (e *Engine) fill(
+	o *order, size, price decimal.Decimal, liquidity models.LiquidityType) {
+
+	rate := e.takerFee
+	if liquidity == models.Maker {
+		rate = e.makerFee
+	}
+	fee := size.Mul(price).Mul(rate)
+
+	realized := e.position(o.Market).apply(o.Side, size, price)
+	e.collateral = e.collateral.Add(realized).Sub(fee)
+
+	o.FilledSize = o.FilledSize.Add(size)
+	o.notional = o.notional.Add(size.Mul(price))
+	o.AvgFillPrice = o.notional.Div(o.FilledSize)
+	o.RemainingSize = o.Size.Sub(o.FilledSize)
+
+	e.nextFillID++
+	feeFloat, _ := fee.Float64()
+	rateFloat, _ := rate.Float64()
+
+	fill := &models.FillResponse{
+		Fill: models.Fill{
+			Fee:         feeFloat,
+			FeeCurrency: "USD",
+			FeeRate:     rateFloat,
+			ID:          e.nextFillID,
+			Liquidity:   string(liquidity),
+			Market:      o.Market,
+			OrderID:     o.ID,
+			TradeID:     e.nextFillID,
+			Price:       price,
+			Side:        string(o.Side),
+			Size:        size,
+			Time:        e.now(),
+			Type:        "order",
+		},
+		BaseResponse: models.BaseResponse{ResponseType: models.Update, Symbol: o.Market},
+	}
+	select {
+	case e.fillsC <- fill:
+	default:
+		e.dropped++
+	}
+
+	if o.RemainingSize.Sign() <= 0 {
+		e.close(o)
+	} else {
+		e.publishOrder(o)
+	}
+
+	e.trimReduceOnly(o.Market)
+}
+
+// trimReduceOnly closes resting reduce-only orders the position no longer
+// allows to fill.
+func (e *Engine) trimReduceOnly(market string) {
+	for _, r := range e.restingOrders(market) {
+		if r.ReduceOnly && r.Status != models.Closed && e.reduceCap(r).Sign() <= 0 {
+			e.close(r)
+		}
+	}
+}
+
+func (e *Engine) close(o *order) {
+
+	if o.Status == models.Closed {
+		return
+	}
+
+	o.Status = models.Closed
+	o.RemainingSize = decimal.Zero
+
+	resting := e.resting[o.Market]
+	for i, r := range resting {
+		if r == o {
+			e.resting[o.Market] = append(resting[:i:i], resting[i+1:]...)
+			break
+		}
+	}
+
+	e.publishOrder(o)
+}
+
+func (e *Engine) publishOrder(o *order) {
+	update := &models.OrdersResponse{
+		Order:        o.Order,
+		BaseResponse: models.BaseResponse{ResponseType: models.Update, Symbol: o.Market},
+	}
+	select {
+	case e.ordersC <- update:
+	default:
+		e.dropped++
+	}
+}
+
+// checkTriggers fires the market's open trigger orders the price reached.
+func (e *Engine) checkTriggers(market string, price decimal.Decimal) {
+
+	ids := make([]int64, 0)
+	for id, t := range e.triggers {
+		if t.Market == market && t.Status == models.Open {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+
+		t := e.triggers[id]
+
+		if t.Type == models.TrailingStop {
+			if t.extreme.IsZero() || better(opposite(t.Side), price, t.extreme) {
+				t.extreme = price
+			}
+			t.TriggerPrice = t.extreme.Add(t.TrailValue)
+		}
+
+		var fire bool
+		switch {
+		case t.Type == models.TakeProfit && t.Side == models.Buy:
+			fire = price.LessThanOrEqual(t.TriggerPrice)
+		case t.Type == models.TakeProfit:
+			fire = price.GreaterThanOrEqual(t.TriggerPrice)
+		case t.Side == models.Buy:
+			fire = price.GreaterThanOrEqual(t.TriggerPrice)
+		default:
+			fire = price.LessThanOrEqual(t.TriggerPrice)
+		}
+
+		if fire {
+			e.fire(t)
+		}
+	}
+}
+
+func (e *Engine) fire(t *trigger) {
+
+	now := e.now()
+	t.Status, t.TriggeredAt = triggerTriggered, now
+
+	size, _ := t.Size.Float64()
+	record := models.Trigger{OrderSize: size, Time: now}
+
+	o := &order{Order: models.Order{
+		ID:            e.newID(),
+		Market:        t.Market,
+		Type:          t.OrderType,
+		Side:          t.Side,
+		Price:         t.OrderPrice,
+		Size:          t.Size,
+		RemainingSize: t.Size,
+		Status:        models.New,
+		CreatedAt:     now,
+		ReduceOnly:    t.ReduceOnly,
+	}}
+
+	switch {
+	case o.Type == models.MarketOrder && !e.hasLiquidity(o):
+		record.Error = errNoLiquidity.Message
+	case o.ReduceOnly && e.reduceCap(o).Sign() <= 0:
+		record.Error = errReduceOnly.Message
+	default:
+		record.OrderID = o.ID
+		t.child = o
+		e.submit(o)
+	}
+
+	t.triggers = append(t.triggers, record)
+}
+
+func (e *Engine) hasLiquidity(o *order) bool {
+	b, ok := e.books[o.Market]
+	if !ok {
+		return false
+	}
+	_, ok = b.Best(opposite(o.Side))
+	return ok
+}
+
+// mark is the price positions are valued at: the book mid, else the last
+// trade, else the entry price.
+func (e *Engine) mark(market string, p *position) decimal.Decimal {
+	if b, ok := e.books[market]; ok {
+		if mid, ok := b.Mid(); ok {
+			return mid
+		}
+	}
+	if last, ok := e.last[market]; ok {
+		return last
+	}
+	return p.entry
+}
+
+// Book returns the best bid and ask of the local book.
+func (e *Engine) Book(market string) (bid, ask decimal.Decimal, ok bool) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, found := e.books[market]
+	if !found {
+		return bid, ask, false
+	}
+
+	bestBid, okBid := b.Best(models.Buy)
+	bestAsk, okAsk := b.Best(models.Sell)
+
+	return bestBid.Price, bestAsk.Price, okBid && okAsk
+}
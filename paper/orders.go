@@ -0,0 +1,656 @@
+package paper
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+func validOrder(params *models.OrderParams) bool {
+	switch {
+	case params.Market == "" || params.Size.Sign() <= 0:
+		return false
+	case params.Side != models.Buy && params.Side != models.Sell:
+		return false
+	case params.Type == models.LimitOrder:
+		return params.Price.Sign() > 0
+	default:
+		return params.Type == models.MarketOrder
+	}
+}
+
+func (e *Engine) findByClientID(clientID models.ClientOrderID, openOnly bool) *order {
+	var found *order
+	for _, o := range e.orders {
+		if o.ClientID != clientID || (openOnly && o.Status == models.Closed) {
+			continue
+		}
+		if found == nil || o.ID > found.ID {
+			found = o
+		}
+	}
+	return found
+}
+
+func (e *Engine) placeOrder(params *models.OrderParams) (*order, error) {
+
+	if !validOrder(params) {
+		return nil, errors.WithStack(errInvalidOrder)
+	}
+
+	if params.ClientID != "" && e.findByClientID(params.ClientID, true) != nil {
+		return nil, errors.WithStack(errDuplicateID)
+	}
+
+	o := &order{Order: models.Order{
+		ID:            e.newID(),
+		Market:        params.Market,
+		Type:          params.Type,
+		Side:          params.Side,
+		Size:          params.Size,
+		RemainingSize: params.Size,
+		Status:        models.New,
+		CreatedAt:     e.now(),
+		ReduceOnly:    params.ReduceOnly,
+		IOC:           params.IOC,
+		PostOnly:      params.PostOnly,
+		ClientID:      params.ClientID,
+	}}
+	if params.Type == models.LimitOrder {
+		o.Price = params.Price
+	}
+
+	if o.Type == models.MarketOrder && !e.hasLiquidity(o) {
+		return nil, errors.WithStack(errNoLiquidity)
+	}
+	if o.ReduceOnly && e.reduceCap(o).Sign() <= 0 {
+		return nil, errors.WithStack(errReduceOnly)
+	}
+
+	e.submit(o)
+
+	return o, nil
+}
+
+func (e *Engine) PlaceOrder(params *models.OrderParams, order *models.Order) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, err := e.placeOrder(params)
+	if err != nil {
+		return err
+	}
+
+	*order = o.Order
+
+	return nil
+}
+
+// PlaceOrderOnce places params unless an order with its client ID exists.
+func (e *Engine) PlaceOrderOnce(
+	params *models.OrderParams, order *models.Order) (placed bool, err error) {
+
+	if params == nil || order == nil {
+		return false, models.ErrNilPtr
+	}
+
+	if params.ClientID == "" {
+		return false, api.ErrMissingClientID
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if o := e.findByClientID(params.ClientID, false); o != nil {
+		*order = o.Order
+		return false, nil
+	}
+
+	o, err := e.placeOrder(params)
+	if err != nil {
+		return false, err
+	}
+
+	*order = o.Order
+
+	return true, nil
+}
+
+func (e *Engine) GetOrderStatus(orderID int64, order *models.Order) error {
+
+	if order == nil {
+		return models.ErrNilPtr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return errors.WithStack(errOrderNotFound)
+	}
+
+	*order = o.Order
+
+	return nil
+}
+
+func (e *Engine) GetOrderStatusByClientID(
+	clientID models.ClientOrderID, order *models.Order) error {
+
+	if order == nil {
+		return models.ErrNilPtr
+	}
+
+	if clientID == "" {
+		return api.ErrMissingClientID
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o := e.findByClientID(clientID, false)
+	if o == nil {
+		return errors.WithStack(errOrderNotFound)
+	}
+
+	*order = o.Order
+
+	return nil
+}
+
+// GetOpenOrders returns the resting orders of market, or of every market
+// if it is empty.
+func (e *Engine) GetOpenOrders(market string) ([]*models.Order, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]*models.Order, 0)
+	for m, resting := range e.resting {
+		if market != "" && m != market {
+			continue
+		}
+		for _, o := range resting {
+			order := o.Order
+			result = append(result, &order)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+// GetOrdersHistory returns every order, newest first.
+func (e *Engine) GetOrdersHistory(params *models.OrdersHistoryParams) ([]*models.Order, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if params == nil {
+		params = &models.OrdersHistoryParams{}
+	}
+
+	result := make([]*models.Order, 0)
+	for _, o := range e.orders {
+		if params.Market != nil && o.Market != *params.Market {
+			continue
+		}
+		if !inRange(o.CreatedAt, params.StartTime, params.EndTime) {
+			continue
+		}
+		order := o.Order
+		result = append(result, &order)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+
+	if params.Limit != nil && *params.Limit >= 0 && len(result) > *params.Limit {
+		result = result[:*params.Limit]
+	}
+
+	return result, nil
+}
+
+func inRange(t time.Time, start, end *int64) bool {
+	if start != nil && t.Unix() < *start {
+		return false
+	}
+	return end == nil || t.Unix() <= *end
+}
+
+// ModifyOrder cancels the order and places a replacement with a new ID,
+// like the venue, so the replacement loses its queue position. Size is the
+// size of the replacement and defaults to the remaining size.
+func (e *Engine) ModifyOrder(
+	orderID int64,
+	params *models.ModifyOrderParams,
+	order *models.Order) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return errors.WithStack(errOrderNotFound)
+	}
+
+	return e.modify(o, params, order)
+}
+
+func (e *Engine) ModifyOrderByClientID(
+	clientID models.ClientOrderID, params *models.ModifyOrderParams, order *models.Order,
+) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	if clientID == "" {
+		return api.ErrMissingClientID
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o := e.findByClientID(clientID, false)
+	if o == nil {
+		return errors.WithStack(errOrderNotFound)
+	}
+
+	return e.modify(o, params, order)
+}
+
+func (e *Engine) modify(o *order, params *models.ModifyOrderParams, order *models.Order) error {
+
+	if o.Status == models.Closed {
+		return errors.WithStack(errOrderClosed)
+	}
+
+	replacement := models.OrderParams{
+		Market:     o.Market,
+		Side:       o.Side,
+		Price:      o.Price,
+		Type:       o.Type,
+		Size:       o.RemainingSize,
+		ReduceOnly: o.ReduceOnly,
+		IOC:        o.IOC,
+		PostOnly:   o.PostOnly,
+		ClientID:   o.ClientID,
+	}
+	if params.Price != nil {
+		replacement.Price = *params.Price
+	}
+	if params.Size != nil {
+		replacement.Size = *params.Size
+	}
+	if params.ClientID != nil {
+		replacement.ClientID = *params.ClientID
+	}
+
+	if !validOrder(&replacement) {
+		return errors.WithStack(errInvalidOrder)
+	}
+
+	e.close(o)
+
+	placed, err := e.placeOrder(&replacement)
+	if err != nil {
+		return err
+	}
+
+	*order = placed.Order
+
+	return nil
+}
+
+func (e *Engine) CancelOrder(orderID int64) (string, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return "", errors.WithStack(errOrderNotFound)
+	}
+	if o.Status == models.Closed {
+		return "", errors.WithStack(errOrderClosed)
+	}
+
+	e.close(o)
+
+	return orderCancelled, nil
+}
+
+func (e *Engine) CancelOrderByClientID(clientID models.ClientOrderID) (string, error) {
+
+	if clientID == "" {
+		return "", api.ErrMissingClientID
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o := e.findByClientID(clientID, true)
+	if o == nil {
+		return "", errors.WithStack(errOrderNotFound)
+	}
+
+	e.close(o)
+
+	return orderCancelled, nil
+}
+
+func (e *Engine) CancelAllOrders(params *models.CancelAllParams) (string, error) {
+
+	if params == nil {
+		params = &models.CancelAllParams{}
+	}
+
+	match := func(market string, side models.OrderSide) bool {
+		return (params.Market == nil || *params.Market == market) &&
+			(params.Side == nil || *params.Side == string(side))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if params.ConditionalOrdersOnly == nil || !*params.ConditionalOrdersOnly {
+		for _, resting := range e.resting {
+			for _, o := range append([]*order(nil), resting...) {
+				if match(o.Market, o.Side) {
+					e.close(o)
+				}
+			}
+		}
+	}
+
+	if params.LimitOrdersOnly == nil || !*params.LimitOrdersOnly {
+		for _, t := range e.triggers {
+			if t.Status == models.Open && match(t.Market, t.Side) {
+				t.Status = triggerCancelled
+			}
+		}
+	}
+
+	return ordersCancelled, nil
+}
+
+func validTrigger(params *models.TriggerOrderParams) bool {
+
+	if params.Market == nil || *params.Market == "" || params.Side == nil ||
+		params.Size == nil || params.Size.Sign() <= 0 || params.Type == nil {
+		return false
+	}
+
+	side := *params.Side
+	if side != models.Buy && side != models.Sell {
+		return false
+	}
+
+	switch *params.Type {
+	case models.Stop, models.TakeProfit:
+		return params.TriggerPrice != nil && params.TriggerPrice.Sign() > 0
+	case models.TrailingStop:
+		// The trail is below the market for sells and above it for buys
+		return params.TrailValue != nil &&
+			((side == models.Sell && params.TrailValue.Sign() < 0) ||
+				(side == models.Buy && params.TrailValue.Sign() > 0))
+	}
+
+	return false
+}
+
+func (e *Engine) placeTrigger(params *models.TriggerOrderParams) (*trigger, error) {
+
+	if !validTrigger(params) {
+		return nil, errors.WithStack(errInvalidOrder)
+	}
+
+	t := &trigger{TriggerOrder: models.TriggerOrder{
+		ID:        e.newID(),
+		Market:    *params.Market,
+		CreatedAt: e.now(),
+		Side:      *params.Side,
+		Size:      *params.Size,
+		Status:    models.Open,
+		Type:      *params.Type,
+		OrderType: models.MarketOrder,
+	}}
+	if params.TriggerPrice != nil {
+		t.TriggerPrice = *params.TriggerPrice
+	}
+	if params.OrderPrice != nil && params.OrderPrice.Sign() > 0 {
+		t.OrderPrice, t.OrderType = *params.OrderPrice, models.LimitOrder
+	}
+	if params.TrailValue != nil {
+		t.TrailValue = *params.TrailValue
+	}
+	if params.ReduceOnly != nil {
+		t.ReduceOnly = *params.ReduceOnly
+	}
+	if params.RetryUntilFilled != nil {
+		t.RetryUntilFilled = *params.RetryUntilFilled
+	}
+
+	if t.Type == models.TrailingStop {
+		if last, ok := e.last[t.Market]; ok {
+			t.extreme = last
+			t.TriggerPrice = last.Add(t.TrailValue)
+		}
+	}
+
+	e.triggers[t.ID] = t
+
+	return t, nil
+}
+
+// view returns the trigger order with the fills of the order it
+// placed.
+func (t *trigger) view() models.TriggerOrder {
+	view := t.TriggerOrder
+	if t.child != nil {
+		view.OrderID = t.child.ID
+		view.FilledSize = t.child.FilledSize
+		view.AvgFillPrice = t.child.AvgFillPrice
+		view.OrderStatus = string(t.child.Status)
+	}
+	return view
+}
+
+// PlaceTriggerOrder places a stop, take profit or trailing stop that fires
+// on trade prices. Triggered orders are market orders unless OrderPrice is
+// set.
+func (e *Engine) PlaceTriggerOrder(
+	params *models.TriggerOrderParams, order *models.TriggerOrder) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, err := e.placeTrigger(params)
+	if err != nil {
+		return err
+	}
+
+	*order = t.view()
+
+	return nil
+}
+
+// ModifyTriggerOrder cancels the trigger order and places a replacement
+// with a new ID, like the venue.
+func (e *Engine) ModifyTriggerOrder(
+	orderID int64,
+	params *models.ModifyTriggerOrderParams,
+	order *models.TriggerOrder) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, ok := e.triggers[orderID]
+	if !ok {
+		return errors.WithStack(errOrderNotFound)
+	}
+	if t.Status != models.Open {
+		return errors.WithStack(errOrderClosed)
+	}
+
+	replacement := models.TriggerOrderParams{
+		Market:           &t.Market,
+		Side:             &t.Side,
+		Size:             &t.Size,
+		Type:             &t.Type,
+		TriggerPrice:     &t.TriggerPrice,
+		ReduceOnly:       &t.ReduceOnly,
+		RetryUntilFilled: &t.RetryUntilFilled,
+		TrailValue:       &t.TrailValue,
+	}
+	if t.OrderType == models.LimitOrder {
+		replacement.OrderPrice = &t.OrderPrice
+	}
+	if params.Size != nil {
+		replacement.Size = params.Size
+	}
+	if params.TriggerPrice != nil {
+		replacement.TriggerPrice = params.TriggerPrice
+	}
+	if params.OrderPrice != nil {
+		replacement.OrderPrice = params.OrderPrice
+	}
+	if params.TrailValue != nil {
+		replacement.TrailValue = params.TrailValue
+	}
+
+	if !validTrigger(&replacement) {
+		return errors.WithStack(errInvalidOrder)
+	}
+
+	t.Status = triggerCancelled
+
+	placed, err := e.placeTrigger(&replacement)
+	if err != nil {
+		return err
+	}
+
+	*order = placed.view()
+
+	return nil
+}
+
+func (e *Engine) CancelTriggerOrder(orderID int64) (string, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, ok := e.triggers[orderID]
+	if !ok {
+		return "", errors.WithStack(errOrderNotFound)
+	}
+	if t.Status != models.Open {
+		return "", errors.WithStack(errOrderClosed)
+	}
+
+	t.Status = triggerCancelled
+
+	return orderCancelled, nil
+}
+
+// GetTriggerOrderTriggers returns the orders placed when the trigger fired,
+// with their current fills.
+func (e *Engine) GetTriggerOrderTriggers(orderID int64) ([]*models.Trigger, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t, ok := e.triggers[orderID]
+	if !ok {
+		return nil, errors.WithStack(errOrderNotFound)
+	}
+
+	result := make([]*models.Trigger, len(t.triggers))
+	for i := range t.triggers {
+		record := t.triggers[i]
+		if child, ok := e.orders[record.OrderID]; ok {
+			record.FilledSize, _ = child.FilledSize.Float64()
+		}
+		result[i] = &record
+	}
+
+	return result, nil
+}
+
+func (e *Engine) GetOpenTriggerOrders(
+	market *string, triggerType *models.TriggerOrderType) ([]*models.TriggerOrder, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.triggerViews(func(t *trigger) bool {
+		return t.Status == models.Open &&
+			(market == nil || *market == t.Market) &&
+			(triggerType == nil || *triggerType == t.Type)
+	}, nil), nil
+}
+
+func (e *Engine) GetTriggerOrdersHistory(
+	params *models.TriggerOrdersHistoryParams) ([]*models.TriggerOrder, error) {
+
+	if params == nil {
+		params = &models.TriggerOrdersHistoryParams{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.triggerViews(func(t *trigger) bool {
+		created := t.CreatedAt.Unix()
+		return (params.Market == nil || *params.Market == t.Market) &&
+			(params.Side == nil || *params.Side == string(t.Side)) &&
+			(params.Type == nil || *params.Type == string(t.Type)) &&
+			(params.OrderType == nil || *params.OrderType == string(t.OrderType)) &&
+			(params.StartTime == nil || created >= int64(*params.StartTime)) &&
+			(params.EndTime == nil || created <= int64(*params.EndTime))
+	}, params.Limit), nil
+}
+
+// triggerViews returns the matching trigger orders, newest first.
+func (e *Engine) triggerViews(match func(t *trigger) bool, limit *int) []*models.TriggerOrder {
+
+	result := make([]*models.TriggerOrder, 0)
+	for _, t := range e.triggers {
+		if match(t) {
+			view := t.view()
+			result = append(result, &view)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+
+	if limit != nil && *limit >= 0 && len(result) > *limit {
+		result = result[:*limit]
+	}
+
+	return result
+}
@@ -0,0 +1,337 @@
+package pnl
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/oms"
+)
+
+// OrderLookup resolves the order behind a fill. *oms.Manager satisfies it.
+type OrderLookup interface {
+	Get(orderID int64) (oms.Order, bool)
+}
+
+type Option func(l *Ledger)
+
+func WithMethod(method Method) Option {
+	return func(l *Ledger) {
+		l.method = method
+	}
+}
+
+// WithOrders attributes fills to strategies by the client ID prefix of
+// their order, as set by models.NewPrefixedClientIDs. Fills of unknown
+// orders and orders without a prefix go to the "" strategy.
+func WithOrders(orders OrderLookup) Option {
+	return func(l *Ledger) {
+		l.orders = orders
+	}
+}
+
+// WithStrategies attributes the fills of orders by ID, for orders the
+// lookup no longer knows, e.g. when replaying history.
+func WithStrategies(strategies map[int64]string) Option {
+	return func(l *Ledger) {
+		for id, s := range strategies {
+			l.strategies[id] = s
+		}
+	}
+}
+
+// Entry is the pnl of a strategy in a market over one UTC day. Realized is
+// the trading pnl of closed lots before fees. Fees are what was paid, in
+// the quote currency, and Funding what was received, negative when paid.
+type Entry struct {
+	Strategy string
+	Market   string
+	Day      time.Time
+	Realized decimal.Decimal
+	Fees     decimal.Decimal
+	Funding  decimal.Decimal
+	Volume   decimal.Decimal
+}
+
+func (e *Entry) Net() decimal.Decimal {
+	return e.Realized.Sub(e.Fees).Add(e.Funding)
+}
+
+func (e *Entry) add(other *Entry) {
+	e.Realized = e.Realized.Add(other.Realized)
+	e.Fees = e.Fees.Add(other.Fees)
+	e.Funding = e.Funding.Add(other.Funding)
+	e.Volume = e.Volume.Add(other.Volume)
+}
+
+// Position is the open inventory of a strategy in a market. Unrealized is
+// valued at the last mark, zero without one.
+type Position struct {
+	Strategy   string
+	Market     string
+	NetSize    decimal.Decimal
+	Cost       decimal.Decimal
+	Mark       decimal.Decimal
+	Unrealized decimal.Decimal
+}
+
+type entryKey struct {
+	strategy string
+	market   string
+	day      time.Time
+}
+
+type positionKey struct {
+	strategy string
+	market   string
+}
+
+// Ledger computes pnl from fills and funding payments. It is safe for
+// concurrent use. Fills and payments are deduplicated by ID, so history
+// and live fills may overlap, but they must arrive in time order for the
+// lot matching to be exact.
+type Ledger struct {
+	mu          *sync.Mutex
+	method      Method
+	orders      OrderLookup
+	strategies  map[int64]string
+	inventories map[positionKey]*inventory
+	entries     map[entryKey]*Entry
+	marks       map[string]decimal.Decimal
+	fills       map[int64]struct{}
+	payments    map[int64]struct{}
+}
+
+func New(opts ...Option) *Ledger {
+
+	l := &Ledger{
+		mu:          &sync.Mutex{},
+		method:      FIFO,
+		strategies:  make(map[int64]string),
+		inventories: make(map[positionKey]*inventory),
+		entries:     make(map[entryKey]*Entry),
+		marks:       make(map[string]decimal.Decimal),
+		fills:       make(map[int64]struct{}),
+		payments:    make(map[int64]struct{}),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Strategy returns the prefix of a client ID from
+// models.NewPrefixedClientIDs, or "" for other client IDs.
+func Strategy(clientID models.ClientOrderID) string {
+	return clientID.Prefix()
+}
+
+func (l *Ledger) strategy(orderID int64) string {
+
+	if s, ok := l.strategies[orderID]; ok {
+		return s
+	}
+
+	if l.orders != nil {
+		if o, ok := l.orders.Get(orderID); ok {
+			s := Strategy(o.ClientID)
+			l.strategies[orderID] = s
+			return s
+		}
+	}
+
+	return ""
+}
+
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func (l *Ledger) entry(strategy, market string, t time.Time) *Entry {
+	key := entryKey{strategy: strategy, market: market, day: day(t)}
+	e, ok := l.entries[key]
+	if !ok {
+		e = &Entry{Strategy: strategy, Market: market, Day: key.day}
+		l.entries[key] = e
+	}
+	return e
+}
+
+func (l *Ledger) inventory(strategy, market string) *inventory {
+	key := positionKey{strategy: strategy, market: market}
+	inv, ok := l.inventories[key]
+	if !ok {
+		inv = &inventory{method: l.method}
+		l.inventories[key] = inv
+	}
+	return inv
+}
+
+// fee returns the fee of a fill in the quote currency.
+func fee(fill *models.Fill) decimal.Decimal {
+	f := decimal.NewFromFloat(fill.Fee)
+	if fill.FeeCurrency != "" && fill.FeeCurrency == fill.BaseCurrency {
+		return f.Mul(fill.Price)
+	}
+	return f
+}
+
+// AddFill books a fill. It returns false for a fill already booked.
+func (l *Ledger) AddFill(fill *models.Fill) bool {
+
+	if fill == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.fills[fill.ID]; ok {
+		return false
+	}
+	l.fills[fill.ID] = struct{}{}
+
+	size := fill.Size
+	if fill.Side == string(models.Sell) {
+		size = size.Neg()
+	}
+
+	strategy := l.strategy(fill.OrderID)
+	realized := l.inventory(strategy, fill.Market).apply(size, fill.Price)
+
+	e := l.entry(strategy, fill.Market, fill.Time)
+	e.Realized = e.Realized.Add(realized)
+	e.Fees = e.Fees.Add(fee(fill))
+	e.Volume = e.Volume.Add(fill.Size.Mul(fill.Price))
+
+	return true
+}
+
+// AddFunding books a funding payment, split between the strategies by
+// their share of the net position in the future. Without a position it
+// goes to the "" strategy. It returns false for a payment already booked.
+func (l *Ledger) AddFunding(payment *models.FundingPayment) bool {
+
+	if payment == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.payments[payment.ID]; ok {
+		return false
+	}
+	l.payments[payment.ID] = struct{}{}
+
+	// The venue reports payments made as positive
+	received := payment.Payment.Neg()
+
+	total := decimal.Zero
+	nets := make(map[string]decimal.Decimal)
+	for key, inv := range l.inventories {
+		if key.market != payment.Future {
+			continue
+		}
+		if net := inv.net(); net.Sign() != 0 {
+			nets[key.strategy] = net
+			total = total.Add(net)
+		}
+	}
+
+	if total.Sign() == 0 {
+		e := l.entry("", payment.Future, payment.Time)
+		e.Funding = e.Funding.Add(received)
+		return true
+	}
+
+	for strategy, net := range nets {
+		e := l.entry(strategy, payment.Future, payment.Time)
+		e.Funding = e.Funding.Add(received.Mul(net).Div(total))
+	}
+
+	return true
+}
+
+// SetMark sets the price open positions in market are valued at.
+func (l *Ledger) SetMark(market string, mark decimal.Decimal) {
+	l.mu.Lock()
+	l.marks[market] = mark
+	l.mu.Unlock()
+}
+
+// Entries returns every entry ordered by day, strategy and market.
+func (l *Ledger) Entries() []Entry {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		result = append(result, *e)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := &result[i], &result[j]
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		}
+		if a.Strategy != b.Strategy {
+			return a.Strategy < b.Strategy
+		}
+		return a.Market < b.Market
+	})
+
+	return result
+}
+
+// Total sums the entries matching strategy and market, "*" matching any.
+// Day is left zero.
+func (l *Ledger) Total(strategy, market string) Entry {
+
+	total := Entry{Strategy: strategy, Market: market}
+	for _, e := range l.Entries() {
+		if (strategy == "*" || e.Strategy == strategy) && (market == "*" || e.Market == market) {
+			total.add(&e)
+		}
+	}
+
+	return total
+}
+
+// Positions returns the open positions ordered by strategy and market.
+func (l *Ledger) Positions() []Position {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Position, 0, len(l.inventories))
+	for key, inv := range l.inventories {
+
+		net := inv.net()
+		if net.Sign() == 0 {
+			continue
+		}
+
+		p := Position{Strategy: key.strategy, Market: key.market, NetSize: net, Cost: inv.cost()}
+		if mark, ok := l.marks[key.market]; ok {
+			p.Mark = mark
+			p.Unrealized = net.Mul(mark.Sub(p.Cost))
+		}
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Strategy != result[j].Strategy {
+			return result[i].Strategy < result[j].Strategy
+		}
+		return result[i].Market < result[j].Market
+	})
+
+	return result
+}
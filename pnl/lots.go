@@ -0,0 +1,92 @@
+package pnl
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+type Method string
+
+const (
+	FIFO        = Method("fifo")
+	LIFO        = Method("lifo")
+	AverageCost = Method("average_cost")
+)
+
+// lot is an open fill. Size is signed, positive for longs.
+type lot struct {
+	size  decimal.Decimal
+	price decimal.Decimal
+}
+
+// inventory holds the open lots of one strategy in one market, all on the
+// same side.
+type inventory struct {
+	method Method
+	lots   []lot
+}
+
+func (inv *inventory) net() decimal.Decimal {
+	net := decimal.Zero
+	for _, l := range inv.lots {
+		net = net.Add(l.size)
+	}
+	return net
+}
+
+// cost returns the average price of the open lots.
+func (inv *inventory) cost() decimal.Decimal {
+	net, notional := decimal.Zero, decimal.Zero
+	for _, l := range inv.lots {
+		net = net.Add(l.size)
+		notional = notional.Add(l.size.Mul(l.price))
+	}
+	if net.Sign() == 0 {
+		return decimal.Zero
+	}
+	return notional.Div(net)
+}
+
+// apply adds a fill of signed size and returns the pnl it realized.
+func (inv *inventory) apply(size, price decimal.Decimal) decimal.Decimal {
+
+	realized := decimal.Zero
+
+	for size.Sign() != 0 && len(inv.lots) > 0 && inv.lots[0].size.Sign() != size.Sign() {
+
+		i := 0
+		if inv.method == LIFO {
+			i = len(inv.lots) - 1
+		}
+		l := &inv.lots[i]
+
+		closed := decimal.Min(size.Abs(), l.size.Abs())
+		if l.size.Sign() < 0 {
+			closed = closed.Neg()
+		}
+
+		// closed has the sign of the lot
+		realized = realized.Add(closed.Mul(price.Sub(l.price)))
+		l.size = l.size.Sub(closed)
+		size = size.Add(closed)
+
+		if l.size.Sign() == 0 {
+			inv.lots = append(inv.lots[:i], inv.lots[i+1:]...)
+		}
+	}
+
+	if size.Sign() == 0 {
+		return realized
+	}
+
+	if inv.method == AverageCost && len(inv.lots) == 1 {
+		l := &inv.lots[0]
+		total := l.size.Add(size)
+		l.price = l.size.Mul(l.price).Add(size.Mul(price)).Div(total)
+		l.size = total
+		return realized
+	}
+
+	inv.lots = append(inv.lots, lot{size: size, price: price})
+
+	return realized
+}
@@ -0,0 +1,268 @@
+package pnl
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// FillHistory is satisfied by *api.Fills.
+type FillHistory interface {
+	GetFills(params *models.FillParams) ([]*models.Fill, error)
+}
+
+// FundingHistory is satisfied by *api.Funding.
+type FundingHistory interface {
+	GetFundingPayments(future *string, start, end *int64) ([]*models.FundingPayment, error)
+}
+
+// Marks is satisfied by *api.Futures.
+type Marks interface {
+	GetFutures() ([]*models.Future, error)
+}
+
+// FetchFills returns the fills of [start, end]. It pages backwards from
+// end, since the venue returns the most recent fills of a range first.
+func FetchFills(src FillHistory, start, end time.Time) ([]*models.Fill, error) {
+
+	seen := make(map[int64]struct{})
+	var result []*models.Fill
+
+	from, to := start.Unix(), end.Unix()
+	for to >= from {
+
+		page, err := src.GetFills(&models.FillParams{StartTime: &from, EndTime: &to})
+		if err != nil {
+			return nil, err
+		}
+
+		added, oldest := 0, to
+		for _, f := range page {
+			if f == nil {
+				continue
+			}
+			if _, ok := seen[f.ID]; !ok {
+				seen[f.ID] = struct{}{}
+				result = append(result, f)
+				added++
+			}
+			if t := f.Time.Unix(); t < oldest {
+				oldest = t
+			}
+		}
+
+		// The oldest second is fetched again in case the page split it
+		if added == 0 {
+			break
+		}
+		to = oldest
+	}
+
+	return result, nil
+}
+
+// FetchPayments returns the funding payments of [start, end], paging like
+// FetchFills.
+func FetchPayments(src FundingHistory, start, end time.Time) ([]*models.FundingPayment, error) {
+
+	seen := make(map[int64]struct{})
+	var result []*models.FundingPayment
+
+	from, to := start.Unix(), end.Unix()
+	for to >= from {
+
+		page, err := src.GetFundingPayments(nil, &from, &to)
+		if err != nil {
+			return nil, err
+		}
+
+		added, oldest := 0, to
+		for _, p := range page {
+			if p == nil {
+				continue
+			}
+			if _, ok := seen[p.ID]; !ok {
+				seen[p.ID] = struct{}{}
+				result = append(result, p)
+				added++
+			}
+			if t := p.Time.Unix(); t < oldest {
+				oldest = t
+			}
+		}
+
+		if added == 0 {
+			break
+		}
+		to = oldest
+	}
+
+	return result, nil
+}
+
+// LoadHistory books the fills and funding payments of [start, end] in time
+// order. funding may be nil.
+func (l *Ledger) LoadHistory(
+	fills FillHistory, funding FundingHistory, start, end time.Time) error {
+
+	history, err := FetchFills(fills, start, end)
+	if err != nil {
+		return err
+	}
+
+	var payments []*models.FundingPayment
+	if funding != nil {
+		if payments, err = FetchPayments(funding, start, end); err != nil {
+			return err
+		}
+	}
+
+	l.Replay(history, payments)
+
+	return nil
+}
+
+// Replay books fills and funding payments merged in time order. A payment
+// at the same time as a fill is booked first, against the position held
+// before it.
+func (l *Ledger) Replay(fills []*models.Fill, payments []*models.FundingPayment) {
+
+	fills = append([]*models.Fill(nil), fills...)
+	payments = append([]*models.FundingPayment(nil), payments...)
+
+	sort.SliceStable(fills, func(i, j int) bool {
+		if !fills[i].Time.Equal(fills[j].Time) {
+			return fills[i].Time.Before(fills[j].Time)
+		}
+		return fills[i].ID < fills[j].ID
+	})
+	sort.SliceStable(payments, func(i, j int) bool {
+		return payments[i].Time.Before(payments[j].Time)
+	})
+
+	i, j := 0, 0
+	for i < len(fills) || j < len(payments) {
+		if j < len(payments) && (i == len(fills) || !fills[i].Time.Before(payments[j].Time)) {
+			l.AddFunding(payments[j])
+			j++
+			continue
+		}
+		l.AddFill(fills[i])
+		i++
+	}
+}
+
+// Follow books live fills until ctx is done or fills is closed.
+func (l *Ledger) Follow(ctx context.Context, fills <-chan *models.FillResponse) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f, ok := <-fills:
+			if !ok {
+				return
+			}
+			if f != nil {
+				l.AddFill(&f.Fill)
+			}
+		}
+	}
+}
+
+// RefreshMarks sets the mark of every future.
+func (l *Ledger) RefreshMarks(src Marks) error {
+
+	futures, err := src.GetFutures()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range futures {
+		if f != nil && f.Mark.Sign() > 0 {
+			l.SetMark(f.Name, f.Mark)
+		}
+	}
+
+	return nil
+}
+
+// Difference is a figure on which the ledger and the venue disagree.
+type Difference struct {
+	Market string
+	Field  string
+	Ledger decimal.Decimal
+	Venue  decimal.Decimal
+}
+
+// Reconcile compares the net size and the trading pnl, realized plus
+// unrealized before fees and funding, of every market with the venue's
+// positions. Both are summed over the strategies, which makes the pnl
+// independent of the method and the attribution; it agrees when the
+// ledger covers the same history as the venue's realized pnl and marks
+// are refreshed. Differences within tolerance are ignored.
+func (l *Ledger) Reconcile(positions []*models.Position, tolerance decimal.Decimal) []Difference {
+
+	type totals struct{ net, pnl decimal.Decimal }
+
+	ledger := make(map[string]*totals)
+	get := func(market string) *totals {
+		t, ok := ledger[market]
+		if !ok {
+			t = &totals{}
+			ledger[market] = t
+		}
+		return t
+	}
+	for _, e := range l.Entries() {
+		t := get(e.Market)
+		t.pnl = t.pnl.Add(e.Realized)
+	}
+	for _, p := range l.Positions() {
+		t := get(p.Market)
+		t.net = t.net.Add(p.NetSize)
+		t.pnl = t.pnl.Add(p.Unrealized)
+	}
+
+	venue := make(map[string]*totals)
+	for _, p := range positions {
+		if p != nil {
+			venue[p.Future] = &totals{net: p.NetSize, pnl: p.RealizedPnl.Add(p.UnrealizedPnl)}
+		}
+	}
+
+	markets := make([]string, 0, len(ledger)+len(venue))
+	for m := range ledger {
+		markets = append(markets, m)
+	}
+	for m := range venue {
+		if _, ok := ledger[m]; !ok {
+			markets = append(markets, m)
+		}
+	}
+	sort.Strings(markets)
+
+	var result []Difference
+	for _, m := range markets {
+
+		a, b := ledger[m], venue[m]
+		if a == nil {
+			a = &totals{}
+		}
+		if b == nil {
+			b = &totals{}
+		}
+
+		if a.net.Sub(b.net).Abs().GreaterThan(tolerance) {
+			result = append(result, Difference{Market: m, Field: "net_size", Ledger: a.net, Venue: b.net})
+		}
+		if a.pnl.Sub(b.pnl).Abs().GreaterThan(tolerance) {
+			result = append(result, Difference{Market: m, Field: "pnl", Ledger: a.pnl, Venue: b.pnl})
+		}
+	}
+
+	return result
+}
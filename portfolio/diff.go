@@ -0,0 +1,100 @@
+package portfolio
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+type ChangeKind string
+
+const (
+	BalanceChanged  = ChangeKind("balance")
+	PositionChanged = ChangeKind("position")
+	ValueChanged    = ChangeKind("value")
+)
+
+// Change is a figure of one account that differs between snapshots. Name
+// is the coin of a balance and the future of a position; figures missing
+// from a snapshot are zero. Accounts that failed to load in either
+// snapshot have unknown figures and are left out.
+type Change struct {
+	SubAccount string
+	Kind       ChangeKind
+	Name       string
+	From       decimal.Decimal
+	To         decimal.Decimal
+}
+
+type figure struct {
+	subAccount string
+	kind       ChangeKind
+	name       string
+}
+
+// failed returns the subaccounts whose load failed.
+func failed(s *Snapshot) map[string]bool {
+	result := make(map[string]bool)
+	for _, a := range s.Accounts {
+		if a.Err != nil {
+			result[a.SubAccount] = true
+		}
+	}
+	return result
+}
+
+func figures(s *Snapshot, skip map[string]bool) map[figure]decimal.Decimal {
+
+	result := make(map[figure]decimal.Decimal)
+	for _, a := range s.Accounts {
+		if skip[a.SubAccount] {
+			continue
+		}
+		result[figure{a.SubAccount, ValueChanged, ""}] = a.Value
+		for _, h := range a.Holdings {
+			result[figure{a.SubAccount, BalanceChanged, h.Coin}] = h.Total
+		}
+		for _, p := range a.Positions {
+			result[figure{a.SubAccount, PositionChanged, p.Future}] = p.NetSize
+		}
+	}
+
+	return result
+}
+
+// Diff returns the changes from previous to next ordered by subaccount,
+// kind and name.
+func Diff(previous, next *Snapshot) []Change {
+
+	skip := failed(previous)
+	for subAccount := range failed(next) {
+		skip[subAccount] = true
+	}
+
+	from, to := figures(previous, skip), figures(next, skip)
+
+	var result []Change
+	for f, value := range to {
+		if old := from[f]; !old.Equal(value) {
+			result = append(result, Change{SubAccount: f.subAccount, Kind: f.kind, Name: f.name, From: old, To: value})
+		}
+	}
+	for f, old := range from {
+		if _, ok := to[f]; !ok && old.Sign() != 0 {
+			result = append(result, Change{SubAccount: f.subAccount, Kind: f.kind, Name: f.name, From: old})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := &result[i], &result[j]
+		if a.SubAccount != b.SubAccount {
+			return a.SubAccount < b.SubAccount
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+
+	return result
+}
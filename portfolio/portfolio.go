@@ -0,0 +1,363 @@
+package portfolio
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	// mainAccount is the key of the main account in the balances of every
+	// account.
+	mainAccount = "main"
+	usd         = "USD"
+)
+
+// Holding is a coin balance valued in USD. Price is zero for coins without
+// a USD market.
+type Holding struct {
+	Coin  string
+	Total decimal.Decimal
+	Free  decimal.Decimal
+	Price decimal.Decimal
+	Value decimal.Decimal
+}
+
+// Account is the state of one account, "" being the main account. Value
+// is the USD value of the holdings plus the unrealized pnl of the
+// positions. Err is set if any of it could not be loaded.
+type Account struct {
+	SubAccount  string
+	Holdings    []Holding
+	Positions   []models.Position
+	OpenOrders  []*models.Order
+	Information models.AccountInformation
+	Value       decimal.Decimal
+	Err         error
+}
+
+// CoinTotal is a coin across every account.
+type CoinTotal struct {
+	Coin         string
+	Total        decimal.Decimal
+	Value        decimal.Decimal
+	BySubAccount map[string]decimal.Decimal
+}
+
+// PositionTotal is a future across every account.
+type PositionTotal struct {
+	Future        string
+	NetSize       decimal.Decimal
+	UnrealizedPnl decimal.Decimal
+	BySubAccount  map[string]decimal.Decimal
+}
+
+// Snapshot is the consolidated portfolio at a time. Unpriced lists the
+// coins held that could not be valued.
+type Snapshot struct {
+	Time      time.Time
+	Accounts  []Account
+	Coins     []CoinTotal
+	Positions []PositionTotal
+	Value     decimal.Decimal
+	Unpriced  []string
+}
+
+func (s *Snapshot) Account(subAccount string) (Account, bool) {
+	for _, a := range s.Accounts {
+		if a.SubAccount == subAccount {
+			return a, true
+		}
+	}
+	return Account{}, false
+}
+
+type Option func(a *Aggregator)
+
+// WithSubAccounts limits the aggregator to subaccounts, "" being the main
+// account, instead of every subaccount.
+func WithSubAccounts(nicknames ...string) Option {
+	return func(a *Aggregator) {
+		a.subAccounts = append([]string(nil), nicknames...)
+	}
+}
+
+// Aggregator consolidates the portfolio of every subaccount.
+type Aggregator struct {
+	client      *api.Client
+	subAccounts []string
+	mu          *sync.Mutex
+	last        *Snapshot
+}
+
+func New(client *api.Client, opts ...Option) *Aggregator {
+	a := &Aggregator{client: client, mu: &sync.Mutex{}}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *Aggregator) nicknames() ([]string, error) {
+
+	if a.subAccounts != nil {
+		return a.subAccounts, nil
+	}
+
+	subAccounts, err := a.client.SubAccounts.GetSubaccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{""}
+	for _, s := range subAccounts {
+		if s != nil {
+			result = append(result, s.Nickname)
+		}
+	}
+
+	return result, nil
+}
+
+func (a *Aggregator) clientFor(nickname string) *api.Client {
+	c := a.client.Clone()
+	c.SubAccount = nil
+	if nickname != "" {
+		name := nickname
+		c.SubAccount = &name
+	}
+	return c
+}
+
+// prices returns the USD price of every coin with a USD spot market.
+func prices(markets []*models.Market) map[string]decimal.Decimal {
+
+	result := make(map[string]decimal.Decimal)
+	for _, m := range markets {
+
+		if m == nil || m.Type != "spot" || m.QuoteCurrency != usd {
+			continue
+		}
+
+		price := m.Last
+		if m.Bid.Sign() > 0 && m.Ask.Sign() > 0 {
+			price = m.Bid.Add(m.Ask).Div(decimal.NewFromInt(2))
+		}
+		if price.Sign() > 0 {
+			result[m.BaseCurrency] = price
+		}
+	}
+
+	return result
+}
+
+// Refresh loads every account in parallel and consolidates them. The
+// snapshot is returned even if some accounts failed, see Account.Err.
+func (a *Aggregator) Refresh() (*Snapshot, error) {
+
+	nicknames, err := a.nicknames()
+	if err != nil {
+		return nil, err
+	}
+
+	markets, err := a.client.Markets.GetMarkets()
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := a.client.Wallet.GetBalancesAllAccts()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]Account, len(nicknames))
+
+	wg := &sync.WaitGroup{}
+	for i, nickname := range nicknames {
+		wg.Add(1)
+		go func(i int, nickname string) {
+			defer wg.Done()
+			accounts[i] = a.load(nickname)
+		}(i, nickname)
+	}
+	wg.Wait()
+
+	snapshot := consolidate(time.Now(), accounts, balances, prices(markets))
+
+	a.mu.Lock()
+	a.last = snapshot
+	a.mu.Unlock()
+
+	return snapshot, nil
+}
+
+func (a *Aggregator) load(nickname string) Account {
+
+	account := Account{SubAccount: nickname}
+	c := a.clientFor(nickname)
+
+	if err := c.Account.GetAccountInformation(&account.Information); err != nil {
+		account.Err = err
+		return account
+	}
+
+	for _, p := range account.Information.Positions {
+		if p.NetSize.Sign() != 0 {
+			account.Positions = append(account.Positions, p)
+		}
+	}
+
+	orders, err := c.Orders.GetOpenOrders("")
+	if err != nil {
+		account.Err = err
+		return account
+	}
+	account.OpenOrders = orders
+
+	return account
+}
+
+func consolidate(
+	now time.Time, accounts []Account,
+	balances map[string][]*models.Balance, prices map[string]decimal.Decimal) *Snapshot {
+
+	s := &Snapshot{Time: now}
+	coins := make(map[string]*CoinTotal)
+	positions := make(map[string]*PositionTotal)
+	unpriced := make(map[string]bool)
+
+	for i := range accounts {
+
+		account := &accounts[i]
+
+		key := account.SubAccount
+		if key == "" {
+			key = mainAccount
+		}
+
+		for _, b := range balances[key] {
+
+			if b == nil || b.Total.Sign() == 0 {
+				continue
+			}
+
+			price, ok := prices[b.Coin]
+			if b.Coin == usd {
+				price, ok = decimal.NewFromInt(1), true
+			}
+			if !ok {
+				unpriced[b.Coin] = true
+			}
+
+			h := Holding{Coin: b.Coin, Total: b.Total, Free: b.Free, Price: price, Value: b.Total.Mul(price)}
+			account.Holdings = append(account.Holdings, h)
+			account.Value = account.Value.Add(h.Value)
+
+			c, ok := coins[b.Coin]
+			if !ok {
+				c = &CoinTotal{Coin: b.Coin, BySubAccount: make(map[string]decimal.Decimal)}
+				coins[b.Coin] = c
+			}
+			c.Total = c.Total.Add(h.Total)
+			c.Value = c.Value.Add(h.Value)
+			c.BySubAccount[account.SubAccount] = c.BySubAccount[account.SubAccount].Add(h.Value)
+		}
+
+		for _, p := range account.Positions {
+
+			account.Value = account.Value.Add(p.UnrealizedPnl)
+
+			t, ok := positions[p.Future]
+			if !ok {
+				t = &PositionTotal{Future: p.Future, BySubAccount: make(map[string]decimal.Decimal)}
+				positions[p.Future] = t
+			}
+			t.NetSize = t.NetSize.Add(p.NetSize)
+			t.UnrealizedPnl = t.UnrealizedPnl.Add(p.UnrealizedPnl)
+			t.BySubAccount[account.SubAccount] = t.BySubAccount[account.SubAccount].Add(p.NetSize)
+		}
+
+		s.Value = s.Value.Add(account.Value)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].SubAccount < accounts[j].SubAccount })
+	s.Accounts = accounts
+
+	for _, c := range coins {
+		s.Coins = append(s.Coins, *c)
+	}
+	sort.Slice(s.Coins, func(i, j int) bool { return s.Coins[i].Coin < s.Coins[j].Coin })
+
+	for _, p := range positions {
+		s.Positions = append(s.Positions, *p)
+	}
+	sort.Slice(s.Positions, func(i, j int) bool { return s.Positions[i].Future < s.Positions[j].Future })
+
+	for coin := range unpriced {
+		s.Unpriced = append(s.Unpriced, coin)
+	}
+	sort.Strings(s.Unpriced)
+
+	return s
+}
+
+// Last returns the latest snapshot, nil before the first refresh.
+func (a *Aggregator) Last() *Snapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.last
+}
+
+// Update is a refresh of the portfolio, with its changes from the
+// previous snapshot.
+type Update struct {
+	Snapshot *Snapshot
+	Changes  []Change
+	Err      error
+}
+
+// Run refreshes every interval until ctx is done. The channel is closed
+// when Run returns; a slow reader misses updates rather than delaying
+// refreshes.
+func (a *Aggregator) Run(ctx context.Context, interval time.Duration) <-chan Update {
+
+	updates := make(chan Update, 1)
+
+	go func() {
+
+		defer close(updates)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+
+			previous := a.Last()
+			snapshot, err := a.Refresh()
+
+			update := Update{Snapshot: snapshot, Err: err}
+			if err == nil && previous != nil {
+				update.Changes = Diff(previous, snapshot)
+			}
+
+			select {
+			case updates <- update:
+			default:
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return updates
+}
@@ -0,0 +1,393 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	defaultRefreshInterval = 5 * time.Minute
+	defaultBufferSize      = 256
+	usd                    = "USD"
+)
+
+type InstrumentType string
+
+const (
+	Spot        = InstrumentType("spot")
+	Perpetual   = InstrumentType("perpetual")
+	DatedFuture = InstrumentType("future")
+	Move        = InstrumentType("move")
+	Prediction  = InstrumentType("prediction")
+)
+
+type Instrument struct {
+	Name          string
+	Underlying    string
+	BaseCurrency  string
+	QuoteCurrency string
+	Type          InstrumentType
+	TickSize      decimal.Decimal
+	LotSize       decimal.Decimal
+	MinSize       decimal.Decimal
+	Enabled       bool
+	PostOnly      bool
+	Restricted    bool
+	Expiry        time.Time
+	Market        models.Market
+	Future        *models.Future
+}
+
+type EventType string
+
+const (
+	Added             = EventType("added")
+	Delisted          = EventType("delisted")
+	IncrementsChanged = EventType("increments_changed")
+	FlagsChanged      = EventType("flags_changed")
+)
+
+type Event struct {
+	Type       EventType
+	Instrument Instrument
+	Previous   *Instrument
+}
+
+type Option func(r *Registry)
+
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(r *Registry) {
+		r.refreshInterval = interval
+	}
+}
+
+func WithStream(stream *api.Stream) Option {
+	return func(r *Registry) {
+		r.stream = stream
+	}
+}
+
+type Registry struct {
+	client          *api.Client
+	stream          *api.Stream
+	mu              *sync.RWMutex
+	instruments     map[string]*Instrument
+	futures         map[string]*models.Future
+	refreshInterval time.Duration
+}
+
+func New(client *api.Client, opts ...Option) *Registry {
+
+	r := &Registry{
+		client:          client,
+		mu:              &sync.RWMutex{},
+		instruments:     make(map[string]*Instrument),
+		futures:         make(map[string]*models.Future),
+		refreshInterval: defaultRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.stream == nil && client != nil {
+		r.stream = &client.Stream
+	}
+
+	return r
+}
+
+func Classify(market *models.Market, future *models.Future) InstrumentType {
+
+	if future != nil {
+		switch future.Type {
+		case string(Perpetual):
+			return Perpetual
+		case string(Move):
+			return Move
+		case string(Prediction):
+			return Prediction
+		default:
+			return DatedFuture
+		}
+	}
+
+	if market.Type == string(Spot) {
+		return Spot
+	}
+
+	switch {
+	case strings.HasSuffix(market.Name, "-PERP"):
+		return Perpetual
+	case strings.Contains(market.Name, "-MOVE-"):
+		return Move
+	default:
+		return DatedFuture
+	}
+}
+
+func NewInstrument(market *models.Market, future *models.Future) Instrument {
+
+	inst := Instrument{
+		Name:          market.Name,
+		Underlying:    market.Underlying,
+		BaseCurrency:  market.BaseCurrency,
+		QuoteCurrency: market.QuoteCurrency,
+		Type:          Classify(market, future),
+		TickSize:      market.PriceIncrement,
+		LotSize:       market.SizeIncrement,
+		MinSize:       market.MinProvideSize,
+		Enabled:       market.Enabled,
+		PostOnly:      market.PostOnly,
+		Restricted:    market.Restricted,
+		Market:        *market,
+	}
+
+	if inst.Underlying == "" {
+		inst.Underlying = market.BaseCurrency
+	}
+	if inst.Type != Spot && inst.QuoteCurrency == "" {
+		inst.QuoteCurrency = usd
+	}
+
+	if future != nil {
+		f := *future
+		inst.Future = &f
+		inst.Expiry = future.Expiry
+		if inst.Underlying == "" {
+			inst.Underlying = future.Underlying
+		}
+		if inst.LotSize.IsZero() {
+			inst.LotSize = future.SizeIncrement
+		}
+		if inst.TickSize.IsZero() {
+			inst.TickSize = future.PriceIncrement
+		}
+	}
+
+	if inst.MinSize.LessThan(inst.LotSize) {
+		inst.MinSize = inst.LotSize
+	}
+
+	return inst
+}
+
+func diff(prev, cur *Instrument) []Event {
+
+	if prev == nil {
+		return []Event{{Type: Added, Instrument: *cur}}
+	}
+
+	p, result := *prev, make([]Event, 0)
+
+	if !prev.TickSize.Equal(cur.TickSize) ||
+		!prev.LotSize.Equal(cur.LotSize) ||
+		!prev.MinSize.Equal(cur.MinSize) {
+		result = append(result, Event{Type: IncrementsChanged, Instrument: *cur, Previous: &p})
+	}
+	if prev.Enabled != cur.Enabled ||
+		prev.PostOnly != cur.PostOnly ||
+		prev.Restricted != cur.Restricted {
+		result = append(result, Event{Type: FlagsChanged, Instrument: *cur, Previous: &p})
+	}
+
+	return result
+}
+
+// Apply upserts a market, e.g. from the markets channel, and returns the
+// resulting change events.
+func (r *Registry) Apply(market *models.Market) []Event {
+
+	if market == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.apply(market)
+}
+
+func (r *Registry) apply(market *models.Market) []Event {
+	inst := NewInstrument(market, r.futures[market.Name])
+	events := diff(r.instruments[market.Name], &inst)
+	r.instruments[market.Name] = &inst
+	return events
+}
+
+// Load replaces the registry contents with complete market and future
+// lists. Instruments missing from the lists are reported as delisted.
+func (r *Registry) Load(markets []*models.Market, futures []*models.Future) []Event {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.futures = make(map[string]*models.Future, len(futures))
+	for _, f := range futures {
+		if f != nil {
+			r.futures[f.Name] = f
+		}
+	}
+
+	seen, events := make(map[string]struct{}, len(markets)), make([]Event, 0)
+
+	for _, m := range markets {
+		if m == nil {
+			continue
+		}
+		seen[m.Name] = struct{}{}
+		events = append(events, r.apply(m)...)
+	}
+
+	names := make([]string, 0)
+	for name := range r.instruments {
+		if _, ok := seen[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		events = append(events, Event{Type: Delisted, Instrument: *r.instruments[name]})
+		delete(r.instruments, name)
+	}
+
+	return events
+}
+
+func (r *Registry) Refresh() ([]Event, error) {
+
+	if r.client == nil {
+		return nil, errors.New("Nil client")
+	}
+
+	markets, err := r.client.Markets.GetMarkets()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	futures, err := r.client.Futures.GetFutures()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return r.Load(markets, futures), nil
+}
+
+// Run loads the registry over REST, keeps it current from the markets
+// channel and periodic refreshes, and emits change events.
+func (r *Registry) Run(ctx context.Context) (<-chan Event, error) {
+
+	events, err := r.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	marketsC, err := r.stream.SubscribeToMarkets(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	eventsC := make(chan Event, defaultBufferSize)
+
+	go func() {
+
+		defer close(eventsC)
+
+		ticker := time.NewTicker(r.refreshInterval)
+		defer ticker.Stop()
+
+		for {
+
+			for _, e := range events {
+				select {
+				case eventsC <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-marketsC:
+				if !ok {
+					return
+				}
+				events = r.Apply(m)
+			case <-ticker.C:
+				if events, err = r.Refresh(); err != nil {
+					r.client.Logger.Debugf("registry refresh: %+v", err)
+				}
+			}
+		}
+	}()
+
+	return eventsC, nil
+}
+
+func (r *Registry) Get(name string) (Instrument, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inst, ok := r.instruments[name]
+	if !ok {
+		return Instrument{}, false
+	}
+
+	return *inst, true
+}
+
+func (r *Registry) Future(name string) (models.Future, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	f, ok := r.futures[name]
+	if !ok {
+		return models.Future{}, false
+	}
+
+	return *f, true
+}
+
+func (r *Registry) filter(f func(inst *Instrument) bool) []Instrument {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]Instrument, 0)
+	for _, inst := range r.instruments {
+		if f(inst) {
+			result = append(result, *inst)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+func (r *Registry) All() []Instrument {
+	return r.filter(func(*Instrument) bool { return true })
+}
+
+func (r *Registry) ByUnderlying(underlying string) []Instrument {
+	return r.filter(func(inst *Instrument) bool { return inst.Underlying == underlying })
+}
+
+func (r *Registry) ByType(t InstrumentType) []Instrument {
+	return r.filter(func(inst *Instrument) bool { return inst.Type == t })
+}
+
+func (r *Registry) ByQuoteCurrency(quote string) []Instrument {
+	return r.filter(func(inst *Instrument) bool { return inst.QuoteCurrency == quote })
+}
@@ -0,0 +1,336 @@
+package risk
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/oms"
+	"github.com/sanjujosh/go-ftx/tickers"
+)
+
+// Quotes provides reference prices. *tickers.Cache satisfies it.
+type Quotes interface {
+	Get(market string) (tickers.Quote, bool)
+	IsStale(market string) bool
+}
+
+// Positions provides current positions. *api.Account and the paper
+// trading engine satisfy it.
+type Positions interface {
+	GetPositions() ([]*models.Position, error)
+}
+
+// OpenOrders provides the resting orders of a market, or of every market
+// for "". *api.Orders and the paper trading engine satisfy it; use
+// OMSOrders to read them from an oms.Manager instead.
+type OpenOrders interface {
+	GetOpenOrders(market string) ([]*models.Order, error)
+}
+
+type omsOrders struct {
+	m *oms.Manager
+}
+
+func OMSOrders(m *oms.Manager) OpenOrders {
+	return &omsOrders{m: m}
+}
+
+func (o *omsOrders) GetOpenOrders(market string) ([]*models.Order, error) {
+	open := o.m.Open(oms.Filter{Market: market})
+	result := make([]*models.Order, len(open))
+	for i := range open {
+		result[i] = &open[i].Order
+	}
+	return result, nil
+}
+
+// reference returns the price an order on side would trade at now.
+func reference(quotes Quotes, req *Request) (decimal.Decimal, error) {
+
+	if quotes == nil {
+		return decimal.Zero, reject(NoReferencePrice, "no quotes for %s", req.Market)
+	}
+
+	q, ok := quotes.Get(req.Market)
+	if !ok || quotes.IsStale(req.Market) {
+		return decimal.Zero, reject(NoReferencePrice, "no fresh quote for %s", req.Market)
+	}
+
+	price := q.Ticker.Ask
+	if req.Side == models.Sell {
+		price = q.Ticker.Bid
+	}
+	if price.Sign() <= 0 {
+		return decimal.Zero, reject(NoReferencePrice, "empty %s side for %s", req.Side, req.Market)
+	}
+
+	return price, nil
+}
+
+// NotionalCheck enforces Limits.MaxOrderNotional. Orders without a price
+// are valued at the ticker.
+type NotionalCheck struct {
+	quotes Quotes
+}
+
+func NewNotionalCheck(quotes Quotes) *NotionalCheck {
+	return &NotionalCheck{quotes: quotes}
+}
+
+func (c *NotionalCheck) Check(req *Request) error {
+
+	max := req.Limits.MaxOrderNotional
+	if max.Sign() <= 0 {
+		return nil
+	}
+
+	price := req.Price
+	if price.Sign() <= 0 {
+		ref, err := reference(c.quotes, req)
+		if err != nil {
+			return err
+		}
+		price = ref
+	}
+
+	if notional := req.Size.Mul(price); notional.GreaterThan(max) {
+		return reject(MaxOrderNotional, "%s notional %s above %s", req.Market, notional, max)
+	}
+
+	return nil
+}
+
+// CollarCheck enforces Limits.PriceCollar on limit orders. Trigger orders
+// are meant to be away from the market and are not collared.
+type CollarCheck struct {
+	quotes Quotes
+}
+
+func NewCollarCheck(quotes Quotes) *CollarCheck {
+	return &CollarCheck{quotes: quotes}
+}
+
+func (c *CollarCheck) Check(req *Request) error {
+
+	collar := req.Limits.PriceCollar
+	if collar.Sign() <= 0 || req.Action == Trigger || req.Price.Sign() <= 0 {
+		return nil
+	}
+
+	ref, err := reference(c.quotes, req)
+	if err != nil {
+		return err
+	}
+
+	one := decimal.NewFromInt(1)
+	if req.Side == models.Buy {
+		if max := ref.Mul(one.Add(collar)); req.Price.GreaterThan(max) {
+			return reject(PriceCollar, "%s buy at %s above %s", req.Market, req.Price, max)
+		}
+		return nil
+	}
+
+	if min := ref.Mul(one.Sub(collar)); req.Price.LessThan(min) {
+		return reject(PriceCollar, "%s sell at %s below %s", req.Market, req.Price, min)
+	}
+
+	return nil
+}
+
+type positionSources struct {
+	positions Positions
+	open      OpenOrders
+}
+
+// PositionCheck enforces the max position per market, projecting the
+// current position as if every open order on the order's side filled.
+// Without an OpenOrders source the open sizes of the position are used.
+// Reduce-only orders are not checked.
+//
+// Positions are per subaccount: a check shared by the guards of several
+// subaccounts needs their sources set with SetSources. Subaccounts without
+// them use the sources given to NewPositionCheck.
+type PositionCheck struct {
+	mu         *sync.RWMutex
+	defaults   positionSources
+	subAccount map[string]positionSources
+}
+
+func NewPositionCheck(positions Positions, open OpenOrders) *PositionCheck {
+	return &PositionCheck{
+		mu:         &sync.RWMutex{},
+		defaults:   positionSources{positions: positions, open: open},
+		subAccount: make(map[string]positionSources),
+	}
+}
+
+// SetSources sets the sources of a subaccount, "" being the main account.
+func (c *PositionCheck) SetSources(subAccount string, positions Positions, open OpenOrders) {
+	c.mu.Lock()
+	c.subAccount[subAccount] = positionSources{positions: positions, open: open}
+	c.mu.Unlock()
+}
+
+func (c *PositionCheck) sources(subAccount string) positionSources {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if s, ok := c.subAccount[subAccount]; ok {
+		return s
+	}
+	return c.defaults
+}
+
+func (c *PositionCheck) Check(req *Request) error {
+
+	max := req.Limits.maxPosition(req.Market)
+	if max.Sign() <= 0 || req.ReduceOnly {
+		return nil
+	}
+
+	src := c.sources(req.SubAccount)
+
+	positions, err := src.positions.GetPositions()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	net, long, short := decimal.Zero, decimal.Zero, decimal.Zero
+	for _, p := range positions {
+		if p != nil && p.Future == req.Market {
+			net, long, short = p.NetSize, p.LongOrderSize, p.ShortOrderSize
+			break
+		}
+	}
+
+	sameSide := long
+	if req.Side == models.Sell {
+		sameSide = short
+	}
+
+	if src.open != nil {
+		orders, err := src.open.GetOpenOrders(req.Market)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		sameSide = decimal.Zero
+		for _, o := range orders {
+			if o != nil && o.Side == req.Side && (req.Existing == nil || o.ID != req.Existing.ID) {
+				sameSide = sameSide.Add(o.RemainingSize)
+			}
+		}
+	} else if req.Existing != nil {
+		sameSide = decimal.Max(sameSide.Sub(req.Existing.RemainingSize), decimal.Zero)
+	}
+
+	projected := net.Add(req.signed(sameSide.Add(req.Size))).Add(req.Pending)
+	if projected.Abs().GreaterThan(max) {
+		return reject(MaxPosition, "%s projected position %s beyond %s", req.Market, projected, max)
+	}
+
+	return nil
+}
+
+// OpenOrdersCheck enforces Limits.MaxOpenOrders across every market.
+// Modifies replace an order and are not counted. Like PositionCheck, a
+// check shared across subaccounts needs the source of each set with
+// SetSource.
+type OpenOrdersCheck struct {
+	mu         *sync.RWMutex
+	defaults   OpenOrders
+	subAccount map[string]OpenOrders
+}
+
+func NewOpenOrdersCheck(open OpenOrders) *OpenOrdersCheck {
+	return &OpenOrdersCheck{
+		mu:         &sync.RWMutex{},
+		defaults:   open,
+		subAccount: make(map[string]OpenOrders),
+	}
+}
+
+// SetSource sets the source of a subaccount, "" being the main account.
+func (c *OpenOrdersCheck) SetSource(subAccount string, open OpenOrders) {
+	c.mu.Lock()
+	c.subAccount[subAccount] = open
+	c.mu.Unlock()
+}
+
+func (c *OpenOrdersCheck) source(subAccount string) OpenOrders {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if open, ok := c.subAccount[subAccount]; ok {
+		return open
+	}
+	return c.defaults
+}
+
+func (c *OpenOrdersCheck) Check(req *Request) error {
+
+	max := req.Limits.MaxOpenOrders
+	if max <= 0 || req.Action == Modify {
+		return nil
+	}
+
+	orders, err := c.source(req.SubAccount).GetOpenOrders("")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if n := len(orders) + req.Orders; n >= max {
+		return reject(MaxOpenOrders, "%d open orders, max %d", n, max)
+	}
+
+	return nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateCheck enforces Limits.MaxOrderRate with a token bucket per
+// subaccount holding one second of orders. Put it last in the chain so
+// that orders rejected by other checks do not use up the rate.
+type RateCheck struct {
+	mu      *sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateCheck() *RateCheck {
+	return &RateCheck{mu: &sync.Mutex{}, buckets: make(map[string]*bucket)}
+}
+
+func (c *RateCheck) Check(req *Request) error {
+
+	rate := req.Limits.MaxOrderRate
+	if rate <= 0 {
+		return nil
+	}
+	burst := math.Max(rate, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := c.buckets[req.SubAccount]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		c.buckets[req.SubAccount] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return reject(MaxOrderRate, "above %g orders per second", rate)
+	}
+	b.tokens--
+
+	return nil
+}
@@ -0,0 +1,455 @@
+package risk
+
+import (
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// Orders is the order service a Guard wraps. *api.Orders and the paper
+// trading engine satisfy it.
+type Orders interface {
+	PlaceOrder(params *models.OrderParams, order *models.Order) error
+	PlaceOrderOnce(params *models.OrderParams, order *models.Order) (placed bool, err error)
+	ModifyOrder(orderID int64, params *models.ModifyOrderParams, order *models.Order) error
+	ModifyOrderByClientID(
+		clientID models.ClientOrderID, params *models.ModifyOrderParams, order *models.Order) error
+	GetOrderStatusByClientID(clientID models.ClientOrderID, order *models.Order) error
+	GetOrderStatus(orderID int64, order *models.Order) error
+	CancelOrder(orderID int64) (string, error)
+	PlaceTriggerOrder(params *models.TriggerOrderParams, order *models.TriggerOrder) error
+	ModifyTriggerOrder(
+		orderID int64, params *models.ModifyTriggerOrderParams, order *models.TriggerOrder) error
+	CancelTriggerOrder(orderID int64) (string, error)
+	GetOpenTriggerOrders(
+		market *string, triggerType *models.TriggerOrderType) ([]*models.TriggerOrder, error)
+	GetTriggerOrderTriggers(orderID int64) ([]*models.Trigger, error)
+}
+
+// BatchOrders is implemented by order services with bulk entry, such as
+// *api.Orders. Guards fall back to one call per order without it.
+type BatchOrders interface {
+	PlaceOrders(params []*models.OrderParams, opts ...api.BatchOption) ([]api.PlaceResult, error)
+	ModifyOrders(requests []api.ModifyRequest, opts ...api.BatchOption) ([]api.ModifyResult, error)
+}
+
+// Guard passes order entry of one subaccount through a chain before it
+// reaches the wrapped service. Queries and cancels are passed straight
+// through, so a Guard can stand in for the service, e.g. as algo.Orders.
+// Order entry of a subaccount is serialized from the check through the
+// send, so concurrent orders cannot pass the limits together.
+type Guard struct {
+	chain      *Chain
+	orders     Orders
+	subAccount string
+	entry      *sync.Mutex
+}
+
+// Wrap returns a guard for orders, whose limits are those of subAccount.
+func (c *Chain) Wrap(orders Orders, subAccount string) *Guard {
+	return &Guard{chain: c, orders: orders, subAccount: subAccount, entry: c.entryLock(subAccount)}
+}
+
+func (g *Guard) placeRequest(params *models.OrderParams) *Request {
+	req := &Request{
+		Action:     Place,
+		SubAccount: g.subAccount,
+		Market:     params.Market,
+		Side:       params.Side,
+		Type:       params.Type,
+		Size:       params.Size,
+		ReduceOnly: params.ReduceOnly,
+	}
+	if params.Type != models.MarketOrder {
+		req.Price = params.Price
+	}
+	return req
+}
+
+func (g *Guard) modifyRequest(orderID int64, params *models.ModifyOrderParams) (*Request, error) {
+
+	existing := &models.Order{}
+	if err := g.orders.GetOrderStatus(orderID, existing); err != nil {
+		return nil, err
+	}
+
+	return g.modifyRequestFor(existing, params), nil
+}
+
+func (g *Guard) modifyRequestFor(existing *models.Order, params *models.ModifyOrderParams) *Request {
+
+	req := &Request{
+		Action:     Modify,
+		SubAccount: g.subAccount,
+		Market:     existing.Market,
+		Side:       existing.Side,
+		Type:       existing.Type,
+		Size:       existing.RemainingSize,
+		Price:      existing.Price,
+		ReduceOnly: existing.ReduceOnly,
+		Existing:   existing,
+	}
+	if params.Size != nil {
+		req.Size = *params.Size
+	}
+	if params.Price != nil {
+		req.Price = *params.Price
+	}
+
+	return req
+}
+
+func (g *Guard) PlaceOrder(params *models.OrderParams, order *models.Order) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	if err := g.chain.Check(g.placeRequest(params)); err != nil {
+		return err
+	}
+
+	return g.orders.PlaceOrder(params, order)
+}
+
+// PlaceOrderOnce checks params like PlaceOrder. An order that already
+// exists under the client ID is returned unchecked, so a retry is not
+// rejected for counting against the limits twice.
+func (g *Guard) PlaceOrderOnce(
+	params *models.OrderParams, order *models.Order) (placed bool, err error) {
+
+	if params == nil || order == nil {
+		return false, models.ErrNilPtr
+	}
+
+	if params.ClientID == "" {
+		return false, api.ErrMissingClientID
+	}
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	if err = g.orders.GetOrderStatusByClientID(params.ClientID, order); err == nil {
+		return false, nil
+	}
+	if !api.IsNotFound(err) {
+		return false, err
+	}
+
+	if err = g.chain.Check(g.placeRequest(params)); err != nil {
+		return false, err
+	}
+
+	return g.orders.PlaceOrderOnce(params, order)
+}
+
+func (g *Guard) ModifyOrder(
+	orderID int64, params *models.ModifyOrderParams, order *models.Order) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	req, err := g.modifyRequest(orderID, params)
+	if err != nil {
+		return err
+	}
+
+	if err = g.chain.Check(req); err != nil {
+		return err
+	}
+
+	return g.orders.ModifyOrder(orderID, params, order)
+}
+
+// ModifyOrderByClientID checks the modify like ModifyOrder, so that a Guard
+// can stand in as algo.ModifyOrders.
+func (g *Guard) ModifyOrderByClientID(
+	clientID models.ClientOrderID, params *models.ModifyOrderParams, order *models.Order) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	existing := &models.Order{}
+	if err := g.orders.GetOrderStatusByClientID(clientID, existing); err != nil {
+		return err
+	}
+
+	if err := g.chain.Check(g.modifyRequestFor(existing, params)); err != nil {
+		return err
+	}
+
+	return g.orders.ModifyOrderByClientID(clientID, params, order)
+}
+
+func (g *Guard) GetOrderStatusByClientID(clientID models.ClientOrderID, order *models.Order) error {
+	return g.orders.GetOrderStatusByClientID(clientID, order)
+}
+
+func triggerRequest(params *models.TriggerOrderParams) *Request {
+
+	req := &Request{Action: Trigger, Type: models.MarketOrder}
+	if params.Market != nil {
+		req.Market = *params.Market
+	}
+	if params.Side != nil {
+		req.Side = *params.Side
+	}
+	if params.Size != nil {
+		req.Size = *params.Size
+	}
+	if params.ReduceOnly != nil {
+		req.ReduceOnly = *params.ReduceOnly
+	}
+	if params.TriggerPrice != nil {
+		req.Price = *params.TriggerPrice
+	}
+	if params.OrderPrice != nil && params.OrderPrice.Sign() > 0 {
+		req.Type, req.Price = models.LimitOrder, *params.OrderPrice
+	}
+
+	return req
+}
+
+func (g *Guard) PlaceTriggerOrder(
+	params *models.TriggerOrderParams, order *models.TriggerOrder) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	req := triggerRequest(params)
+	req.SubAccount = g.subAccount
+
+	if err := g.chain.Check(req); err != nil {
+		return err
+	}
+
+	return g.orders.PlaceTriggerOrder(params, order)
+}
+
+// ModifyTriggerOrder checks the trigger order as it will be after the
+// modify. Unknown trigger orders are left for the venue to reject.
+func (g *Guard) ModifyTriggerOrder(
+	orderID int64, params *models.ModifyTriggerOrderParams, order *models.TriggerOrder) error {
+
+	if params == nil || order == nil {
+		return models.ErrNilPtr
+	}
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	open, err := g.orders.GetOpenTriggerOrders(nil, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range open {
+
+		if t == nil || t.ID != orderID {
+			continue
+		}
+
+		modified := &models.TriggerOrderParams{
+			Market:       &t.Market,
+			Side:         &t.Side,
+			Size:         &t.Size,
+			TriggerPrice: &t.TriggerPrice,
+			OrderPrice:   &t.OrderPrice,
+			ReduceOnly:   &t.ReduceOnly,
+		}
+		if params.Size != nil {
+			modified.Size = params.Size
+		}
+		if params.TriggerPrice != nil {
+			modified.TriggerPrice = params.TriggerPrice
+		}
+		if params.OrderPrice != nil {
+			modified.OrderPrice = params.OrderPrice
+		}
+
+		req := triggerRequest(modified)
+		req.SubAccount = g.subAccount
+		req.Existing = &models.Order{
+			ID: t.ID, Market: t.Market, Side: t.Side, Size: t.Size, RemainingSize: t.Size,
+		}
+
+		if err = g.chain.Check(req); err != nil {
+			return err
+		}
+		break
+	}
+
+	return g.orders.ModifyTriggerOrder(orderID, params, order)
+}
+
+// PlaceOrders checks the orders in sequence, each seeing the earlier
+// accepted ones as pending, and sends the accepted ones in one batch.
+// Rejected orders carry their Rejection. With api.AllOrNothing a rejection
+// stops the whole batch.
+func (g *Guard) PlaceOrders(
+	params []*models.OrderParams, opts ...api.BatchOption) ([]api.PlaceResult, error) {
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	results := make([]api.PlaceResult, len(params))
+	accepted := make([]int, 0, len(params))
+	pending := make(map[string]decimal.Decimal)
+
+	for i, p := range params {
+
+		results[i].Params = p
+		if p == nil {
+			results[i].Err = models.ErrNilPtr
+			continue
+		}
+
+		req := g.placeRequest(p)
+		req.Pending, req.Orders = pending[p.Market], len(accepted)
+
+		if err := g.chain.Check(req); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		accepted = append(accepted, i)
+		pending[p.Market] = req.Pending.Add(req.signed(p.Size))
+	}
+
+	if len(accepted) < len(params) && api.IsAllOrNothing(opts...) {
+		for _, i := range accepted {
+			results[i].Err = api.ErrNotAttempted
+		}
+		return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+	}
+
+	if batch, ok := g.orders.(BatchOrders); ok {
+
+		subset := make([]*models.OrderParams, len(accepted))
+		for j, i := range accepted {
+			subset[j] = params[i]
+		}
+
+		placed, _ := batch.PlaceOrders(subset, opts...)
+		for j, i := range accepted {
+			if j < len(placed) {
+				results[i] = placed[j]
+			}
+		}
+	} else {
+		for _, i := range accepted {
+			order := &models.Order{}
+			if err := g.orders.PlaceOrder(params[i], order); err != nil {
+				results[i].Err = err
+				continue
+			}
+			results[i].Order = order
+		}
+	}
+
+	return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
+
+// ModifyOrders checks every modify and sends the accepted ones. With
+// api.AllOrNothing a rejection stops the whole batch.
+func (g *Guard) ModifyOrders(
+	requests []api.ModifyRequest, opts ...api.BatchOption) ([]api.ModifyResult, error) {
+
+	g.entry.Lock()
+	defer g.entry.Unlock()
+
+	results := make([]api.ModifyResult, len(requests))
+	accepted := make([]int, 0, len(requests))
+
+	for i, r := range requests {
+
+		results[i].OrderID = r.OrderID
+		if r.Params == nil {
+			results[i].Err = models.ErrNilPtr
+			continue
+		}
+
+		req, err := g.modifyRequest(r.OrderID, r.Params)
+		if err == nil {
+			err = g.chain.Check(req)
+		}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		accepted = append(accepted, i)
+	}
+
+	if len(accepted) < len(requests) && api.IsAllOrNothing(opts...) {
+		for _, i := range accepted {
+			results[i].Err = api.ErrNotAttempted
+		}
+		return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+	}
+
+	if batch, ok := g.orders.(BatchOrders); ok {
+
+		subset := make([]api.ModifyRequest, len(accepted))
+		for j, i := range accepted {
+			subset[j] = requests[i]
+		}
+
+		modified, _ := batch.ModifyOrders(subset, opts...)
+		for j, i := range accepted {
+			if j < len(modified) {
+				results[i] = modified[j]
+			}
+		}
+	} else {
+		for _, i := range accepted {
+			order := &models.Order{}
+			if err := g.orders.ModifyOrder(requests[i].OrderID, requests[i].Params, order); err != nil {
+				results[i].Err = err
+				continue
+			}
+			results[i].Order = order
+		}
+	}
+
+	return results, api.NewBatchError(len(results), func(i int) error { return results[i].Err })
+}
+
+func (g *Guard) GetOrderStatus(orderID int64, order *models.Order) error {
+	return g.orders.GetOrderStatus(orderID, order)
+}
+
+func (g *Guard) CancelOrder(orderID int64) (string, error) {
+	return g.orders.CancelOrder(orderID)
+}
+
+func (g *Guard) CancelTriggerOrder(orderID int64) (string, error) {
+	return g.orders.CancelTriggerOrder(orderID)
+}
+
+func (g *Guard) GetOpenTriggerOrders(
+	market *string, triggerType *models.TriggerOrderType) ([]*models.TriggerOrder, error) {
+	return g.orders.GetOpenTriggerOrders(market, triggerType)
+}
+
+func (g *Guard) GetTriggerOrderTriggers(orderID int64) ([]*models.Trigger, error) {
+	return g.orders.GetTriggerOrderTriggers(orderID)
+}
@@ -0,0 +1,209 @@
+package risk
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+type Reason string
+
+const (
+	KillSwitch       = Reason("kill_switch")
+	MaxOrderNotional = Reason("max_order_notional")
+	MaxPosition      = Reason("max_position")
+	PriceCollar      = Reason("price_collar")
+	MaxOpenOrders    = Reason("max_open_orders")
+	MaxOrderRate     = Reason("max_order_rate")
+	NoReferencePrice = Reason("no_reference_price")
+	CheckFailed      = Reason("check_failed")
+)
+
+// Rejection is returned for an order a check refused. It is never sent to
+// the venue.
+type Rejection struct {
+	Reason  Reason
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("risk rejected (%s): %s", r.Reason, r.Message)
+}
+
+func reject(reason Reason, format string, args ...interface{}) error {
+	return errors.WithStack(&Rejection{Reason: reason, Message: fmt.Sprintf(format, args...)})
+}
+
+// AsRejection returns the rejection in err's chain, if any.
+func AsRejection(err error) (*Rejection, bool) {
+	var r *Rejection
+	ok := errors.As(err, &r)
+	return r, ok
+}
+
+type Action string
+
+const (
+	Place   = Action("place")
+	Modify  = Action("modify")
+	Trigger = Action("trigger")
+)
+
+// Limits are the hard limits of a subaccount. Zero values are unlimited.
+// MaxPosition is the absolute size allowed per market after every open
+// order on the same side fills; MarketMaxPosition overrides it by market.
+// PriceCollar is the fraction a limit price may be through the opposite
+// side of the ticker, e.g. 0.05 for 5%. MaxOrderRate is in orders per
+// second.
+type Limits struct {
+	MaxOrderNotional  decimal.Decimal
+	MaxPosition       decimal.Decimal
+	MarketMaxPosition map[string]decimal.Decimal
+	PriceCollar       decimal.Decimal
+	MaxOpenOrders     int
+	MaxOrderRate      float64
+}
+
+func (l *Limits) maxPosition(market string) decimal.Decimal {
+	if max, ok := l.MarketMaxPosition[market]; ok {
+		return max
+	}
+	return l.MaxPosition
+}
+
+// Request is an order entry as seen by the checks. Size is the size of
+// the order after the request and Price its limit price, zero for market
+// orders. For modifies Existing is the order being replaced; for triggers
+// Price is the order price or else the trigger price. Earlier orders of
+// the same batch are not yet visible at the venue: Pending is their net
+// signed size in the market and Orders their count.
+type Request struct {
+	Action     Action
+	SubAccount string
+	Market     string
+	Side       models.OrderSide
+	Type       models.OrderType
+	Size       decimal.Decimal
+	Price      decimal.Decimal
+	ReduceOnly bool
+	Existing   *models.Order
+	Pending    decimal.Decimal
+	Orders     int
+	Limits     Limits
+}
+
+func (r *Request) signed(size decimal.Decimal) decimal.Decimal {
+	if r.Side == models.Sell {
+		return size.Neg()
+	}
+	return size
+}
+
+type RiskCheck interface {
+	Check(req *Request) error
+}
+
+type CheckFunc func(req *Request) error
+
+func (f CheckFunc) Check(req *Request) error {
+	return f(req)
+}
+
+// Chain runs every check in order and stops at the first rejection. The
+// kill switch is checked first. A chain may be shared by the guards of
+// several subaccounts, each getting its own limits; checks reading account
+// state then need the sources of each subaccount, see
+// PositionCheck.SetSources.
+type Chain struct {
+	mu       *sync.RWMutex
+	defaults Limits
+	limits   map[string]Limits
+	checks   []RiskCheck
+	killed   string
+	entries  map[string]*sync.Mutex
+}
+
+func NewChain(defaults Limits, checks ...RiskCheck) *Chain {
+	return &Chain{
+		mu:       &sync.RWMutex{},
+		defaults: defaults,
+		limits:   make(map[string]Limits),
+		checks:   checks,
+		entries:  make(map[string]*sync.Mutex),
+	}
+}
+
+// entryLock returns the lock serializing the order entry of a subaccount.
+func (c *Chain) entryLock(subAccount string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mu, ok := c.entries[subAccount]
+	if !ok {
+		mu = &sync.Mutex{}
+		c.entries[subAccount] = mu
+	}
+	return mu
+}
+
+// SetLimits sets the limits of a subaccount, "" being the main account.
+func (c *Chain) SetLimits(subAccount string, limits Limits) {
+	c.mu.Lock()
+	c.limits[subAccount] = limits
+	c.mu.Unlock()
+}
+
+func (c *Chain) Limits(subAccount string) Limits {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if limits, ok := c.limits[subAccount]; ok {
+		return limits
+	}
+	return c.defaults
+}
+
+// Kill rejects every order entry until Resume. Cancels still go through.
+func (c *Chain) Kill(reason string) {
+	if reason == "" {
+		reason = "killed"
+	}
+	c.mu.Lock()
+	c.killed = reason
+	c.mu.Unlock()
+}
+
+func (c *Chain) Resume() {
+	c.mu.Lock()
+	c.killed = ""
+	c.mu.Unlock()
+}
+
+func (c *Chain) Killed() (reason string, killed bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.killed, c.killed != ""
+}
+
+func (c *Chain) Check(req *Request) error {
+
+	if reason, killed := c.Killed(); killed {
+		return reject(KillSwitch, "%s", reason)
+	}
+
+	req.Limits = c.Limits(req.SubAccount)
+
+	for _, check := range c.checks {
+		if err := check.Check(req); err != nil {
+			if _, ok := AsRejection(err); ok {
+				return err
+			}
+			// A check that cannot decide fails closed
+			return errors.WithStack(&Rejection{Reason: CheckFailed, Message: err.Error()})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package testalgo
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/algo"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// book rests every order until the test fills or cancels it.
+type book struct {
+	mu        sync.Mutex
+	orders    map[int64]*models.Order
+	cancelled []int64
+}
+
+func newBook() *book {
+	return &book{orders: make(map[int64]*models.Order)}
+}
+
+func (b *book) PlaceOrder(params *models.OrderParams, order *models.Order) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	*order = models.Order{
+		ID:            int64(len(b.orders) + 1),
+		Market:        params.Market,
+		Side:          params.Side,
+		Type:          params.Type,
+		Price:         params.Price,
+		Size:          params.Size,
+		RemainingSize: params.Size,
+		Status:        models.Open,
+	}
+	o := *order
+	b.orders[order.ID] = &o
+
+	return nil
+}
+
+func (b *book) GetOrderStatus(id int64, order *models.Order) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*order = *b.orders[id]
+	return nil
+}
+
+func (b *book) CancelOrder(id int64) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.orders[id].Status = models.Closed
+	b.cancelled = append(b.cancelled, id)
+	return "Order queued for cancellation", nil
+}
+
+func placed(t *testing.T, events <-chan algo.Event) *models.Order {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("Events closed")
+			}
+			if event.Type == algo.ChildPlaced {
+				return event.Child
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No child placed")
+		}
+	}
+}
+
+func TestIceberg(t *testing.T) {
+
+	b, fillsC := newBook(), make(chan *models.FillResponse)
+	e := algo.NewIceberg(b,
+		algo.IcebergParams{
+			Market:        swap,
+			Side:          models.Buy,
+			Size:          d(3.05),
+			Price:         d(100),
+			Clip:          d(1),
+			ClipVariance:  d(0.2),
+			PriceVariance: d(1),
+			SizeIncrement: d(0.1),
+		},
+		algo.WithFills(fillsC),
+		algo.WithRand(rand.New(rand.NewSource(1))),
+		algo.WithPollInterval(time.Hour),
+	)
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	clips, filled := make([]*models.Order, 0), decimal.Zero
+	for i := int64(1); filled.LessThan(d(3)); i++ {
+		clip := placed(t, e.Events())
+		clips = append(clips, clip)
+		if !clip.Size.Mod(d(0.1)).IsZero() {
+			t.Fatalf("Clip size off the increment: %v", clip.Size)
+		}
+		if clip.Price.GreaterThan(d(100)) || clip.Price.LessThan(d(99)) {
+			t.Fatalf("Clip price outside the variance: %v", clip.Price)
+		}
+		// Fill in two parts, the second one twice
+		half := clip.Size.Div(d(2))
+		fillsC <- &models.FillResponse{Fill: models.Fill{ID: 2 * i, OrderID: clip.ID, Price: clip.Price, Size: half}}
+		second := &models.FillResponse{Fill: models.Fill{ID: 2*i + 1, OrderID: clip.ID, Price: clip.Price, Size: clip.Size.Sub(half)}}
+		fillsC <- second
+		select {
+		case fillsC <- second:
+		case <-e.Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		filled = filled.Add(clip.Size)
+	}
+
+	select {
+	case <-e.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Iceberg did not finish")
+	}
+
+	report := e.Report()
+	// The residual below the increment is left
+	if report.State != algo.StateCompleted || !report.FilledSize.Equal(d(3)) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	for _, clip := range clips[:len(clips)-1] {
+		if clip.Size.LessThan(d(0.8)) || clip.Size.GreaterThan(d(1.2)) {
+			t.Fatalf("Clip size outside the variance: %v", clip.Size)
+		}
+	}
+}
+
+func TestIceberg_Cancel(t *testing.T) {
+
+	b := newBook()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e := algo.NewIceberg(b, algo.IcebergParams{
+		Market: swap, Side: models.Sell, Size: d(3), Price: d(100), Clip: d(1),
+	})
+	if err := e.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	clip := placed(t, e.Events())
+	cancel()
+
+	select {
+	case <-e.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Iceberg did not stop")
+	}
+
+	report := e.Report()
+	if report.State != algo.StateCancelled || report.Err != context.Canceled {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if len(b.cancelled) != 1 || b.cancelled[0] != clip.ID {
+		t.Fatalf("Resting clip not cancelled: %v", b.cancelled)
+	}
+	if !report.FilledSize.Equal(decimal.Zero) {
+		t.Fatalf("Unexpected fill: %v", report.FilledSize)
+	}
+}
@@ -0,0 +1,458 @@
+package testalgo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/algo"
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// triggerVenue keeps orders and trigger orders until the test fills,
+// fires or cancels them.
+type triggerVenue struct {
+	mu           sync.Mutex
+	nextID       int64
+	orders       map[int64]*models.Order
+	triggers     map[int64]*models.TriggerOrder
+	fired        map[int64][]*models.Trigger
+	placed       int
+	reject       bool
+	rejectModify bool
+}
+
+func newTriggerVenue() *triggerVenue {
+	return &triggerVenue{
+		orders:   make(map[int64]*models.Order),
+		triggers: make(map[int64]*models.TriggerOrder),
+		fired:    make(map[int64][]*models.Trigger),
+	}
+}
+
+func (v *triggerVenue) PlaceOrder(params *models.OrderParams, order *models.Order) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.nextID++
+	*order = models.Order{ID: v.nextID, Market: params.Market, Side: params.Side, Size: params.Size, Status: models.Open}
+	o := *order
+	v.orders[o.ID] = &o
+	return nil
+}
+
+func (v *triggerVenue) PlaceOrderOnce(params *models.OrderParams, order *models.Order) (bool, error) {
+	v.mu.Lock()
+	for _, o := range v.orders {
+		if params.ClientID != "" && o.ClientID == params.ClientID {
+			*order = *o
+			v.mu.Unlock()
+			return false, nil
+		}
+	}
+	if v.reject {
+		v.mu.Unlock()
+		return false, &api.APIError{StatusCode: http.StatusBadRequest, Message: "Not enough balances"}
+	}
+	v.mu.Unlock()
+	if err := v.PlaceOrder(params, order); err != nil {
+		return false, err
+	}
+	v.mu.Lock()
+	v.orders[order.ID].ClientID = params.ClientID
+	v.mu.Unlock()
+	order.ClientID = params.ClientID
+	return true, nil
+}
+
+func (v *triggerVenue) GetOrderStatus(id int64, order *models.Order) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	*order = *v.orders[id]
+	return nil
+}
+
+func (v *triggerVenue) CancelOrder(id int64) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.orders[id].Status = models.Closed
+	return "Order queued for cancellation", nil
+}
+
+func (v *triggerVenue) PlaceTriggerOrder(
+	params *models.TriggerOrderParams, order *models.TriggerOrder) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.reject {
+		return &api.APIError{StatusCode: http.StatusBadRequest, Message: "Invalid reduce-only order"}
+	}
+	v.placed++
+	v.nextID++
+	*order = models.TriggerOrder{
+		ID: v.nextID, Market: *params.Market, Side: *params.Side, Size: *params.Size,
+		Type: *params.Type, Status: models.Open, ReduceOnly: *params.ReduceOnly,
+	}
+	if params.TriggerPrice != nil {
+		order.TriggerPrice = *params.TriggerPrice
+	}
+	o := *order
+	v.triggers[o.ID] = &o
+	return nil
+}
+
+func (v *triggerVenue) ModifyTriggerOrder(
+	id int64, params *models.ModifyTriggerOrderParams, order *models.TriggerOrder) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.rejectModify {
+		return &api.APIError{StatusCode: http.StatusBadRequest, Message: "Invalid reduce-only order"}
+	}
+	o := *v.triggers[id]
+	delete(v.triggers, id)
+	v.nextID++
+	o.ID, o.Size = v.nextID, *params.Size
+	v.triggers[o.ID] = &o
+	*order = o
+	return nil
+}
+
+func (v *triggerVenue) CancelTriggerOrder(id int64) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.triggers, id)
+	return "Order cancelled", nil
+}
+
+func (v *triggerVenue) GetOpenTriggerOrders(
+	market *string, t *models.TriggerOrderType) ([]*models.TriggerOrder, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	result := make([]*models.TriggerOrder, 0)
+	for id, o := range v.triggers {
+		if len(v.fired[id]) == 0 && (t == nil || o.Type == *t) {
+			c := *o
+			result = append(result, &c)
+		}
+	}
+	return result, nil
+}
+
+func (v *triggerVenue) GetTriggerOrderTriggers(id int64) ([]*models.Trigger, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.fired[id], nil
+}
+
+func (v *triggerVenue) fillEntry(id int64, filled float64, closed bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.orders[id].FilledSize = d(filled)
+	if closed {
+		v.orders[id].Status = models.Closed
+	}
+}
+
+// fire triggers the trigger orders of type t, the order they send having
+// filled filled and being closed if closed.
+func (v *triggerVenue) fire(t models.TriggerOrderType, filled float64, closed bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for id, o := range v.triggers {
+		if o.Type != t {
+			continue
+		}
+		size, _ := o.Size.Float64()
+		v.fired[id] = []*models.Trigger{{FilledSize: filled, OrderSize: size, OrderID: id + 1000}}
+		sent := &models.Order{ID: id + 1000, Size: o.Size, FilledSize: d(filled), Status: models.Open}
+		if closed {
+			sent.Status = models.Closed
+		}
+		v.orders[sent.ID] = sent
+	}
+}
+
+// sizes returns the size of the resting trigger order of each type.
+func (v *triggerVenue) sizes() map[models.TriggerOrderType]decimal.Decimal {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	result := make(map[models.TriggerOrderType]decimal.Decimal)
+	for id, o := range v.triggers {
+		if len(v.fired[id]) == 0 {
+			result[o.Type] = o.Size
+		}
+	}
+	return result
+}
+
+func eventually(t *testing.T, what string, f func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func legs() (stop, takeProfit models.TriggerOrderParams) {
+	stop = models.TriggerOrderParams{
+		Type: api.PtrTriggerOrderType(models.Stop), TriggerPrice: api.PtrDecimal(d(90)),
+	}
+	takeProfit = models.TriggerOrderParams{
+		Type: api.PtrTriggerOrderType(models.TakeProfit), TriggerPrice: api.PtrDecimal(d(120)),
+	}
+	return
+}
+
+func hasSizes(v *triggerVenue, stop, takeProfit float64) func() bool {
+	return func() bool {
+		sizes := v.sizes()
+		match := func(t models.TriggerOrderType, size float64) bool {
+			s, ok := sizes[t]
+			return (size == 0 && !ok) || (ok && s.Equal(d(size)))
+		}
+		return match(models.Stop, stop) && match(models.TakeProfit, takeProfit)
+	}
+}
+
+func TestBracket(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "linked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := algo.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := newTriggerVenue()
+	entry := models.OrderParams{
+		Market: swap, Side: models.Buy, Type: models.LimitOrder, Price: d(100), Size: d(2),
+	}
+	stop, takeProfit := legs()
+
+	b, err := algo.NewBracket(v, store, "b1", entry, stop, takeProfit, algo.WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = b.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "entry", func() bool { return b.Snapshot().EntryOrderID != 0 })
+	entryID := b.Snapshot().EntryOrderID
+
+	v.fillEntry(entryID, 1, false)
+	eventually(t, "legs placed", hasSizes(v, 1, 1))
+
+	// Restart: the saved state is resumed without placing anything twice
+	cancel()
+	<-b.Done()
+
+	b, err = algo.ResumeLinked(v, store, "b1", algo.WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	v.fillEntry(entryID, 2, true)
+	eventually(t, "legs resized", hasSizes(v, 2, 2))
+
+	// The stop working its full size takes the take profit off at once
+	v.fire(models.Stop, 0.5, false)
+	eventually(t, "take profit cancelled", hasSizes(v, 0, 0))
+
+	// The stop order closing short puts the take profit back for the rest
+	v.fire(models.Stop, 0.5, true)
+	eventually(t, "take profit placed", hasSizes(v, 0, 1.5))
+
+	v.fire(models.TakeProfit, 1.5, true)
+
+	select {
+	case <-b.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Bracket did not finish")
+	}
+
+	if b.State() != algo.StateCompleted {
+		t.Fatalf("Unexpected state: %s", b.State())
+	}
+	if v.placed != 3 {
+		t.Fatalf("Legs placed %d times", v.placed)
+	}
+
+	saved, err := store.Load("b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.State != algo.StateCompleted || !saved.EntryFilled.Equal(d(2)) {
+		t.Fatalf("Unexpected saved state: %+v", saved)
+	}
+	if _, err = algo.ResumeLinked(v, store, "b1"); err != algo.ErrFinished {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestOCO_Cancel(t *testing.T) {
+
+	v := newTriggerVenue()
+	stop, takeProfit := legs()
+	stop.Side, takeProfit.Side = api.PtrOrderSide(models.Sell), api.PtrOrderSide(models.Sell)
+	stop.ReduceOnly, takeProfit.ReduceOnly = api.PtrBool(true), api.PtrBool(true)
+
+	o, err := algo.NewOCO(v, algo.NewMemoryStore(), "o1", swap, d(3),
+		[]models.TriggerOrderParams{stop, takeProfit}, algo.WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "legs placed", hasSizes(v, 3, 3))
+
+	o.Cancel()
+	<-o.Done()
+
+	if o.State() != algo.StateCancelled || !hasSizes(v, 0, 0)() {
+		t.Fatalf("Legs not cancelled: %s %v", o.State(), v.sizes())
+	}
+}
+
+func TestBracket_Rejected(t *testing.T) {
+
+	v := newTriggerVenue()
+	v.reject = true
+
+	entry := models.OrderParams{
+		Market: swap, Side: models.Buy, Type: models.LimitOrder, Price: d(100), Size: d(2),
+	}
+	stop, takeProfit := legs()
+
+	store := algo.NewMemoryStore()
+	b, err := algo.NewBracket(v, store, "b2", entry, stop, takeProfit, algo.WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-b.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rejected bracket did not finish")
+	}
+
+	if b.State() != algo.StateFailed {
+		t.Fatalf("Unexpected state: %s", b.State())
+	}
+	saved, err := store.Load("b2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.State != algo.StateFailed || len(v.orders) != 0 {
+		t.Fatalf("Unexpected saved state: %+v", saved)
+	}
+}
+
+func TestBracket_ResizeRejected(t *testing.T) {
+
+	v := newTriggerVenue()
+	entry := models.OrderParams{
+		Market: swap, Side: models.Buy, Type: models.LimitOrder, Price: d(100), Size: d(2),
+	}
+	stop, takeProfit := legs()
+
+	store := algo.NewMemoryStore()
+	b, err := algo.NewBracket(v, store, "b3", entry, stop, takeProfit, algo.WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "entry", func() bool { return b.Snapshot().EntryOrderID != 0 })
+	entryID := b.Snapshot().EntryOrderID
+
+	v.fillEntry(entryID, 1, false)
+	eventually(t, "legs placed", hasSizes(v, 1, 1))
+
+	v.mu.Lock()
+	v.rejectModify = true
+	v.mu.Unlock()
+	v.fillEntry(entryID, 2, true)
+
+	select {
+	case <-b.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Bracket with a rejected resize did not finish")
+	}
+
+	if b.State() != algo.StateFailed {
+		t.Fatalf("Unexpected state: %s", b.State())
+	}
+	saved, err := store.Load("b3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leg := range saved.Legs {
+		if leg.Pending {
+			t.Fatalf("Leg left pending: %+v", leg)
+		}
+	}
+}
+
+func TestOCO_ResumePending(t *testing.T) {
+
+	v := newTriggerVenue()
+	stop, takeProfit := legs()
+	stop.Side, takeProfit.Side = api.PtrOrderSide(models.Sell), api.PtrOrderSide(models.Sell)
+	stop.ReduceOnly, takeProfit.ReduceOnly = api.PtrBool(true), api.PtrBool(true)
+	stop.Market, takeProfit.Market = api.PtrString(swap), api.PtrString(swap)
+
+	// The stop reached the venue but the process died before its response
+	sent := stop
+	sent.Size = api.PtrDecimal(d(3))
+	if err := v.PlaceTriggerOrder(&sent, &models.TriggerOrder{}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := algo.NewMemoryStore()
+	err := store.Save(&algo.LinkedState{
+		ID: "o2", Market: swap, Size: d(3), State: algo.StateRunning,
+		Legs: []algo.Leg{{Params: stop, Size: d(3), Pending: true}, {Params: takeProfit}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := algo.ResumeLinked(v, store, "o2", algo.WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = o.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "legs placed", hasSizes(v, 3, 3))
+	eventually(t, "stop adopted", func() bool { return o.Snapshot().Legs[0].OrderID != 0 })
+
+	if v.placed != 2 {
+		t.Fatalf("Legs placed %d times", v.placed)
+	}
+}
@@ -0,0 +1,142 @@
+package testalgo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/algo"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/paper"
+)
+
+var _ algo.ModifyOrders = (*paper.Engine)(nil)
+
+func top(rt models.ResponseType, bid, ask float64) *models.OrderBookResponse {
+	return &models.OrderBookResponse{
+		OrderBook: models.OrderBook{
+			Bids: [][]decimal.Decimal{{d(bid), d(10)}},
+			Asks: [][]decimal.Decimal{{d(ask), d(10)}},
+		},
+		BaseResponse: models.BaseResponse{ResponseType: rt, Symbol: swap},
+	}
+}
+
+func next(t *testing.T, events <-chan algo.Event, eventType algo.EventType) algo.Event {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("Events closed before %s", eventType)
+			}
+			if event.Type == eventType {
+				return event
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No %s event", eventType)
+		}
+	}
+}
+
+func TestPegged(t *testing.T) {
+
+	engine := paper.New()
+	engine.ApplyBook(top(models.Partial, 99, 101))
+
+	e := algo.NewPegged(engine, engine, algo.PegParams{
+		Market:   swap,
+		Side:     models.Buy,
+		Size:     d(2),
+		Peg:      algo.PegBest,
+		MaxChase: d(1.5),
+		PostOnly: true,
+	}, algo.WithPollInterval(5*time.Millisecond))
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	first := next(t, e.Events(), algo.ChildPlaced).Child
+	if !first.Price.Equal(d(99)) {
+		t.Fatalf("Unexpected price: %s", first.Price)
+	}
+
+	engine.ApplyBook(top(models.Partial, 100, 101))
+	repriced := next(t, e.Events(), algo.ChildRepriced).Child
+	if !repriced.Price.Equal(d(100)) || repriced.ID == first.ID {
+		t.Fatalf("Unexpected reprice: %+v", repriced)
+	}
+
+	// The chase stops 1.5 above the first price
+	engine.ApplyBook(top(models.Partial, 102, 103))
+	repriced = next(t, e.Events(), algo.ChildRepriced).Child
+	if !repriced.Price.Equal(d(100.5)) {
+		t.Fatalf("Unexpected reprice: %s", repriced.Price)
+	}
+
+	engine.ApplyTrade(&models.TradeResponse{
+		Trade:        models.Trade{Side: string(models.Sell), Price: d(100), Size: d(5)},
+		BaseResponse: models.BaseResponse{ResponseType: models.Update, Symbol: swap},
+	})
+
+	select {
+	case <-e.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pegged order not done")
+	}
+
+	report := e.Report()
+	if report.State != algo.StateCompleted || !report.FilledSize.Equal(d(2)) ||
+		!report.AvgFillPrice.Equal(d(100.5)) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	ids := e.OrderIDs()
+	if len(ids) != 3 || ids[2] != repriced.ID {
+		t.Fatalf("Unexpected order IDs: %v", ids)
+	}
+}
+
+func TestPegged_Cancel(t *testing.T) {
+
+	engine := paper.New()
+
+	e := algo.NewPegged(engine, engine, algo.PegParams{
+		Market:    swap,
+		Side:      models.Sell,
+		Size:      d(1),
+		Peg:       algo.PegMid,
+		Offset:    d(1),
+		Threshold: d(0.5),
+	}, algo.WithPollInterval(5*time.Millisecond))
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is placed until there is a book
+	engine.ApplyBook(top(models.Partial, 99, 101))
+	order := next(t, e.Events(), algo.ChildPlaced).Child
+	if !order.Price.Equal(d(101)) {
+		t.Fatalf("Unexpected price: %s", order.Price)
+	}
+
+	// Below the threshold
+	engine.ApplyBook(top(models.Partial, 99.2, 101.2))
+	time.Sleep(50 * time.Millisecond)
+	if ids := e.OrderIDs(); len(ids) != 1 {
+		t.Fatalf("Repriced below the threshold: %v", ids)
+	}
+
+	e.Cancel()
+	<-e.Done()
+
+	if e.State() != algo.StateCancelled {
+		t.Fatalf("Unexpected state: %s", e.State())
+	}
+	if open, _ := engine.GetOpenOrders(swap); len(open) != 0 {
+		t.Fatalf("Order left open: %+v", open)
+	}
+}
@@ -0,0 +1,233 @@
+package testalgo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/algo"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const swap = "BTC-PERP"
+
+func d(v float64) decimal.Decimal {
+	return decimal.NewFromFloat(v)
+}
+
+// venue fills every order in full at a fixed price.
+type venue struct {
+	mu     sync.Mutex
+	price  decimal.Decimal
+	orders map[int64]models.Order
+	placed []models.OrderParams
+}
+
+func newVenue(price float64) *venue {
+	return &venue{price: d(price), orders: make(map[int64]models.Order)}
+}
+
+func (v *venue) PlaceOrder(params *models.OrderParams, order *models.Order) error {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.placed = append(v.placed, *params)
+	*order = models.Order{
+		ID:           int64(len(v.placed)),
+		Market:       params.Market,
+		Side:         params.Side,
+		Type:         params.Type,
+		Size:         params.Size,
+		FilledSize:   params.Size,
+		AvgFillPrice: v.price,
+		Status:       models.Closed,
+		ClientID:     params.ClientID,
+	}
+	v.orders[order.ID] = *order
+
+	return nil
+}
+
+func (v *venue) GetOrderStatus(id int64, order *models.Order) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	*order = v.orders[id]
+	return nil
+}
+
+func (v *venue) CancelOrder(id int64) (string, error) {
+	return "Order queued for cancellation", nil
+}
+
+func (v *venue) sizes() []decimal.Decimal {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	result := make([]decimal.Decimal, len(v.placed))
+	for i, p := range v.placed {
+		result[i] = p.Size
+	}
+	return result
+}
+
+type history []*models.HistoricalPrice
+
+func (h history) GetHistoricalPrices(
+	string, *models.GetHistoricalPricesParams) ([]*models.HistoricalPrice, error) {
+	return h, nil
+}
+
+func parent(size float64, slices int, length time.Duration) algo.Parent {
+	start := time.Now()
+	return algo.Parent{
+		Market: swap,
+		Side:   models.Buy,
+		Size:   d(size),
+		Start:  start,
+		End:    start.Add(length),
+		Slices: slices,
+	}
+}
+
+func wait(t *testing.T, e *algo.ScheduleExecutor) algo.Report {
+	select {
+	case <-e.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Executor did not finish")
+	}
+	return e.Report()
+}
+
+func TestTWAP(t *testing.T) {
+
+	v := newVenue(100)
+	e := algo.NewTWAP(v, parent(4, 4, 200*time.Millisecond),
+		algo.WithClientIDs(models.NewPrefixedClientIDs("twap", models.NewMonotonicClientIDs(0))))
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	report := wait(t, e)
+	if report.State != algo.StateCompleted || !report.FilledSize.Equal(d(4)) ||
+		!report.AvgFillPrice.Equal(d(100)) || len(report.Children) != 4 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	for _, size := range v.sizes() {
+		if !size.Equal(d(1)) {
+			t.Fatalf("Unexpected child sizes: %v", v.sizes())
+		}
+	}
+	if report.Children[3].ClientID != "twap:4" {
+		t.Fatalf("Unexpected client id: %s", report.Children[3].ClientID)
+	}
+}
+
+func TestVWAP(t *testing.T) {
+
+	p := parent(8, 2, 2*time.Hour)
+
+	// Yesterday the second hour traded three times the volume of the first
+	h := history{
+		{StartTime: p.Start.Add(-24 * time.Hour), Close: d(10), Volume: d(1000)},
+		{StartTime: p.Start.Add(-23 * time.Hour), Close: d(10), Volume: d(3000)},
+	}
+
+	profile := algo.VolumeProfile(h, p.Start, p.End, 2)
+	if !profile[0].Equal(d(100)) || !profile[1].Equal(d(300)) {
+		t.Fatalf("Unexpected profile: %v", profile)
+	}
+
+	v := newVenue(100)
+	e := algo.NewVWAP(v, h, p)
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first slice is due: a quarter of the parent
+	time.Sleep(100 * time.Millisecond)
+	if sizes := v.sizes(); len(sizes) != 1 || !sizes[0].Equal(d(2)) {
+		t.Fatalf("Unexpected child sizes: %v", sizes)
+	}
+
+	e.Cancel()
+	if report := wait(t, e); report.State != algo.StateCancelled || !report.FilledSize.Equal(d(2)) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+}
+
+func TestTWAP_PauseResume(t *testing.T) {
+
+	v := newVenue(100)
+	e := algo.NewTWAP(v, parent(4, 4, 400*time.Millisecond))
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	e.Pause()
+	time.Sleep(200 * time.Millisecond)
+
+	if n := len(v.sizes()); n != 1 {
+		t.Fatalf("Children placed while paused: %d", n)
+	}
+
+	e.Resume()
+
+	report := wait(t, e)
+	if report.State != algo.StateCompleted || !report.FilledSize.Equal(d(4)) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	// The missed slices are caught up in one child
+	if sizes := v.sizes(); len(sizes) != 3 || !sizes[1].Equal(d(2)) {
+		t.Fatalf("Unexpected child sizes: %v", sizes)
+	}
+
+	states := make([]algo.State, 0)
+	for event := range e.Events() {
+		if event.Type == algo.StateChanged {
+			states = append(states, event.State)
+		}
+	}
+	expected := []algo.State{algo.StatePaused, algo.StateRunning, algo.StateCompleted}
+	if len(states) != len(expected) {
+		t.Fatalf("Unexpected state events: %v", states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatalf("Unexpected state events: %v", states)
+		}
+	}
+}
+
+func TestTWAP_Invalid(t *testing.T) {
+
+	p := parent(1, 2, time.Second)
+	p.ParticipationCap = d(0.1)
+
+	if err := algo.NewTWAP(newVenue(1), p).Start(context.Background()); err != algo.ErrNoPriceHistory {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// No volume profile for windows longer than a day
+	p = parent(1, 2, 25*time.Hour)
+	p.ParticipationCap = d(0.1)
+	h := history{{StartTime: p.Start.Add(-24 * time.Hour), Close: d(10), Volume: d(1000)}}
+
+	e := algo.NewTWAP(newVenue(1), p, algo.WithHistory(h))
+	if err := e.Start(context.Background()); err != algo.ErrNoVolume {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report := e.Report(); report.State != algo.StateFailed {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	p = parent(0, 2, time.Second)
+	if err := algo.NewTWAP(newVenue(1), p).Start(context.Background()); err != algo.ErrInvalidParent {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
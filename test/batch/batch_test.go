@@ -0,0 +1,165 @@
+package testbatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+// exchange answers order requests without touching the network.
+type exchange struct {
+	mu        sync.Mutex
+	nextID    int64
+	cancelled []string
+}
+
+func respond(req *http.Request, success bool, result interface{}) *http.Response {
+	body, _ := json.Marshal(map[string]interface{}{"success": success, "result": result, "error": "rejected"})
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}
+}
+
+func (e *exchange) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == "/api/orders":
+		params := models.OrderParams{}
+		if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+			return nil, err
+		}
+		if params.Market == "FAIL" {
+			return respond(req, false, nil), nil
+		}
+		e.nextID++
+		return respond(req, true, models.Order{ID: e.nextID, Market: params.Market}), nil
+	case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/api/orders/"):
+		e.cancelled = append(e.cancelled, strings.TrimPrefix(req.URL.Path, "/api/orders/"))
+		return respond(req, true, "Order queued for cancellation"), nil
+	}
+
+	return nil, fmt.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+}
+
+func client(e *exchange) *api.Client {
+	return api.New(
+		api.WithAuth("key", "secret"),
+		api.WithHTTPClient(&http.Client{Transport: e}),
+	)
+}
+
+func orders(markets ...string) []*models.OrderParams {
+	result := make([]*models.OrderParams, len(markets))
+	for i, m := range markets {
+		result[i] = &models.OrderParams{
+			Market: m,
+			Side:   models.Buy,
+			Type:   models.LimitOrder,
+			Price:  decimal.NewFromInt(100),
+			Size:   decimal.NewFromInt(1),
+		}
+	}
+	return result
+}
+
+func TestOrders_PlaceOrders(t *testing.T) {
+
+	ftx := client(&exchange{})
+
+	results, err := ftx.Orders.PlaceOrders(orders("A", "FAIL", "B"), api.WithConcurrency(2))
+
+	var berr *api.BatchError
+	if !errors.As(err, &berr) || berr.Failed != 1 || berr.Total != 3 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i, m := range []string{"A", "FAIL", "B"} {
+		if results[i].Params.Market != m {
+			t.Fatalf("Results should be in input order: %d %s", i, results[i].Params.Market)
+		}
+	}
+	if results[0].Err != nil || results[2].Err != nil || results[1].Err == nil {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+}
+
+func TestOrders_PlaceOrdersAllOrNothing(t *testing.T) {
+
+	e := &exchange{}
+	ftx := client(e)
+
+	results, err := ftx.Orders.PlaceOrders(
+		orders("A", "B", "FAIL", "C"), api.WithConcurrency(1), api.AllOrNothing())
+	if err == nil {
+		t.Fatal("Batch should fail")
+	}
+
+	expected := []error{api.ErrRolledBack, api.ErrRolledBack, nil, api.ErrNotAttempted}
+	for i, exp := range expected {
+		if exp == nil {
+			if results[i].Err == nil {
+				t.Fatalf("test #%d: expected an error", i+1)
+			}
+			continue
+		}
+		if !errors.Is(results[i].Err, exp) {
+			t.Fatalf("test #%d: expected %v, got %v", i+1, exp, results[i].Err)
+		}
+	}
+
+	if len(e.cancelled) != 2 {
+		t.Fatalf("Expected 2 rollback cancels, got %v", e.cancelled)
+	}
+}
+
+func TestOrders_CancelOrders(t *testing.T) {
+
+	e := &exchange{}
+	ftx := client(e)
+
+	results, err := ftx.Orders.CancelOrders([]int64{3, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []int64{3, 1, 2} {
+		if results[i].OrderID != id || results[i].Err != nil {
+			t.Fatalf("Unexpected result: %+v", results[i])
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+
+	limiter := api.NewRateLimiter(100, 5)
+	start := time.Now()
+
+	for i := 0; i < 15; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 5 immediately, 10 more at 100 per second
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("Limiter too fast: %v", elapsed)
+	}
+}
@@ -0,0 +1,139 @@
+package testbuilder
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const swap = "BTC-PERP"
+
+var (
+	one   = decimal.NewFromInt(1)
+	price = decimal.NewFromInt(40000)
+)
+
+func TestOrderBuilder_Order(t *testing.T) {
+
+	params, err := models.NewLimitOrder(swap, models.Buy, price, one).
+		PostOnly().
+		ReduceOnly().
+		RejectAfter(time.Now().Add(time.Minute)).
+		ClientID("strat-1").
+		Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Type != models.LimitOrder || !params.PostOnly || !params.ReduceOnly {
+		t.Fatalf("Unexpected params: %+v", params)
+	}
+	if params.RejectAfterTs == nil {
+		t.Fatal("RejectAfterTs should be set")
+	}
+
+	params, err = models.NewMarketOrder(swap, models.Sell, one).IOC().Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"price":null`) {
+		t.Fatalf("Market order price should be null: %s", body)
+	}
+}
+
+func TestOrderBuilder_Trigger(t *testing.T) {
+
+	params, err := models.NewStopOrder(swap, models.Sell, price, one).
+		LimitPrice(price.Sub(one)).
+		CancelLimitOnTrigger(true).
+		Trigger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *params.Type != models.Stop || params.OrderPrice == nil || params.TriggerPrice == nil {
+		t.Fatalf("Unexpected params: %+v", params)
+	}
+
+	params, err = models.NewTrailingStopOrder(swap, models.Sell, one.Neg(), one).Trigger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *params.Type != models.TrailingStop || !params.TrailValue.Equal(one.Neg()) {
+		t.Fatalf("Unexpected params: %+v", params)
+	}
+}
+
+func TestOrderBuilder_Invalid(t *testing.T) {
+
+	tests := []struct {
+		build    func() error
+		expected error
+	}{
+		{
+			func() error {
+				_, err := models.NewLimitOrder(swap, models.Buy, price, one).IOC().PostOnly().Order()
+				return err
+			},
+			models.ErrIOCPostOnly,
+		},
+		{
+			func() error {
+				_, err := models.NewMarketOrder(swap, models.Buy, one).PostOnly().Order()
+				return err
+			},
+			models.ErrMarketPostOnly,
+		},
+		{
+			func() error {
+				_, err := models.NewLimitOrder(swap, models.Buy, price, decimal.Zero).Order()
+				return err
+			},
+			models.ErrInvalidOrderSize,
+		},
+		{
+			func() error {
+				_, err := models.NewStopOrder(swap, models.Sell, price, one).PostOnly().Trigger()
+				return err
+			},
+			models.ErrTriggerModifier,
+		},
+		{
+			func() error {
+				_, err := models.NewTrailingStopOrder(swap, models.Sell, one, one).Trigger()
+				return err
+			},
+			models.ErrInvalidTrailValue,
+		},
+		{
+			func() error {
+				_, err := models.NewTakeProfitOrder(swap, models.Sell, price, one).
+					CancelLimitOnTrigger(true).Trigger()
+				return err
+			},
+			models.ErrCancelLimitNoPrice,
+		},
+		{
+			func() error {
+				_, err := models.NewStopOrder(swap, models.Sell, price, one).Order()
+				return err
+			},
+			models.ErrNotARegularOrder,
+		},
+	}
+
+	for i, test := range tests {
+		if err := test.build(); !errors.Is(err, test.expected) {
+			t.Fatalf("test #%d: expected %v, got %v", i+1, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package testcandles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/candles"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const market = "BTC-PERP"
+
+func trade(at time.Time, price, size int64) *models.TradeResponse {
+	return &models.TradeResponse{
+		Trade: models.Trade{
+			Price: decimal.NewFromInt(price),
+			Size:  decimal.NewFromInt(size),
+			Time:  at,
+		},
+		BaseResponse: models.BaseResponse{Symbol: market},
+	}
+}
+
+func TestBuilder_OHLCV(t *testing.T) {
+
+	b := candles.New(nil, models.Minute, candles.WithGrace(5*time.Second))
+	t0 := time.Unix(1650000000-1650000000%60, 0)
+
+	b.Add(trade(t0.Add(10*time.Second), 100, 1))
+	b.Add(trade(t0.Add(30*time.Second), 105, 2))
+	// Out of order trade should become the open
+	b.Add(trade(t0.Add(5*time.Second), 98, 1))
+	b.Add(trade(t0.Add(50*time.Second), 101, 1))
+
+	if bars := b.Flush(t0.Add(62 * time.Second)); len(bars) != 0 {
+		t.Fatal("Bar should still be open in grace window")
+	}
+
+	// Late trade inside the grace window
+	b.Add(trade(t0.Add(59*time.Second), 110, 1))
+
+	bars := b.Flush(t0.Add(65 * time.Second))
+	if len(bars) != 1 {
+		t.Fatalf("Expected 1 closed bar, got %d", len(bars))
+	}
+
+	bar := bars[0]
+	expected := []struct {
+		name     string
+		got, exp decimal.Decimal
+	}{
+		{"open", bar.Open, decimal.NewFromInt(98)},
+		{"high", bar.High, decimal.NewFromInt(110)},
+		{"low", bar.Low, decimal.NewFromInt(98)},
+		{"close", bar.Close, decimal.NewFromInt(110)},
+		{"volume", bar.Volume, decimal.NewFromInt(100 + 210 + 98 + 101 + 110)},
+	}
+	for _, e := range expected {
+		if !e.got.Equal(e.exp) {
+			t.Fatalf("%s should be equal: %v, %v", e.name, e.got, e.exp)
+		}
+	}
+	if !bar.Closed || bar.Trades != 5 {
+		t.Fatalf("Unexpected bar: %+v", bar)
+	}
+
+	// Too late, bar already closed
+	if res := b.Add(trade(t0.Add(20*time.Second), 1, 1)); res != nil {
+		t.Fatal("Trade for closed bar should be dropped")
+	}
+	if b.Dropped() != 1 {
+		t.Fatalf("Expected 1 dropped trade, got %d", b.Dropped())
+	}
+}
+
+func TestBuilder_SeedAndGaps(t *testing.T) {
+
+	b := candles.New(nil, models.Minute)
+	t0 := time.Unix(1650000000-1650000000%60, 0)
+	now := t0.Add(150 * time.Second)
+
+	b.Seed(market, []*models.HistoricalPrice{
+		{StartTime: t0, Open: decimal.NewFromInt(1), High: decimal.NewFromInt(3),
+			Low: decimal.NewFromInt(1), Close: decimal.NewFromInt(2)},
+		{StartTime: t0.Add(time.Minute), Open: decimal.NewFromInt(2), High: decimal.NewFromInt(2),
+			Low: decimal.NewFromInt(2), Close: decimal.NewFromInt(2)},
+		{StartTime: t0.Add(2 * time.Minute), Open: decimal.NewFromInt(2), High: decimal.NewFromInt(4),
+			Low: decimal.NewFromInt(2), Close: decimal.NewFromInt(4)},
+	}, now)
+
+	if n := len(b.History(market)); n != 2 {
+		t.Fatalf("Expected 2 historical bars, got %d", n)
+	}
+
+	// Already counted in the seeded candle
+	b.Add(trade(now.Add(-time.Second), 50, 1))
+	b.Add(trade(now.Add(time.Second), 5, 1))
+
+	cur, ok := b.Current(market)
+	if !ok {
+		t.Fatal("Current bar should exist")
+	}
+	if !cur.High.Equal(decimal.NewFromInt(5)) || !cur.Close.Equal(decimal.NewFromInt(5)) {
+		t.Fatalf("Unexpected current bar: %+v", cur)
+	}
+
+	bars := b.Flush(t0.Add(4*time.Minute + 30*time.Second))
+	if len(bars) != 2 {
+		t.Fatalf("Expected 2 closed bars, got %d", len(bars))
+	}
+	if !bars[1].Open.Equal(decimal.NewFromInt(5)) || bars[1].Trades != 0 {
+		t.Fatalf("Gap should be filled with previous close: %+v", bars[1])
+	}
+}
@@ -0,0 +1,125 @@
+package testclientid
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+type exchange struct {
+	mu     sync.Mutex
+	orders map[models.ClientOrderID]models.Order
+	placed int
+	paths  []string
+}
+
+func respond(req *http.Request, status int, result interface{}, msg string) *http.Response {
+	body, _ := json.Marshal(map[string]interface{}{
+		"success": status == http.StatusOK, "result": result, "error": msg,
+	})
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}
+}
+
+func (e *exchange) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.paths = append(e.paths, req.URL.EscapedPath())
+
+	if req.Method == http.MethodPost {
+		params := models.OrderParams{}
+		if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+			return nil, err
+		}
+		e.placed++
+		order := models.Order{ID: int64(e.placed), Market: params.Market, ClientID: params.ClientID}
+		e.orders[params.ClientID] = order
+		return respond(req, http.StatusOK, order, ""), nil
+	}
+
+	id := models.ClientOrderID(strings.TrimPrefix(req.URL.Path, "/api/orders/by_client_id/"))
+	order, ok := e.orders[id]
+	if !ok {
+		return respond(req, http.StatusNotFound, nil, "Order not found"), nil
+	}
+
+	return respond(req, http.StatusOK, order, ""), nil
+}
+
+func TestGenerators(t *testing.T) {
+
+	mono := models.NewMonotonicClientIDs(41)
+	if id := mono.Next(); id != "42" {
+		t.Fatalf("Unexpected id: %s", id)
+	}
+
+	prefixed := models.NewPrefixedClientIDs("mm", models.NewMonotonicClientIDs(0))
+	if id := prefixed.Next(); id != "mm:1" || id.Prefix() != "mm" {
+		t.Fatalf("Unexpected id: %s", id)
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	random := models.NewRandomClientIDs()
+	a, b := random.Next(), random.Next()
+	if !uuid.MatchString(string(a)) || a == b {
+		t.Fatalf("Unexpected ids: %s %s", a, b)
+	}
+}
+
+func TestOrders_PlaceOrderOnce(t *testing.T) {
+
+	e := &exchange{orders: make(map[models.ClientOrderID]models.Order)}
+	ftx := api.New(
+		api.WithAuth("key", "secret"),
+		api.WithHTTPClient(&http.Client{Transport: e}),
+	)
+
+	params := &models.OrderParams{
+		Market:   "BTC-PERP",
+		Side:     models.Buy,
+		Type:     models.LimitOrder,
+		Price:    decimal.NewFromInt(100),
+		Size:     decimal.NewFromInt(1),
+		ClientID: "mm/quote 1",
+	}
+
+	order := &models.Order{}
+	placed, err := ftx.Orders.PlaceOrderOnce(params, order)
+	if err != nil || !placed || order.ID != 1 {
+		t.Fatalf("First placement failed: %v %v %+v", placed, err, order)
+	}
+
+	order = &models.Order{}
+	placed, err = ftx.Orders.PlaceOrderOnce(params, order)
+	if err != nil || placed || order.ID != 1 {
+		t.Fatalf("Retry should return the existing order: %v %v %+v", placed, err, order)
+	}
+	if e.placed != 1 {
+		t.Fatalf("Order placed %d times", e.placed)
+	}
+
+	if e.paths[0] != "/api/orders/by_client_id/mm%2Fquote%201" {
+		t.Fatalf("Client ID not escaped: %s", e.paths[0])
+	}
+
+	params.ClientID = ""
+	if _, err = ftx.Orders.PlaceOrderOnce(params, order); err != api.ErrMissingClientID {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package testfees
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/fees"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+var end = time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func fill(
+	id int64, market string, liquidity models.LiquidityType,
+	size, price string, fee float64, currency string, at time.Time) *models.Fill {
+
+	return &models.Fill{
+		ID:            id,
+		Market:        market,
+		BaseCurrency:  "BTC",
+		QuoteCurrency: "USD",
+		Liquidity:     string(liquidity),
+		Size:          d(size),
+		Price:         d(price),
+		Fee:           fee,
+		FeeCurrency:   currency,
+		Time:          at,
+	}
+}
+
+// history is newest first, like the venue pages it.
+func history() []*models.Fill {
+	return []*models.Fill{
+		fill(4, "BTC/USD", models.Taker, "0.5", "100", 0.001, "BTC", end.Add(-time.Hour)),
+		fill(3, "BTC-PERP", models.Taker, "1", "100", 0.07, "USD", end.Add(-25*time.Hour)),
+		fill(2, "BTC-PERP", models.Maker, "2", "100", 0.04, "USD", end.Add(-26*time.Hour)),
+		fill(1, "BTC-PERP", models.Maker, "10", "100", 0.2, "USD", end.Add(-20*24*time.Hour)),
+	}
+}
+
+type source struct {
+	fills []*models.Fill
+	calls int
+}
+
+func (s *source) GetFills(params *models.FillParams) ([]*models.Fill, error) {
+	s.calls++
+	var page []*models.Fill
+	for _, f := range s.fills {
+		if t := f.Time.Unix(); t >= *params.StartTime && t <= *params.EndTime {
+			page = append(page, f)
+		}
+		if len(page) == 2 {
+			break
+		}
+	}
+	return page, nil
+}
+
+func bucket(t *testing.T, buckets []fees.Bucket, key string) fees.Bucket {
+	t.Helper()
+	for _, b := range buckets {
+		if b.Key == key {
+			return b
+		}
+	}
+	t.Fatalf("no bucket %q in %+v", key, buckets)
+	return fees.Bucket{}
+}
+
+func TestBuild(t *testing.T) {
+
+	info := &models.AccountInformation{MakerFee: d("0.0002"), TakerFee: d("0.0007")}
+	r := fees.Build(history(), info, end.Add(-48*time.Hour), end)
+
+	if r.Total.Fills != 3 || !r.Total.Volume.Equal(d("350")) {
+		t.Fatalf("total %+v", r.Total)
+	}
+	// The BTC fee is valued at the fill price
+	if !r.Total.Fees.Equal(d("0.21")) || !r.Total.Rate.Equal(d("0.0006")) {
+		t.Errorf("total fees %s rate %s", r.Total.Fees, r.Total.Rate)
+	}
+
+	perp := bucket(t, r.ByMarket, "BTC-PERP")
+	if perp.Fills != 2 || !perp.Volume.Equal(d("300")) || !perp.Fees.Equal(d("0.11")) {
+		t.Errorf("perp %+v", perp)
+	}
+	maker := bucket(t, r.ByLiquidity, "maker")
+	if !maker.Rate.Equal(d("0.0002")) {
+		t.Errorf("maker %+v", maker)
+	}
+	if btc := bucket(t, r.ByCurrency, "BTC"); !btc.Fees.Equal(d("0.001")) || btc.Rate.Sign() != 0 {
+		t.Errorf("BTC fees are reported in BTC: %+v", btc)
+	}
+	if len(r.ByDay) != 2 || r.ByDay[0].Key != "2021-03-29" || r.ByDay[1].Fills != 1 {
+		t.Errorf("days %+v", r.ByDay)
+	}
+
+	// 200 maker at 2bp and 150 taker at 7bp
+	if !r.ScheduleRate.Equal(d("0.145").Div(d("350"))) {
+		t.Errorf("schedule rate %s", r.ScheduleRate)
+	}
+	if !r.RollingVolume.Equal(d("1350")) {
+		t.Errorf("rolling volume %s", r.RollingVolume)
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	src := &source{fills: history()}
+	r, err := fees.Load(src, nil, end.Add(-48*time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.calls < 2 {
+		t.Errorf("expected paging, got %d calls", src.calls)
+	}
+	if r.Total.Fills != 3 || !r.RollingVolume.Equal(d("1350")) {
+		t.Errorf("report %+v", r)
+	}
+	if r.ScheduleRate.Sign() != 0 {
+		t.Errorf("no schedule without account information: %s", r.ScheduleRate)
+	}
+}
+
+func TestExport(t *testing.T) {
+
+	r := fees.Build(history(), nil, end.Add(-48*time.Hour), end)
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, total, 2 markets, 2 liquidities, 2 currencies and 2 days
+	if len(rows) != 10 || rows[1][0] != "total" || rows[1][2] != "3" {
+		t.Errorf("rows %v", rows)
+	}
+
+	buf.Reset()
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &fees.Report{}
+	if err := json.Unmarshal(buf.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Total.Fees.Equal(r.Total.Fees) || len(decoded.ByMarket) != 2 {
+		t.Errorf("decoded %+v", decoded)
+	}
+}
@@ -0,0 +1,123 @@
+package testflatten
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/flatten"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/paper"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func newEngine(t *testing.T) *paper.Engine {
+
+	e := paper.New()
+	for _, market := range []string{"BTC-PERP", "ETH-PERP"} {
+		e.ApplyBook(&models.OrderBookResponse{
+			OrderBook: models.OrderBook{
+				Bids: [][]decimal.Decimal{{d("99"), d("100")}},
+				Asks: [][]decimal.Decimal{{d("101"), d("100")}},
+			},
+			BaseResponse: models.BaseResponse{ResponseType: models.Partial, Symbol: market},
+		})
+	}
+
+	order := &models.Order{}
+	for _, b := range []*models.OrderBuilder{
+		models.NewMarketOrder("BTC-PERP", models.Buy, d("3")),
+		models.NewMarketOrder("ETH-PERP", models.Sell, d("4")),
+		models.NewLimitOrder("BTC-PERP", models.Buy, d("90"), d("1")),
+	} {
+		params, _ := b.Order()
+		if err := e.PlaceOrder(params, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trigger := &models.TriggerOrder{}
+	if err := e.PlaceTriggerOrder(&models.TriggerOrderParams{
+		Market:       api.PtrString("BTC-PERP"),
+		Side:         api.PtrOrderSide(models.Buy),
+		Size:         api.PtrDecimal(d("1")),
+		Type:         api.PtrTriggerOrderType(models.Stop),
+		TriggerPrice: api.PtrDecimal(d("120")),
+	}, trigger); err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func net(t *testing.T, e *paper.Engine) map[string]decimal.Decimal {
+	positions, err := e.GetPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]decimal.Decimal)
+	for _, p := range positions {
+		result[p.Future] = p.NetSize
+	}
+	return result
+}
+
+func TestFlatten(t *testing.T) {
+
+	e := newEngine(t)
+
+	f := flatten.New(e, e,
+		flatten.WithSlippageCap(e, d("0.01")),
+		flatten.WithPollInterval(time.Millisecond))
+
+	result := f.Flatten(context.Background())
+	if result.Err != nil || len(result.Orders) != 2 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	for market, size := range net(t, e) {
+		if !size.IsZero() {
+			t.Fatalf("%s not flat: %s", market, size)
+		}
+	}
+
+	if open, _ := e.GetOpenOrders("BTC-PERP"); len(open) != 0 {
+		t.Fatalf("Orders left open: %+v", open)
+	}
+	if triggers, _ := e.GetOpenTriggerOrders(nil, nil); len(triggers) != 0 {
+		t.Fatalf("Trigger orders left open: %+v", triggers)
+	}
+}
+
+func TestReduce(t *testing.T) {
+
+	e := newEngine(t)
+
+	f := flatten.New(e, e,
+		flatten.WithMarkets("ETH-PERP"),
+		flatten.WithPollInterval(time.Millisecond))
+
+	if result := f.Reduce(context.Background(), d("0.25")); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	positions := net(t, e)
+	if !positions["ETH-PERP"].Equal(d("-1")) || !positions["BTC-PERP"].Equal(d("3")) {
+		t.Fatalf("Unexpected positions: %v", positions)
+	}
+
+	// Orders of other markets are left alone
+	if open, _ := e.GetOpenOrders("BTC-PERP"); len(open) != 1 {
+		t.Fatalf("Unexpected open orders: %+v", open)
+	}
+
+	if result := f.Reduce(context.Background(), d("1")); result.Err != flatten.ErrInvalidFraction {
+		t.Fatalf("Unexpected error: %v", result.Err)
+	}
+}
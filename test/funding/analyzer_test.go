@@ -0,0 +1,177 @@
+package testfunding
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/funding"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+var (
+	_ funding.Futures   = (*api.Futures)(nil)
+	_ funding.Positions = (*api.Account)(nil)
+)
+
+var end = time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+type venue struct {
+	futures   []*models.Future
+	stats     map[string]float64
+	rates     []*models.FundingRates
+	positions []*models.Position
+	pages     int
+}
+
+func (v *venue) GetFutures() ([]*models.Future, error) {
+	return v.futures, nil
+}
+
+func (v *venue) GetFutureStats(future string, stats *models.FutureStats) error {
+	rate, ok := v.stats[future]
+	if !ok {
+		return errors.New("no stats")
+	}
+	*stats = models.FutureStats{NextFundingRate: rate, NextFundingTime: end.Add(time.Hour)}
+	return nil
+}
+
+// GetFundingRates returns at most 3 rates, the most recent first.
+func (v *venue) GetFundingRates(params *models.FundingRatesParams) ([]*models.FundingRates, error) {
+	v.pages++
+	var page []*models.FundingRates
+	for i := len(v.rates) - 1; i >= 0 && len(page) < 3; i-- {
+		r := v.rates[i]
+		t := r.Time.Unix()
+		if r.Future == *params.Future && t >= *params.StartTime && t <= *params.EndTime {
+			page = append(page, r)
+		}
+	}
+	return page, nil
+}
+
+func (v *venue) GetPositions() ([]*models.Position, error) {
+	return v.positions, nil
+}
+
+func newVenue() *venue {
+
+	v := &venue{
+		futures: []*models.Future{
+			{Name: "BTC-PERP", Underlying: "BTC", Mark: d("100"), Perpetual: true, Enabled: true},
+			{Name: "ETH-PERP", Underlying: "ETH", Mark: d("10"), Perpetual: true, Enabled: true},
+			{Name: "SOL-PERP", Underlying: "SOL", Mark: d("1"), Perpetual: true, Enabled: true},
+			{Name: "BTC-0625", Underlying: "BTC", Mark: d("101"), Enabled: true},
+		},
+		stats: map[string]float64{"BTC-PERP": 0.0001, "ETH-PERP": -0.0003, "SOL-PERP": 0.0002},
+		positions: []*models.Position{
+			{Future: "BTC-PERP", NetSize: d("2")},
+			{Future: "ETH-PERP", NetSize: d("-5")},
+			{Future: "BTC-0625", NetSize: d("1")},
+		},
+	}
+
+	// 48 hourly BTC rates, 0.0002 in the last day and 0 before
+	for h := 47; h >= 0; h-- {
+		rate := 0.0
+		if h < 24 {
+			rate = 0.0002
+		}
+		v.rates = append(v.rates, &models.FundingRates{Future: "BTC-PERP", Rate: rate, Time: end.Add(-time.Duration(h) * time.Hour)})
+		v.rates = append(v.rates, &models.FundingRates{Future: "ETH-PERP", Rate: 1, Time: end.Add(-time.Duration(h) * time.Hour)})
+	}
+
+	return v
+}
+
+func TestHistory(t *testing.T) {
+
+	v := newVenue()
+	a := funding.New(v, v)
+
+	rates, err := a.History("BTC-PERP", end.Add(-47*time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 48 || v.pages < 16 {
+		t.Fatalf("%d rates in %d pages", len(rates), v.pages)
+	}
+	for i := 1; i < len(rates); i++ {
+		if !rates[i].Time.After(rates[i-1].Time) || rates[i].Future != "BTC-PERP" {
+			t.Fatalf("rate %d %+v after %+v", i, rates[i], rates[i-1])
+		}
+	}
+
+	realized := funding.Rolling(rates, end, 24*time.Hour, 48*time.Hour)
+	if realized[0].Samples != 24 || !realized[0].Mean.Equal(d("0.0002")) {
+		t.Errorf("day %+v", realized[0])
+	}
+	if !realized[0].Annualized.Equal(d("1.752")) {
+		t.Errorf("day annualized %s", realized[0].Annualized)
+	}
+	if realized[1].Samples != 48 || !realized[1].Total.Equal(d("0.0048")) {
+		t.Errorf("two days %+v", realized[1])
+	}
+}
+
+func TestRank(t *testing.T) {
+
+	v := newVenue()
+	carries, err := funding.New(v, v, funding.WithConcurrency(2)).Rank()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(carries) != 3 {
+		t.Fatalf("carries %+v", carries)
+	}
+	if carries[0].Future != "ETH-PERP" || carries[0].Side != models.Buy {
+		t.Errorf("first %+v", carries[0])
+	}
+	if carries[1].Future != "SOL-PERP" || carries[1].Side != models.Sell || carries[2].Future != "BTC-PERP" {
+		t.Errorf("order %+v", carries)
+	}
+
+	// The others are still ranked
+	delete(v.stats, "SOL-PERP")
+	carries, err = funding.New(v, v).Rank()
+	var statsErr *funding.StatsError
+	if !errors.As(err, &statsErr) || len(statsErr.Errs) != 1 || statsErr.Errs["SOL-PERP"] == nil {
+		t.Fatalf("expected the failed stats request: %v", err)
+	}
+	if len(carries) != 2 || carries[0].Future != "ETH-PERP" || carries[1].Future != "BTC-PERP" {
+		t.Errorf("partial ranking %+v", carries)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+
+	v := newVenue()
+	exposures, total, err := funding.New(v, v).Estimate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dated futures do not pay funding
+	if len(exposures) != 2 {
+		t.Fatalf("exposures %+v", exposures)
+	}
+	// Long 200 at 1bp pays 0.02, short 50 at -3bp pays 0.015
+	if btc := exposures[0]; btc.Future != "BTC-PERP" || !btc.Payment.Equal(d("0.02")) {
+		t.Errorf("BTC %+v", btc)
+	}
+	if eth := exposures[1]; !eth.Notional.Equal(d("-50")) || !eth.Payment.Equal(d("0.015")) {
+		t.Errorf("ETH %+v", eth)
+	}
+	if !total.Equal(d("0.035")) {
+		t.Errorf("total %s", total)
+	}
+}
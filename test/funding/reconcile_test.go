@@ -0,0 +1,175 @@
+package testfunding
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/funding"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/pnl"
+)
+
+var (
+	_ funding.Index      = (*api.Futures)(nil)
+	_ pnl.FundingHistory = (*api.Funding)(nil)
+)
+
+type account struct {
+	*venue
+	fills    []*models.Fill
+	payments []*models.FundingPayment
+	gap      time.Time
+}
+
+func (a *account) GetFills(params *models.FillParams) ([]*models.Fill, error) {
+	var page []*models.Fill
+	for i := len(a.fills) - 1; i >= 0; i-- {
+		if t := a.fills[i].Time.Unix(); t >= *params.StartTime && t <= *params.EndTime {
+			page = append(page, a.fills[i])
+		}
+	}
+	return page, nil
+}
+
+func (a *account) GetFundingPayments(future *string, start, end *int64) ([]*models.FundingPayment, error) {
+	var page []*models.FundingPayment
+	for i := len(a.payments) - 1; i >= 0; i-- {
+		if t := a.payments[i].Time.Unix(); t >= *start && t <= *end {
+			page = append(page, a.payments[i])
+		}
+	}
+	return page, nil
+}
+
+// GetHistoricalIndex returns hourly candles at 100, less the one at gap.
+func (a *account) GetHistoricalIndex(
+	indexName string, params *models.HistoricalIndexParams) ([]*models.HistoricalIndex, error) {
+
+	var page []*models.HistoricalIndex
+	for t := *params.StartTime; t <= *params.EndTime; t += 3600 {
+		if t == a.gap.Unix() {
+			continue
+		}
+		page = append(page, &models.HistoricalIndex{StartTime: time.Unix(t, 0), Open: d("99"), Close: d("101")})
+	}
+	return page, nil
+}
+
+func payment(id int64, payment string, at time.Duration) *models.FundingPayment {
+	return &models.FundingPayment{ID: id, Future: "BTC-PERP", Payment: d(payment), Rate: d("0.0001"), Time: end.Add(at)}
+}
+
+func newAccount() *account {
+
+	a := &account{
+		venue: &venue{
+			futures: []*models.Future{
+				{Name: "BTC-PERP", Underlying: "BTC", Mark: d("100"), Perpetual: true, Enabled: true},
+			},
+			positions: []*models.Position{{Future: "BTC-PERP", NetSize: d("2")}},
+		},
+		// Long 2 from 3h30 before end; the later round trip nets out
+		fills: []*models.Fill{
+			{ID: 1, Future: "BTC-PERP", Side: "buy", Size: d("2"), Time: end.Add(-210 * time.Minute)},
+			{ID: 2, Future: "BTC-PERP", Side: "sell", Size: d("1"), Time: end.Add(time.Hour)},
+			{ID: 3, Future: "BTC-PERP", Side: "buy", Size: d("1"), Time: end.Add(2 * time.Hour)},
+		},
+		payments: []*models.FundingPayment{
+			payment(1, "0.02", -4*time.Hour),
+			payment(2, "0.02", -3*time.Hour),
+			payment(3, "0.01", -2*time.Hour),
+			payment(4, "0.01", -2*time.Hour),
+			payment(5, "0.05", 0),
+		},
+	}
+
+	for h := 5; h >= 0; h-- {
+		a.rates = append(a.rates, &models.FundingRates{Future: "BTC-PERP", Rate: 0.0001, Time: end.Add(-time.Duration(h) * time.Hour)})
+	}
+
+	return a
+}
+
+func TestReconcile(t *testing.T) {
+
+	a := newAccount()
+	r := funding.NewReconciler(funding.Sources{
+		Fills: a, Payments: a, Positions: a, Futures: a, Index: a,
+	}, funding.WithSubAccount("SWAPS"))
+
+	result, err := r.Reconcile(end.Add(-5*time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.SubAccount != "SWAPS" || len(result.Futures) != 1 || result.Issues != 4 {
+		t.Fatalf("result %+v", result)
+	}
+
+	report := result.Futures[0]
+	if !report.Expected.Equal(d("0.08")) || !report.Paid.Equal(d("0.11")) {
+		t.Errorf("expected %s paid %s", report.Expected, report.Paid)
+	}
+
+	issues := []funding.Issue{funding.Unexpected, "", funding.Duplicate, funding.Missing, funding.Mismatch}
+	if len(report.Lines) != len(issues) {
+		t.Fatalf("lines %+v", report.Lines)
+	}
+	for i, line := range report.Lines {
+		if line.Issue != issues[i] {
+			t.Errorf("line %d at %s: %q, expected %q", i, line.Hour, line.Issue, issues[i])
+		}
+	}
+
+	// 2 at the index average of 100 and 1bp
+	if ok := report.Lines[1]; !ok.NetSize.Equal(d("2")) || !ok.Price.Equal(d("100")) || !ok.Expected.Equal(d("0.02")) {
+		t.Errorf("line %+v", ok)
+	}
+}
+
+func TestReconcile_Tolerance(t *testing.T) {
+
+	a := newAccount()
+	r := funding.NewReconciler(funding.Sources{
+		Fills: a, Payments: a, Positions: a, Futures: a, Index: a,
+	}, funding.WithTolerance(d("0"), d("0.05")))
+
+	result, err := r.Reconcile(end.Add(-5*time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the duplicate and the payment made while flat remain
+	if result.Issues != 2 {
+		t.Errorf("issues %d: %+v", result.Issues, result.Futures[0].Lines)
+	}
+}
+
+func TestReconcile_NoPrice(t *testing.T) {
+
+	a := newAccount()
+	// The candle pricing the funding 3h before end is missing
+	a.gap = end.Add(-4 * time.Hour)
+
+	r := funding.NewReconciler(funding.Sources{
+		Fills: a, Payments: a, Positions: a, Futures: a, Index: a,
+	})
+
+	result, err := r.Reconcile(end.Add(-5*time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := result.Futures[0]
+	if result.Issues != 5 || len(report.Lines) != 5 {
+		t.Fatalf("result %+v", result)
+	}
+	line := report.Lines[1]
+	if line.Issue != funding.NoPrice || !line.Expected.IsZero() || !line.Paid.Equal(d("0.02")) {
+		t.Errorf("line %+v", line)
+	}
+	if !report.Expected.Equal(d("0.06")) || !report.Paid.Equal(d("0.11")) {
+		t.Errorf("expected %s paid %s", report.Expected, report.Paid)
+	}
+}
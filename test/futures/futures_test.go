@@ -63,7 +63,7 @@ func TestFutures_GetFundingRates(t *testing.T) {
 
 	ftx := api.New()
 
-	rates, err := ftx.Futures.GetFundingRates()
+	rates, err := ftx.Futures.GetFundingRates(&models.FundingRatesParams{})
 	if err != nil {
 		t.Fatal(errors.WithStack(err))
 	}
@@ -0,0 +1,80 @@
+package testmargin
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/margin"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func newCalculator() *margin.Calculator {
+	return margin.New([]*models.Future{
+		{Name: "BTC-PERP", Underlying: "BTC", Mark: d("100"), ImfFactor: 0.002},
+		{Name: "BTC-0326", Underlying: "BTC", Mark: d("101"), ImfFactor: 0.002},
+		{Name: "ETH-PERP", Underlying: "ETH", Mark: d("10"), ImfFactor: 0.001},
+	}, &models.AccountInformation{
+		Collateral: d("200"),
+		Leverage:   d("10"),
+		Positions: []models.Position{
+			{Future: "BTC-PERP", NetSize: d("10"), LongOrderSize: d("5")},
+		},
+	})
+}
+
+func TestCalculator_Current(t *testing.T) {
+
+	report := newCalculator().Current()
+
+	if !report.Notional.Equal(d("1000")) || !report.MarginFraction.Equal(d("0.2")) ||
+		!report.Maintenance.Equal(d("30")) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	// The resting buy counts towards the initial requirement only
+	if !report.Initial.Equal(d("150")) || !report.FreeCollateral.Equal(d("50")) {
+		t.Fatalf("Unexpected initial requirement: %+v", report)
+	}
+
+	// 200 + 10 * (P - 100) = 10 * P * 0.03
+	if liq := report.Positions[0].Liquidation.Round(4); !liq.Equal(d("82.4742")) {
+		t.Fatalf("Unexpected liquidation price: %s", liq)
+	}
+}
+
+func TestCalculator_WhatIf(t *testing.T) {
+
+	c := newCalculator()
+
+	buy, _ := models.NewLimitOrder("BTC-PERP", models.Buy, d("100"), d("10")).Order()
+	report, err := c.After(buy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.MarginFraction.Equal(d("0.1")) {
+		t.Fatalf("Unexpected margin fraction: %s", report.MarginFraction)
+	}
+
+	// A 10% drop in BTC with a short dated hedge
+	hedge, _ := models.NewMarketOrder("BTC-0326", models.Sell, d("10")).Order()
+	report, err = c.Evaluate(margin.Scenario{
+		Orders: []*models.OrderParams{hedge},
+		Shocks: map[string]decimal.Decimal{"BTC": d("-0.1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.AccountValue.Equal(d("100")) || !report.Notional.Equal(d("1809")) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	unknown, _ := models.NewMarketOrder("SOL-PERP", models.Buy, d("1")).Order()
+	if _, err = c.After(unknown); err == nil {
+		t.Fatal("Expected an error for an unknown future")
+	}
+}
@@ -0,0 +1,140 @@
+package testmargin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/margin"
+)
+
+type exchange struct {
+	mu        sync.Mutex
+	fractions map[string]float64
+	requests  []string
+}
+
+func (e *exchange) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub := req.Header.Get("FTX-SUBACCOUNT")
+
+	var result interface{} = "ok"
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/api/account":
+		result = map[string]interface{}{
+			"marginFraction":               e.fractions[sub],
+			"maintenanceMarginRequirement": 0.03,
+			"totalPositionSize":            1000,
+		}
+	case req.Method == http.MethodPost && req.URL.Path == "/api/subaccounts/transfer":
+		body, _ := ioutil.ReadAll(req.Body)
+		e.requests = append(e.requests, "transfer "+string(body))
+		result = map[string]interface{}{"id": 1}
+	default:
+		e.requests = append(e.requests, req.Method+" "+req.URL.Path+" "+sub)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"success": true, "result": result})
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+func (e *exchange) set(sub string, fraction float64) {
+	e.mu.Lock()
+	e.fractions[sub] = fraction
+	e.mu.Unlock()
+}
+
+func (e *exchange) taken() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	taken := e.requests
+	e.requests = nil
+	return taken
+}
+
+func TestMonitor(t *testing.T) {
+
+	venue := &exchange{fractions: map[string]float64{"": 1, "mm": 0.2}}
+	client := api.New(
+		api.WithAuth("key", "secret"),
+		api.WithHTTPClient(&http.Client{Transport: venue}))
+
+	tiers := []margin.Tier{
+		{Name: "critical", Distance: d("0.03"), Actions: []margin.Action{margin.CancelOrders, margin.TopUp}},
+		{Name: "warning", Distance: d("0.1")},
+	}
+
+	m := margin.NewMonitor(client,
+		margin.WithSubAccounts("", "mm"),
+		margin.WithTiers(tiers...),
+		margin.WithTopUp("", "USD", d("500")))
+
+	ctx := context.Background()
+
+	check := func(expected ...string) []margin.Alert {
+		t.Helper()
+		alerts, err := m.Check(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != len(expected) {
+			t.Fatalf("Unexpected alerts: %+v", alerts)
+		}
+		for i, name := range expected {
+			if alerts[i].SubAccount != "mm" || alerts[i].Tier.Name != name {
+				t.Fatalf("Unexpected alert: %+v", alerts[i])
+			}
+		}
+		return alerts
+	}
+
+	check()
+
+	venue.set("mm", 0.1)
+	check("warning")
+	check()
+
+	venue.set("mm", 0.05)
+	alerts := check("critical")
+	if len(alerts[0].Actions) != 2 || alerts[0].Actions[1].Err != nil {
+		t.Fatalf("Unexpected actions: %+v", alerts[0].Actions)
+	}
+
+	taken := venue.taken()
+	if len(taken) != 2 || taken[0] != "DELETE /api/orders mm" {
+		t.Fatalf("Unexpected requests: %v", taken)
+	}
+	var transfer map[string]interface{}
+	if err := json.Unmarshal([]byte(taken[1][len("transfer "):]), &transfer); err != nil ||
+		transfer["destination"] != "mm" || transfer["source"] != nil {
+		t.Fatalf("Unexpected transfer: %s", taken[1])
+	}
+
+	// Clear of every tier re-arms, and a dry run only logs
+	venue.set("mm", 0.5)
+	check()
+
+	dry := margin.NewMonitor(client,
+		margin.WithSubAccounts("mm"),
+		margin.WithTiers(tiers...),
+		margin.WithDryRun())
+	venue.set("mm", 0.04)
+	alerts, _ = dry.Check(ctx)
+	if len(alerts) != 1 || !alerts[0].Actions[0].DryRun || len(venue.taken()) != 0 {
+		t.Fatalf("Unexpected dry run: %+v", alerts)
+	}
+}
@@ -0,0 +1,196 @@
+package testnormalize
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/normalize"
+	"github.com/sanjujosh/go-ftx/registry"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func instruments() *registry.Registry {
+	r := registry.New(nil)
+	r.Load([]*models.Market{
+		{
+			Name:           "BTC-PERP",
+			Underlying:     "BTC",
+			Type:           "future",
+			Enabled:        true,
+			PriceIncrement: dec("0.5"),
+			SizeIncrement:  dec("0.001"),
+			MinProvideSize: dec("0.002"),
+		},
+		{
+			Name:           "NEW-PERP",
+			Type:           "future",
+			Enabled:        true,
+			PostOnly:       true,
+			PriceIncrement: dec("0.01"),
+			SizeIncrement:  dec("1"),
+		},
+	}, nil)
+	return r
+}
+
+func TestRound(t *testing.T) {
+
+	tests := []struct {
+		value, incr string
+		mode        normalize.RoundingMode
+		expected    string
+	}{
+		{"100.3", "0.5", normalize.RoundNearest, "100.5"},
+		{"100.3", "0.5", normalize.RoundDown, "100"},
+		{"100.3", "0.5", normalize.RoundUp, "100.5"},
+		{"100.3", "0.5", normalize.RoundReject, "100.3"},
+		{"0.0015", "0.001", normalize.RoundDown, "0.001"},
+	}
+
+	for _, test := range tests {
+		got := normalize.Round(dec(test.value), dec(test.incr), test.mode)
+		if !got.Equal(dec(test.expected)) {
+			t.Fatalf("Should be equal: %v, %v", got, test.expected)
+		}
+	}
+}
+
+func TestNormalizer_Order(t *testing.T) {
+
+	n := normalize.New(instruments())
+
+	buy := &models.OrderParams{
+		Market: "BTC-PERP",
+		Side:   models.Buy,
+		Type:   models.LimitOrder,
+		Price:  dec("100.3"),
+		Size:   dec("0.0037"),
+	}
+	if err := n.Order(buy); err != nil {
+		t.Fatal(err)
+	}
+	if !buy.Price.Equal(dec("100")) || !buy.Size.Equal(dec("0.003")) {
+		t.Fatalf("Unexpected buy: %v %v", buy.Price, buy.Size)
+	}
+
+	sell := &models.OrderParams{
+		Market: "BTC-PERP",
+		Side:   models.Sell,
+		Type:   models.LimitOrder,
+		Price:  dec("100.3"),
+		Size:   dec("0.003"),
+	}
+	if err := n.Order(sell); err != nil {
+		t.Fatal(err)
+	}
+	if !sell.Price.Equal(dec("100.5")) {
+		t.Fatalf("Unexpected sell price: %v", sell.Price)
+	}
+}
+
+func TestNormalizer_Reject(t *testing.T) {
+
+	n := normalize.New(instruments(), normalize.WithPriceRounding(normalize.RoundReject))
+
+	tests := []struct {
+		params   *models.OrderParams
+		expected error
+	}{
+		{
+			&models.OrderParams{Market: "BTC-PERP", Side: models.Buy, Type: models.LimitOrder,
+				Price: dec("100.3"), Size: dec("1")},
+			normalize.ErrOffTick,
+		},
+		{
+			&models.OrderParams{Market: "BTC-PERP", Side: models.Buy, Type: models.LimitOrder,
+				Price: dec("100"), Size: dec("0.0011")},
+			normalize.ErrBelowMinSize,
+		},
+		{
+			&models.OrderParams{Market: "ETH-PERP", Side: models.Buy, Type: models.LimitOrder,
+				Price: dec("100"), Size: dec("1")},
+			normalize.ErrUnknownMarket,
+		},
+		{
+			&models.OrderParams{Market: "NEW-PERP", Side: models.Buy, Type: models.LimitOrder,
+				Price: dec("1"), Size: dec("1")},
+			normalize.ErrPostOnlyRequired,
+		},
+	}
+
+	for i, test := range tests {
+		err := n.Order(test.params)
+		if !errors.Is(err, test.expected) {
+			t.Fatalf("test #%d: expected %v, got %v", i+1, test.expected, err)
+		}
+		var verr *normalize.ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("test #%d: expected a ValidationError", i+1)
+		}
+	}
+}
+
+func TestNormalizer_ModifyAndTrigger(t *testing.T) {
+
+	n := normalize.New(instruments())
+
+	mod := &models.ModifyOrderParams{Price: api.PtrDecimal(dec("99.9"))}
+	if err := n.Modify("BTC-PERP", models.Sell, mod); err != nil {
+		t.Fatal(err)
+	}
+	if !mod.Price.Equal(dec("100")) {
+		t.Fatalf("Unexpected price: %v", *mod.Price)
+	}
+
+	trig := &models.TriggerOrderParams{
+		Market:       api.PtrString("BTC-PERP"),
+		Side:         api.PtrOrderSide(models.Sell),
+		Size:         api.PtrDecimal(dec("0.0015")),
+		TriggerPrice: api.PtrDecimal(dec("90.2")),
+		OrderPrice:   api.PtrDecimal(dec("90")),
+	}
+	if err := n.Trigger(trig); !errors.Is(err, normalize.ErrBelowMinSize) {
+		t.Fatalf("Expected %v, got %v", normalize.ErrBelowMinSize, err)
+	}
+
+	// A stop market order takes liquidity and only needs one lot
+	trig.OrderPrice, trig.Size = nil, api.PtrDecimal(dec("0.0015"))
+	if err := n.Trigger(trig); err != nil {
+		t.Fatal(err)
+	}
+	if !trig.Size.Equal(dec("0.001")) {
+		t.Fatalf("Unexpected size: %v", *trig.Size)
+	}
+}
+
+func TestNormalizer_TakerMinSize(t *testing.T) {
+
+	n := normalize.New(instruments())
+
+	// Below the minimum provide size of 0.002 but a whole lot
+	for _, params := range []*models.OrderParams{
+		{Market: "BTC-PERP", Side: models.Buy, Type: models.MarketOrder, Size: dec("0.0011")},
+		{Market: "BTC-PERP", Side: models.Buy, Type: models.LimitOrder, IOC: true,
+			Price: dec("100"), Size: dec("0.0011")},
+	} {
+		if err := n.Order(params); err != nil {
+			t.Fatal(err)
+		}
+		if !params.Size.Equal(dec("0.001")) {
+			t.Fatalf("Unexpected size: %v", params.Size)
+		}
+	}
+
+	post := &models.OrderParams{Market: "BTC-PERP", Side: models.Buy, Type: models.LimitOrder,
+		IOC: true, PostOnly: true, Price: dec("100"), Size: dec("0.0011")}
+	if err := n.Order(post); !errors.Is(err, normalize.ErrBelowMinSize) {
+		t.Fatalf("Expected %v, got %v", normalize.ErrBelowMinSize, err)
+	}
+}
@@ -0,0 +1,168 @@
+package testoms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/oms"
+)
+
+func d(v float64) decimal.Decimal {
+	return decimal.NewFromFloat(v)
+}
+
+func order(id int64, status models.OrderStatus, filled, avg float64) *models.Order {
+	return &models.Order{
+		ID:           id,
+		Market:       "BTC-PERP",
+		Side:         models.Buy,
+		Type:         models.LimitOrder,
+		Price:        d(100),
+		Size:         d(2),
+		FilledSize:   d(filled),
+		AvgFillPrice: d(avg),
+		Status:       status,
+		ClientID:     "mm-1",
+	}
+}
+
+func fill(id, orderID int64, price, size float64) *models.Fill {
+	return &models.Fill{ID: id, OrderID: orderID, Market: "BTC-PERP", Price: d(price), Size: d(size)}
+}
+
+func TestManager_Lifecycle(t *testing.T) {
+
+	m := oms.New(nil)
+	updates, cancel := m.Subscribe(oms.Filter{ClientID: "mm-1"})
+	defer cancel()
+
+	m.ApplyOrder(order(1, models.New, 0, 0))
+	m.ApplyOrder(order(1, models.Open, 0, 0))
+	m.ApplyFill(fill(10, 1, 100, 0.5))
+	// The fill arrives again and the venue update counts it too
+	m.ApplyFill(fill(10, 1, 100, 0.5))
+	m.ApplyOrder(order(1, models.Open, 0.5, 100))
+	m.ApplyFill(fill(11, 1, 98, 1.5))
+	m.ApplyOrder(order(1, models.Closed, 2, 98.5))
+
+	expected := []oms.State{oms.StateNew, oms.StateOpen, oms.StatePartiallyFilled, oms.StatePartiallyFilled, oms.StateFilled, oms.StateFilled}
+	for i, exp := range expected {
+		u := <-updates
+		if u.Order.State != exp {
+			t.Fatalf("update #%d: expected %s, got %s", i+1, exp, u.Order.State)
+		}
+	}
+
+	o, ok := m.GetByClientID("mm-1")
+	if !ok {
+		t.Fatal("Order not found by client id")
+	}
+	if !o.FilledSize.Equal(d(2)) || !o.AvgFillPrice.Equal(d(98.5)) || !o.RemainingSize.IsZero() {
+		t.Fatalf("Unexpected order: %+v", o)
+	}
+
+	// Late updates do not reopen a closed order
+	m.ApplyOrder(order(1, models.Open, 1, 99))
+	if o, _ = m.Get(1); o.State != oms.StateFilled {
+		t.Fatalf("Closed order reopened: %s", o.State)
+	}
+}
+
+func TestManager_FillBeforeOrder(t *testing.T) {
+
+	m := oms.New(nil)
+
+	m.ApplyFill(fill(20, 2, 101, 1))
+	if _, ok := m.Get(2); ok {
+		t.Fatal("Fill should not create an order")
+	}
+
+	m.ApplyOrder(order(2, models.Open, 0, 0))
+
+	o, _ := m.Get(2)
+	if o.State != oms.StatePartiallyFilled || !o.FilledSize.Equal(d(1)) || !o.RemainingSize.Equal(d(1)) {
+		t.Fatalf("Unexpected order: %+v", o)
+	}
+
+	m.ApplyOrder(order(3, models.Closed, 0, 0))
+
+	if o, _ = m.Get(3); o.State != oms.StateCancelled {
+		t.Fatalf("Unexpected state: %s", o.State)
+	}
+
+	if open := m.Open(oms.Filter{Market: "BTC-PERP", Side: models.Buy}); len(open) != 1 || open[0].ID != 2 {
+		t.Fatalf("Unexpected open orders: %+v", open)
+	}
+}
+
+// venue serves no open orders, order 1 as cancelled and fails order 2.
+type venue struct{}
+
+func (venue) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	status, body := http.StatusOK, map[string]interface{}{"success": true, "result": []interface{}{}}
+
+	switch req.URL.Path {
+	case "/api/orders/1":
+		body["result"] = order(1, models.Closed, 0, 0)
+	case "/api/orders/2":
+		status, body = http.StatusInternalServerError, map[string]interface{}{"success": false, "error": "unavailable"}
+	}
+
+	data, _ := json.Marshal(body)
+
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(bytes.NewReader(data)),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+func TestManager_ReconcileAndPrune(t *testing.T) {
+
+	client := api.New(api.WithAuth("key", "secret"), api.WithHTTPClient(&http.Client{Transport: venue{}}))
+	m := oms.New(client, oms.WithRetention(time.Minute))
+
+	m.ApplyOrder(order(1, models.Open, 0, 0))
+	m.ApplyOrder(order(2, models.Open, 0, 0))
+	m.ApplyFill(fill(30, 3, 100, 1))
+
+	// Order 2 failing does not stop order 1 being reconciled
+	err := m.Reconcile()
+	var rerr *oms.ReconcileError
+	if !errors.As(err, &rerr) || len(rerr.Errors) != 1 || rerr.Errors[2] == nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if o, _ := m.Get(1); o.State != oms.StateCancelled {
+		t.Fatalf("Unexpected state: %s", o.State)
+	}
+
+	if n := m.Prune(time.Now()); n != 0 {
+		t.Fatalf("Evicted %d orders within the retention", n)
+	}
+	if n := m.Prune(time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("Expected 1 order evicted, got %d", n)
+	}
+	if _, ok := m.Get(1); ok {
+		t.Fatal("Cancelled order should be evicted")
+	}
+	if _, ok := m.Get(2); !ok {
+		t.Fatal("Open order should be kept")
+	}
+
+	// The held fill was evicted with it
+	m.ApplyOrder(order(3, models.Open, 0, 0))
+	if o, _ := m.Get(3); !o.FilledSize.IsZero() {
+		t.Fatalf("Held fill should be evicted: %+v", o)
+	}
+}
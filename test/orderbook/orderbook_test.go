@@ -0,0 +1,56 @@
+package testorderbook
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/orderbook"
+)
+
+const market = "BTC-PERP"
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func resp(rt models.ResponseType, bids, asks [][]decimal.Decimal) *models.OrderBookResponse {
+	return &models.OrderBookResponse{
+		OrderBook:    models.OrderBook{Bids: bids, Asks: asks},
+		BaseResponse: models.BaseResponse{ResponseType: rt, Symbol: market},
+	}
+}
+
+func TestBooks(t *testing.T) {
+
+	books := orderbook.New()
+
+	// Updates before the partial are ignored
+	books.Apply(resp(models.Update, [][]decimal.Decimal{{d("100"), d("1")}}, nil))
+	if _, _, ok := books.Book(market); ok {
+		t.Fatal("Book before partial")
+	}
+
+	books.Apply(resp(models.Partial,
+		[][]decimal.Decimal{{d("99"), d("1")}, {d("98"), d("2")}},
+		[][]decimal.Decimal{{d("101"), d("1")}, {d("102"), d("2")}}))
+
+	books.Apply(resp(models.Update,
+		[][]decimal.Decimal{{d("99.5"), d("3")}, {d("99"), d("0")}},
+		[][]decimal.Decimal{{d("101"), d("0")}}))
+
+	bid, ask, ok := books.Book(market)
+	if !ok || !bid.Equal(d("99.5")) || !ask.Equal(d("102")) {
+		t.Fatalf("Unexpected top of book: %s %s %v", bid, ask, ok)
+	}
+
+	if mid, _ := books.Mid(market); !mid.Equal(d("100.75")) {
+		t.Fatalf("Unexpected mid: %s", mid)
+	}
+
+	bids, asks, _ := books.Snapshot(market, 0)
+	if len(bids) != 2 || !bids[1].Price.Equal(d("98")) || len(asks) != 1 {
+		t.Fatalf("Unexpected snapshot: %+v %+v", bids, asks)
+	}
+}
@@ -239,9 +239,9 @@ func TestOrders_PlaceTriggerOrderModifyAndCancel(t *testing.T) {
 	orderPrice := triggerPrice.Sub(decimal.NewFromFloat(1e3))
 	err = ftx.Orders.PlaceTriggerOrder(&models.TriggerOrderParams{
 		Market:       api.PtrString(swap),
-		Side:         api.PtrString(string(models.Sell)),
+		Side:         api.PtrOrderSide(models.Sell),
 		Size:         &size,
-		Type:         api.PtrString(string(models.Stop)),
+		Type:         api.PtrTriggerOrderType(models.Stop),
 		TriggerPrice: &triggerPrice,
 		OrderPrice:   &orderPrice,
 	}, &order)
@@ -0,0 +1,315 @@
+package testpaper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/algo"
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/paper"
+	"github.com/sanjujosh/go-ftx/risk"
+)
+
+const market = "BTC-PERP"
+
+var (
+	_ algo.Orders       = (*paper.Engine)(nil)
+	_ algo.LinkedOrders = (*paper.Engine)(nil)
+	_ risk.BatchOrders  = (*paper.Engine)(nil)
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func levels(pairs ...string) [][]decimal.Decimal {
+	result := make([][]decimal.Decimal, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		result = append(result, []decimal.Decimal{d(pairs[i]), d(pairs[i+1])})
+	}
+	return result
+}
+
+func book(rt models.ResponseType, bids, asks [][]decimal.Decimal) *models.OrderBookResponse {
+	return &models.OrderBookResponse{
+		OrderBook:    models.OrderBook{Bids: bids, Asks: asks},
+		BaseResponse: models.BaseResponse{ResponseType: rt, Symbol: market},
+	}
+}
+
+func trade(side models.OrderSide, price, size string) *models.TradeResponse {
+	return &models.TradeResponse{
+		Trade:        models.Trade{Side: string(side), Price: d(price), Size: d(size)},
+		BaseResponse: models.BaseResponse{ResponseType: models.Update, Symbol: market},
+	}
+}
+
+func newEngine() *paper.Engine {
+
+	e := paper.New(paper.WithAccountInformation(&models.AccountInformation{
+		MakerFee:   d("0.0002"),
+		TakerFee:   d("0.0007"),
+		Collateral: d("10000"),
+		Leverage:   d("10"),
+	}))
+
+	e.ApplyBook(book(models.Partial,
+		levels("99", "3", "98", "5"),
+		levels("100", "1", "101", "2")))
+
+	return e
+}
+
+func place(t *testing.T, e *paper.Engine, b *models.OrderBuilder) *models.Order {
+	t.Helper()
+	params, err := b.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := &models.Order{}
+	if err = e.PlaceOrder(params, order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestEngine_TakerSlippage(t *testing.T) {
+
+	e := newEngine()
+	fills, _ := e.SubscribeToFills(context.Background())
+
+	order := place(t, e, models.NewMarketOrder(market, models.Buy, d("2")))
+
+	if order.Status != models.Closed || !order.FilledSize.Equal(d("2")) ||
+		!order.AvgFillPrice.Equal(d("100.5")) {
+		t.Fatalf("Unexpected order: %+v", order)
+	}
+
+	if len(fills) != 2 {
+		t.Fatalf("Unexpected fill count: %d", len(fills))
+	}
+	first := <-fills
+	if first.Liquidity != string(models.Taker) || !first.Price.Equal(d("100")) ||
+		first.FeeRate != 0.0007 {
+		t.Fatalf("Unexpected fill: %+v", first.Fill)
+	}
+
+	// The liquidity taken stays gone until the book updates the level
+	if _, ask, _ := e.Book(market); !ask.Equal(d("101")) {
+		t.Fatalf("Unexpected ask: %v", ask)
+	}
+
+	// IOC leftovers are cancelled rather than rested
+	ioc := place(t, e, models.NewLimitOrder(market, models.Buy, d("101"), d("3")).IOC())
+	if ioc.Status != models.Closed || !ioc.FilledSize.Equal(d("1")) {
+		t.Fatalf("Unexpected IOC order: %+v", ioc)
+	}
+
+	positions, err := e.GetPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || !positions[0].NetSize.Equal(d("3")) ||
+		!positions[0].EntryPrice.Equal(d("302").Div(d("3"))) {
+		t.Fatalf("Unexpected positions: %+v", positions)
+	}
+
+	info := &models.AccountInformation{}
+	if err = e.GetAccountInformation(info); err != nil {
+		t.Fatal(err)
+	}
+	fees := d("302").Mul(d("0.0007"))
+	if !info.Collateral.Equal(d("10000").Sub(fees)) || !info.TakerFee.Equal(d("0.0007")) {
+		t.Fatalf("Unexpected account: %+v", info)
+	}
+}
+
+func TestEngine_QueuePosition(t *testing.T) {
+
+	e := newEngine()
+
+	order := place(t, e, models.NewLimitOrder(market, models.Buy, d("99"), d("2")))
+	if order.Status != models.Open {
+		t.Fatalf("Unexpected order: %+v", order)
+	}
+
+	status := func() *models.Order {
+		o := &models.Order{}
+		if err := e.GetOrderStatus(order.ID, o); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	// Three are ahead at 99
+	e.ApplyTrade(trade(models.Sell, "99", "2"))
+	if o := status(); !o.FilledSize.IsZero() {
+		t.Fatalf("Filled ahead of the queue: %+v", o)
+	}
+
+	e.ApplyTrade(trade(models.Sell, "99", "2"))
+	if o := status(); !o.FilledSize.Equal(d("1")) || o.Status != models.Open {
+		t.Fatalf("Unexpected order: %+v", o)
+	}
+
+	// A trade below the order's price means the level was cleared
+	e.ApplyTrade(trade(models.Sell, "98.5", "0.1"))
+	o := status()
+	if !o.FilledSize.Equal(d("2")) || o.Status != models.Closed || !o.AvgFillPrice.Equal(d("99")) {
+		t.Fatalf("Unexpected order: %+v", o)
+	}
+
+	// Cancellations at the level move a new order up the queue
+	order = place(t, e, models.NewLimitOrder(market, models.Buy, d("98"), d("1")))
+	e.ApplyBook(book(models.Update, levels("98", "1"), nil))
+	e.ApplyTrade(trade(models.Sell, "98", "1.5"))
+	if o = status(); !o.FilledSize.Equal(d("0.5")) {
+		t.Fatalf("Unexpected order: %+v", o)
+	}
+
+	// A book crossing the order fills it
+	e.ApplyBook(book(models.Update, nil, levels("97", "4")))
+	if o = status(); o.Status != models.Closed || !o.FilledSize.Equal(d("1")) {
+		t.Fatalf("Unexpected order: %+v", o)
+	}
+}
+
+func TestEngine_PostOnlyAndReduceOnly(t *testing.T) {
+
+	e := newEngine()
+
+	postOnly := place(t, e, models.NewLimitOrder(market, models.Buy, d("100"), d("1")).PostOnly())
+	if postOnly.Status != models.Closed || !postOnly.FilledSize.IsZero() {
+		t.Fatalf("Post only order took: %+v", postOnly)
+	}
+
+	params, _ := models.NewLimitOrder(market, models.Sell, d("105"), d("1")).ReduceOnly().Order()
+	err := e.PlaceOrder(params, &models.Order{})
+	if err == nil {
+		t.Fatal("Reduce only order accepted without a position")
+	}
+
+	place(t, e, models.NewMarketOrder(market, models.Buy, d("1")))
+
+	reduce := place(t, e, models.NewLimitOrder(market, models.Sell, d("105"), d("5")).ReduceOnly())
+	e.ApplyTrade(trade(models.Buy, "106", "10"))
+
+	o := &models.Order{}
+	if err = e.GetOrderStatus(reduce.ID, o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Status != models.Closed || !o.FilledSize.Equal(d("1")) {
+		t.Fatalf("Reduce only order not capped: %+v", o)
+	}
+
+	positions, _ := e.GetPositions()
+	if !positions[0].NetSize.IsZero() || !positions[0].RealizedPnl.Equal(d("5")) {
+		t.Fatalf("Unexpected position: %+v", positions[0])
+	}
+
+	if err = e.GetOrderStatus(12345, o); !api.IsNotFound(err) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestEngine_TriggerOrders(t *testing.T) {
+
+	e := newEngine()
+	place(t, e, models.NewMarketOrder(market, models.Buy, d("1")))
+
+	stop := &models.TriggerOrder{}
+	err := e.PlaceTriggerOrder(&models.TriggerOrderParams{
+		Market:       api.PtrString(market),
+		Side:         api.PtrOrderSide(models.Sell),
+		Size:         api.PtrDecimal(d("1")),
+		Type:         api.PtrTriggerOrderType(models.Stop),
+		TriggerPrice: api.PtrDecimal(d("95")),
+		ReduceOnly:   api.PtrBool(true),
+	}, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.ApplyTrade(trade(models.Sell, "96", "1"))
+	if triggers, _ := e.GetTriggerOrderTriggers(stop.ID); len(triggers) != 0 {
+		t.Fatalf("Stop fired early: %+v", triggers)
+	}
+
+	e.ApplyTrade(trade(models.Sell, "95", "1"))
+
+	triggers, err := e.GetTriggerOrderTriggers(stop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(triggers) != 1 || triggers[0].FilledSize != 1 || triggers[0].Error != "" {
+		t.Fatalf("Unexpected triggers: %+v", triggers)
+	}
+
+	open, _ := e.GetOpenTriggerOrders(api.PtrString(market), nil)
+	if len(open) != 0 {
+		t.Fatalf("Unexpected open triggers: %+v", open)
+	}
+
+	positions, _ := e.GetPositions()
+	if !positions[0].NetSize.IsZero() {
+		t.Fatalf("Unexpected position: %+v", positions[0])
+	}
+}
+
+func TestEngine_Batch(t *testing.T) {
+
+	e := newEngine()
+
+	params := func(b *models.OrderBuilder) *models.OrderParams {
+		p, err := b.Order()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	batch := []*models.OrderParams{
+		params(models.NewLimitOrder(market, models.Buy, d("95"), d("1"))),
+		params(models.NewLimitOrder(market, models.Sell, d("105"), d("1")).ReduceOnly()),
+		params(models.NewLimitOrder(market, models.Buy, d("94"), d("1"))),
+	}
+
+	results, err := e.PlaceOrders(batch, api.AllOrNothing())
+	var batchErr *api.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Failed != 3 || batchErr.Total != 3 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if results[0].Err != api.ErrRolledBack || results[1].Err == nil || results[2].Err != api.ErrNotAttempted {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+	if open, _ := e.GetOpenOrders(market); len(open) != 0 {
+		t.Fatalf("Rolled back orders still open: %+v", open)
+	}
+
+	results, err = e.PlaceOrders([]*models.OrderParams{batch[0], batch[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified, err := e.ModifyOrders([]api.ModifyRequest{
+		{OrderID: results[0].Order.ID, Params: &models.ModifyOrderParams{Price: api.PtrDecimal(d("96"))}},
+		{OrderID: 12345, Params: &models.ModifyOrderParams{Price: api.PtrDecimal(d("96"))}},
+	})
+	if !errors.As(err, &batchErr) || batchErr.Failed != 1 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !modified[0].Order.Price.Equal(d("96")) || !api.IsNotFound(modified[1].Err) {
+		t.Fatalf("Unexpected modify results: %+v", modified)
+	}
+
+	cancelled, err := e.CancelOrders([]int64{modified[0].Order.ID, results[1].Order.ID})
+	if err != nil || cancelled[0].Err != nil || cancelled[1].Err != nil {
+		t.Fatalf("Unexpected cancel results: %+v %v", cancelled, err)
+	}
+	if open, _ := e.GetOpenOrders(market); len(open) != 0 {
+		t.Fatalf("Cancelled orders still open: %+v", open)
+	}
+}
@@ -0,0 +1,152 @@
+package testpnl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/oms"
+	"github.com/sanjujosh/go-ftx/pnl"
+)
+
+const market = "BTC-PERP"
+
+var (
+	_ pnl.FillHistory    = (*api.Fills)(nil)
+	_ pnl.FundingHistory = (*api.Funding)(nil)
+	_ pnl.Marks          = (*api.Futures)(nil)
+	_ pnl.OrderLookup    = (*oms.Manager)(nil)
+)
+
+var start = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func fill(id, orderID int64, side models.OrderSide, size, price string, at time.Duration) *models.Fill {
+	return &models.Fill{
+		ID:          id,
+		OrderID:     orderID,
+		Market:      market,
+		Future:      market,
+		Side:        string(side),
+		Size:        d(size),
+		Price:       d(price),
+		Fee:         0.5,
+		FeeCurrency: "USD",
+		Time:        start.Add(at),
+	}
+}
+
+func history() []*models.Fill {
+	return []*models.Fill{
+		fill(1, 1, models.Buy, "1", "100", 0),
+		fill(2, 2, models.Buy, "1", "110", time.Hour),
+		fill(3, 3, models.Sell, "1", "120", 2*time.Hour),
+	}
+}
+
+func TestLedger_Methods(t *testing.T) {
+
+	tests := []struct {
+		method   pnl.Method
+		realized string
+		cost     string
+	}{
+		{pnl.FIFO, "20", "110"},
+		{pnl.LIFO, "10", "100"},
+		{pnl.AverageCost, "15", "105"},
+	}
+
+	for _, test := range tests {
+
+		ledger := pnl.New(pnl.WithMethod(test.method))
+		ledger.Replay(history(), nil)
+
+		// Duplicates are ignored
+		if ledger.AddFill(history()[0]) {
+			t.Fatal("Duplicate fill booked")
+		}
+
+		total := ledger.Total("*", "*")
+		if !total.Realized.Equal(d(test.realized)) || !total.Fees.Equal(d("1.5")) {
+			t.Fatalf("%s: unexpected total %+v", test.method, total)
+		}
+
+		ledger.SetMark(market, d("130"))
+		positions := ledger.Positions()
+		if len(positions) != 1 || !positions[0].Cost.Equal(d(test.cost)) ||
+			!positions[0].Unrealized.Equal(d("130").Sub(d(test.cost))) {
+			t.Fatalf("%s: unexpected positions %+v", test.method, positions)
+		}
+	}
+}
+
+type orders map[int64]models.ClientOrderID
+
+func (o orders) Get(id int64) (oms.Order, bool) {
+	clientID, ok := o[id]
+	return oms.Order{Order: models.Order{ID: id, ClientID: clientID}}, ok
+}
+
+func TestLedger_Attribution(t *testing.T) {
+
+	ledger := pnl.New(pnl.WithOrders(orders{1: "mm:1", 2: "arb:7", 3: "mm:2"}))
+
+	ledger.Replay(
+		append(history(), fill(4, 4, models.Sell, "1", "90", 25*time.Hour)),
+		[]*models.FundingPayment{
+			{ID: 1, Future: market, Payment: d("2"), Time: start.Add(3 * time.Hour)},
+		})
+
+	mm, arb := ledger.Total("mm", "*"), ledger.Total("arb", "*")
+	if !mm.Realized.Equal(d("20")) || !mm.Funding.IsZero() {
+		t.Fatalf("Unexpected mm total: %+v", mm)
+	}
+	// arb held the only position when funding was paid
+	if !arb.Funding.Equal(d("-2")) || !arb.Fees.Equal(d("0.5")) {
+		t.Fatalf("Unexpected arb total: %+v", arb)
+	}
+
+	// The unknown order's sell opens a short for the "" strategy on day two
+	entries := ledger.Entries()
+	last := entries[len(entries)-1]
+	if last.Strategy != "" || !last.Day.Equal(time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected entry: %+v", last)
+	}
+
+	ledger.SetMark(market, d("100"))
+	diffs := ledger.Reconcile([]*models.Position{
+		{Future: market, NetSize: d("0"), UnrealizedPnl: d("0")},
+	}, d("0.0001"))
+	if len(diffs) != 0 {
+		t.Fatalf("Unexpected differences: %+v", diffs)
+	}
+
+	diffs = ledger.Reconcile([]*models.Position{{Future: market, NetSize: d("1")}}, d("0.0001"))
+	if len(diffs) != 1 || diffs[0].Field != "net_size" {
+		t.Fatalf("Unexpected differences: %+v", diffs)
+	}
+}
+
+func TestStrategy(t *testing.T) {
+
+	tests := map[models.ClientOrderID]string{
+		"mm:1":                                 "mm",
+		"market-maker:1":                       "market-maker",
+		"0b7d7b3e-4a1f-4c2e-9d6a-3f1e2a4b5c6d": "",
+		"42":                                   "",
+		":1":                                   "",
+		"mm:":                                  "",
+	}
+
+	for id, expected := range tests {
+		if s := pnl.Strategy(id); s != expected {
+			t.Fatalf("%s: expected %q, got %q", id, expected, s)
+		}
+	}
+}
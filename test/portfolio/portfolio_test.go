@@ -0,0 +1,155 @@
+package testportfolio
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/portfolio"
+)
+
+type exchange struct {
+	mu       sync.Mutex
+	btcPrice float64
+	mmSize   float64
+	mmDown   bool
+}
+
+func (e *exchange) result(req *http.Request) interface{} {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub := req.Header.Get("FTX-SUBACCOUNT")
+
+	switch req.URL.Path {
+	case "/api/subaccounts":
+		return []map[string]interface{}{{"nickname": "mm"}}
+	case "/api/markets":
+		return []map[string]interface{}{
+			{"name": "BTC/USD", "type": "spot", "baseCurrency": "BTC", "quoteCurrency": "USD",
+				"bid": e.btcPrice - 1, "ask": e.btcPrice + 1},
+			{"name": "BTC-PERP", "type": "future", "underlying": "BTC"},
+		}
+	case "/api/wallet/all_balances":
+		return map[string]interface{}{
+			"main": []map[string]interface{}{{"coin": "USD", "total": 1000, "free": 800}},
+			"mm": []map[string]interface{}{
+				{"coin": "BTC", "total": 2, "free": 2},
+				{"coin": "XYZ", "total": 5, "free": 5},
+			},
+		}
+	case "/api/account":
+		if sub == "mm" {
+			return map[string]interface{}{"positions": []map[string]interface{}{
+				{"future": "BTC-PERP", "netSize": e.mmSize, "unrealizedPnl": -10},
+			}}
+		}
+		return map[string]interface{}{"positions": []map[string]interface{}{
+			{"future": "BTC-PERP", "netSize": -1, "unrealizedPnl": 5},
+			{"future": "ETH-PERP", "netSize": 0},
+		}}
+	case "/api/orders":
+		return []interface{}{}
+	}
+
+	return nil
+}
+
+func (e *exchange) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	e.mu.Lock()
+	down := e.mmDown && req.Header.Get("FTX-SUBACCOUNT") == "mm" && req.URL.Path == "/api/account"
+	e.mu.Unlock()
+
+	status := http.StatusOK
+	body, _ := json.Marshal(map[string]interface{}{"success": true, "result": e.result(req)})
+	if down {
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(map[string]interface{}{"success": false, "error": "Internal error"})
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func TestAggregator(t *testing.T) {
+
+	venue := &exchange{btcPrice: 100, mmSize: 3}
+	client := api.New(
+		api.WithAuth("key", "secret"),
+		api.WithHTTPClient(&http.Client{Transport: venue}))
+
+	aggregator := portfolio.New(client)
+
+	first, err := aggregator.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1000 USD + 5 pnl, and 2 BTC at 100 - 10 pnl
+	if !first.Value.Equal(d("1195")) || len(first.Accounts) != 2 {
+		t.Fatalf("Unexpected snapshot: %+v", first)
+	}
+	if mm, _ := first.Account("mm"); !mm.Value.Equal(d("190")) || mm.Err != nil {
+		t.Fatalf("Unexpected mm account: %+v", mm)
+	}
+	if len(first.Unpriced) != 1 || first.Unpriced[0] != "XYZ" {
+		t.Fatalf("Unexpected unpriced coins: %v", first.Unpriced)
+	}
+	if len(first.Positions) != 1 || !first.Positions[0].NetSize.Equal(d("2")) ||
+		!first.Positions[0].BySubAccount[""].Equal(d("-1")) {
+		t.Fatalf("Unexpected positions: %+v", first.Positions)
+	}
+
+	venue.mu.Lock()
+	venue.btcPrice, venue.mmSize = 110, 4
+	venue.mu.Unlock()
+
+	second, err := aggregator.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := portfolio.Diff(first, second)
+	if len(changes) != 2 {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+	if c := changes[0]; c.SubAccount != "mm" || c.Kind != portfolio.PositionChanged ||
+		!c.From.Equal(d("3")) || !c.To.Equal(d("4")) {
+		t.Fatalf("Unexpected change: %+v", c)
+	}
+	if c := changes[1]; c.Kind != portfolio.ValueChanged || !c.To.Equal(d("210")) {
+		t.Fatalf("Unexpected change: %+v", c)
+	}
+
+	// An account that failed to load does not show its figures dropping
+	venue.mu.Lock()
+	venue.mmDown = true
+	venue.mu.Unlock()
+
+	third, err := aggregator.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mm, _ := third.Account("mm"); mm.Err == nil {
+		t.Fatal("Expected the mm account to fail")
+	}
+	if changes = portfolio.Diff(second, third); len(changes) != 0 {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+}
@@ -0,0 +1,113 @@
+package testregistry
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/registry"
+)
+
+func markets() []*models.Market {
+	return []*models.Market{
+		{
+			Name:           "BTC/USD",
+			BaseCurrency:   "BTC",
+			QuoteCurrency:  "USD",
+			Type:           "spot",
+			Enabled:        true,
+			PriceIncrement: decimal.NewFromInt(1),
+			SizeIncrement:  decimal.RequireFromString("0.0001"),
+		},
+		{
+			Name:           "BTC-PERP",
+			Underlying:     "BTC",
+			Type:           "future",
+			Enabled:        true,
+			PriceIncrement: decimal.NewFromInt(1),
+			SizeIncrement:  decimal.RequireFromString("0.0001"),
+		},
+		{
+			Name:           "BTC-0624",
+			Underlying:     "BTC",
+			Type:           "future",
+			Enabled:        true,
+			PriceIncrement: decimal.NewFromInt(1),
+			SizeIncrement:  decimal.RequireFromString("0.0001"),
+		},
+	}
+}
+
+func futures() []*models.Future {
+	return []*models.Future{
+		{Name: "BTC-PERP", Underlying: "BTC", Type: "perpetual", Perpetual: true},
+		{Name: "BTC-0624", Underlying: "BTC", Type: "future"},
+	}
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+
+	r := registry.New(nil)
+
+	events := r.Load(markets(), futures())
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 added events, got %d", len(events))
+	}
+
+	perp, ok := r.Get("BTC-PERP")
+	if !ok {
+		t.Fatal("BTC-PERP should exist")
+	}
+	if perp.Type != registry.Perpetual || perp.QuoteCurrency != "USD" {
+		t.Fatalf("Unexpected instrument: %+v", perp)
+	}
+
+	if n := len(r.ByUnderlying("BTC")); n != 3 {
+		t.Fatalf("Expected 3 BTC instruments, got %d", n)
+	}
+	if n := len(r.ByType(registry.DatedFuture)); n != 1 {
+		t.Fatalf("Expected 1 dated future, got %d", n)
+	}
+	if n := len(r.ByQuoteCurrency("USD")); n != 3 {
+		t.Fatalf("Expected 3 USD instruments, got %d", n)
+	}
+}
+
+func TestRegistry_Events(t *testing.T) {
+
+	r := registry.New(nil)
+	r.Load(markets(), futures())
+
+	m := *markets()[1]
+	m.PriceIncrement = decimal.RequireFromString("0.5")
+	m.PostOnly = true
+
+	events := r.Apply(&m)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != registry.IncrementsChanged || events[1].Type != registry.FlagsChanged {
+		t.Fatalf("Unexpected events: %+v", events)
+	}
+	if !events[0].Previous.TickSize.Equal(decimal.NewFromInt(1)) {
+		t.Fatal("Previous tick size should be 1")
+	}
+
+	events = r.Load(markets()[:2], futures()[:1])
+	delisted := 0
+	for _, e := range events {
+		if e.Type == registry.Delisted {
+			delisted++
+			if e.Instrument.Name != "BTC-0624" {
+				t.Fatalf("Unexpected delisting: %s", e.Instrument.Name)
+			}
+		}
+	}
+	if delisted != 1 {
+		t.Fatalf("Expected 1 delisting, got %d", delisted)
+	}
+	if _, ok := r.Get("BTC-0624"); ok {
+		t.Fatal("BTC-0624 should be removed")
+	}
+}
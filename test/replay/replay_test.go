@@ -0,0 +1,123 @@
+package testreplay
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+func record(t *testing.T, path string) {
+
+	recorder, err := api.NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().UTC()
+	msgs := []models.WsResponse{
+		{
+			ChannelType:  models.TickerChannel,
+			Market:       "BTC-PERP",
+			ResponseType: models.Subscribed,
+		},
+		{
+			ChannelType:  models.TickerChannel,
+			Market:       "BTC-PERP",
+			ResponseType: models.Update,
+			Data:         json.RawMessage(`{"bid":100.5,"ask":101,"last":100.5,"time":1650000000.5}`),
+		},
+		{
+			ChannelType:  models.TickerChannel,
+			Market:       "ETH-PERP",
+			ResponseType: models.Update,
+			Data:         json.RawMessage(`{"bid":10,"ask":11,"last":10,"time":1650000001}`),
+		},
+		{
+			ChannelType:  models.TickerChannel,
+			Market:       "BTC-PERP",
+			ResponseType: models.Update,
+			Data:         json.RawMessage(`{"bid":102,"ask":102.5,"last":102,"time":1650000002}`),
+		},
+	}
+
+	for i := range msgs {
+		if err = recorder.Record(start.Add(time.Duration(i)*time.Second), &msgs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorder_ReadRecording(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+	record(t, path)
+
+	n := 0
+	err := api.ReadRecording(path, func(rec *models.RecordedWsResponse) error {
+		if rec.ReceivedAt.IsZero() {
+			t.Fatal("ReceivedAt should be set")
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("Expected 4 records, got %d", n)
+	}
+}
+
+func TestReplayStream_Tickers(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+	record(t, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := api.NewReplayStream(api.New(), api.NewReplayer(path, api.ReplayMaxSpeed))
+
+	tickersC, err := stream.SubscribeToTickers(ctx, "BTC-PERP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"100.5", "102"}
+
+	for _, bid := range expected {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case ticker := <-tickersC:
+			if ticker.Symbol != "BTC-PERP" {
+				t.Fatalf("Unexpected symbol: %s", ticker.Symbol)
+			}
+			if ticker.Bid.String() != bid {
+				t.Fatalf("Should be equal: %s, %s", ticker.Bid.String(), bid)
+			}
+		}
+	}
+
+	select {
+	case <-stream.Done():
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+
+	if _, ok := <-tickersC; ok {
+		t.Fatal("Ticker channel should be closed at the end of the recording")
+	}
+	if err = stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
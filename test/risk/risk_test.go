@@ -0,0 +1,326 @@
+package testrisk
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/algo"
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/paper"
+	"github.com/sanjujosh/go-ftx/risk"
+	"github.com/sanjujosh/go-ftx/tickers"
+)
+
+const market = "BTC-PERP"
+
+var (
+	_ algo.LinkedOrders = (*risk.Guard)(nil)
+	_ algo.ModifyOrders = (*risk.Guard)(nil)
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+type setup struct {
+	engine *paper.Engine
+	quotes *tickers.Cache
+	chain  *risk.Chain
+	guard  *risk.Guard
+}
+
+func newSetup(limits risk.Limits) *setup {
+
+	s := &setup{engine: paper.New(), quotes: tickers.New(nil)}
+
+	s.engine.ApplyBook(&models.OrderBookResponse{
+		OrderBook: models.OrderBook{
+			Bids: [][]decimal.Decimal{{d("99"), d("100")}},
+			Asks: [][]decimal.Decimal{{d("100"), d("100")}},
+		},
+		BaseResponse: models.BaseResponse{ResponseType: models.Partial, Symbol: market},
+	})
+
+	s.quotes.Update(market, models.Ticker{
+		Bid: d("99"), Ask: d("100"), Time: models.FTXTime{Time: time.Now()},
+	}, time.Now())
+
+	s.chain = risk.NewChain(limits,
+		risk.NewNotionalCheck(s.quotes),
+		risk.NewCollarCheck(s.quotes),
+		risk.NewPositionCheck(s.engine, s.engine),
+		risk.NewOpenOrdersCheck(s.engine),
+		risk.NewRateCheck())
+	s.guard = s.chain.Wrap(s.engine, "")
+
+	return s
+}
+
+func limit(side models.OrderSide, price, size string) *models.OrderParams {
+	params, _ := models.NewLimitOrder(market, side, d(price), d(size)).Order()
+	return params
+}
+
+func reason(t *testing.T, err error) risk.Reason {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	r, ok := risk.AsRejection(err)
+	if !ok {
+		t.Fatalf("Not a rejection: %v", err)
+	}
+	return r.Reason
+}
+
+func TestGuard_Rejections(t *testing.T) {
+
+	s := newSetup(risk.Limits{
+		MaxOrderNotional: d("1000"),
+		MaxPosition:      d("20"),
+		PriceCollar:      d("0.05"),
+		MaxOpenOrders:    3,
+	})
+
+	order := &models.Order{}
+
+	tests := []struct {
+		params *models.OrderParams
+		reason risk.Reason
+	}{
+		{limit(models.Buy, "90", "5"), ""},
+		{limit(models.Buy, "90", "12"), risk.MaxOrderNotional},
+		{limit(models.Buy, "106", "1"), risk.PriceCollar},
+		{limit(models.Sell, "94", "1"), risk.PriceCollar},
+		{limit(models.Buy, "80", "12"), ""},
+		// 5 + 12 resting plus 4 is beyond 20
+		{limit(models.Buy, "80", "4"), risk.MaxPosition},
+		{limit(models.Sell, "120", "1"), ""},
+		{limit(models.Sell, "120", "1"), risk.MaxOpenOrders},
+	}
+
+	for i, test := range tests {
+		if r := reason(t, s.guard.PlaceOrder(test.params, order)); r != test.reason {
+			t.Fatalf("Order %d: expected %q, got %q", i, test.reason, r)
+		}
+	}
+
+	// Reduce-only orders are not held to the position limit
+	if _, err := s.engine.CancelAllOrders(nil); err != nil {
+		t.Fatal(err)
+	}
+	s.chain.SetLimits("", risk.Limits{MaxPosition: d("1")})
+	params, _ := models.NewMarketOrder(market, models.Buy, d("1")).Order()
+	if err := s.guard.PlaceOrder(params, order); err != nil {
+		t.Fatal(err)
+	}
+	if r := reason(t, s.guard.PlaceOrder(params, order)); r != risk.MaxPosition {
+		t.Fatalf("Unexpected reason: %q", r)
+	}
+	params, _ = models.NewMarketOrder(market, models.Sell, d("1")).ReduceOnly().Order()
+	if err := s.guard.PlaceOrder(params, order); err != nil {
+		t.Fatal(err)
+	}
+
+	s.chain.Kill("drawdown")
+	if r := reason(t, s.guard.PlaceOrder(limit(models.Buy, "90", "0.1"), order)); r != risk.KillSwitch {
+		t.Fatalf("Unexpected reason: %q", r)
+	}
+	s.chain.Resume()
+	if err := s.guard.PlaceOrder(limit(models.Sell, "130", "0.1"), order); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGuard_SubAccountsAndRate(t *testing.T) {
+
+	s := newSetup(risk.Limits{MaxOrderNotional: d("100")})
+	s.chain.SetLimits("mm", risk.Limits{MaxOrderRate: 2})
+	mm := s.chain.Wrap(s.engine, "mm")
+
+	order := &models.Order{}
+	big := limit(models.Buy, "90", "5")
+
+	if r := reason(t, s.guard.PlaceOrder(big, order)); r != risk.MaxOrderNotional {
+		t.Fatalf("Unexpected reason: %q", r)
+	}
+
+	for i, expected := range []risk.Reason{"", "", risk.MaxOrderRate} {
+		if r := reason(t, mm.PlaceOrder(limit(models.Buy, "90", "5"), order)); r != expected {
+			t.Fatalf("Order %d: expected %q, got %q", i, expected, r)
+		}
+	}
+}
+
+func TestGuard_Batches(t *testing.T) {
+
+	s := newSetup(risk.Limits{MaxPosition: d("2")})
+
+	batch := []*models.OrderParams{
+		limit(models.Buy, "90", "1"),
+		limit(models.Buy, "91", "1"),
+		limit(models.Buy, "92", "1"),
+		limit(models.Sell, "110", "1"),
+	}
+
+	results, err := s.guard.PlaceOrders(batch)
+	if _, ok := err.(*api.BatchError); !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r := reason(t, results[2].Err); r != risk.MaxPosition {
+		t.Fatalf("Unexpected reason: %q", r)
+	}
+	for _, i := range []int{0, 1, 3} {
+		if results[i].Err != nil || results[i].Order == nil {
+			t.Fatalf("Order %d not placed: %+v", i, results[i])
+		}
+	}
+
+	// Growing a resting order through a modify is checked too
+	modified, _ := s.guard.ModifyOrders([]api.ModifyRequest{
+		{OrderID: results[0].Order.ID, Params: &models.ModifyOrderParams{Size: api.PtrDecimal(d("2"))}},
+		{OrderID: results[3].Order.ID, Params: &models.ModifyOrderParams{Size: api.PtrDecimal(d("2"))}},
+	})
+	if r := reason(t, modified[0].Err); r != risk.MaxPosition {
+		t.Fatalf("Unexpected reason: %q", r)
+	}
+	if modified[1].Err != nil || !modified[1].Order.Size.Equal(d("2")) {
+		t.Fatalf("Unexpected modify: %+v", modified[1])
+	}
+
+	reduceOnly, _ := models.NewLimitOrder(market, models.Buy, d("90"), d("1")).ReduceOnly().Order()
+	open, _ := s.engine.GetOpenOrders(market)
+	results, _ = s.guard.PlaceOrders(
+		[]*models.OrderParams{batch[2], reduceOnly}, api.AllOrNothing())
+	if results[1].Err != api.ErrNotAttempted {
+		t.Fatalf("Unexpected result: %+v", results[1])
+	}
+	if after, _ := s.engine.GetOpenOrders(market); len(after) != len(open) {
+		t.Fatal("All or nothing batch was partly placed")
+	}
+}
+
+func TestGuard_ClientIDs(t *testing.T) {
+
+	s := newSetup(risk.Limits{MaxPosition: d("2")})
+
+	params := limit(models.Buy, "90", "2")
+	params.ClientID = "a"
+
+	order := &models.Order{}
+	if placed, err := s.guard.PlaceOrderOnce(params, order); err != nil || !placed {
+		t.Fatalf("Unexpected result: %v %v", placed, err)
+	}
+
+	// The retry finds the order instead of counting it twice
+	retry := &models.Order{}
+	if placed, err := s.guard.PlaceOrderOnce(params, retry); err != nil || placed || retry.ID != order.ID {
+		t.Fatalf("Unexpected retry: %v %v %+v", placed, err, retry)
+	}
+
+	second := limit(models.Buy, "90", "1")
+	second.ClientID = "b"
+	if _, err := s.guard.PlaceOrderOnce(second, order); reason(t, err) != risk.MaxPosition {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	grow := &models.ModifyOrderParams{Size: api.PtrDecimal(d("3"))}
+	if err := s.guard.ModifyOrderByClientID("a", grow, order); reason(t, err) != risk.MaxPosition {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	shrink := &models.ModifyOrderParams{Size: api.PtrDecimal(d("1"))}
+	if err := s.guard.ModifyOrderByClientID("a", shrink, order); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGuard_SubAccountSources(t *testing.T) {
+
+	s := newSetup(risk.Limits{})
+
+	mmEngine := paper.New()
+	mmEngine.ApplyBook(&models.OrderBookResponse{
+		OrderBook: models.OrderBook{
+			Bids: [][]decimal.Decimal{{d("99"), d("100")}},
+			Asks: [][]decimal.Decimal{{d("100"), d("100")}},
+		},
+		BaseResponse: models.BaseResponse{ResponseType: models.Partial, Symbol: market},
+	})
+
+	position, open := risk.NewPositionCheck(s.engine, s.engine), risk.NewOpenOrdersCheck(s.engine)
+	position.SetSources("mm", mmEngine, mmEngine)
+	open.SetSource("mm", mmEngine)
+
+	chain := risk.NewChain(risk.Limits{MaxPosition: d("2"), MaxOpenOrders: 1}, position, open)
+	main, mm := chain.Wrap(s.engine, ""), chain.Wrap(mmEngine, "mm")
+
+	order := &models.Order{}
+	if err := main.PlaceOrder(limit(models.Buy, "90", "2"), order); err != nil {
+		t.Fatal(err)
+	}
+	if err := main.PlaceOrder(limit(models.Buy, "90", "1"), order); reason(t, err) != risk.MaxPosition {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The main account's orders do not count against the subaccount
+	if err := mm.PlaceOrder(limit(models.Buy, "90", "2"), order); err != nil {
+		t.Fatal(err)
+	}
+	if err := mm.PlaceOrder(limit(models.Sell, "110", "1"), order); reason(t, err) != risk.MaxOpenOrders {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// slowOpenOrders widens the window between a check and the send.
+type slowOpenOrders struct {
+	*paper.Engine
+}
+
+func (s slowOpenOrders) GetOpenOrders(market string) ([]*models.Order, error) {
+	orders, err := s.Engine.GetOpenOrders(market)
+	time.Sleep(time.Millisecond)
+	return orders, err
+}
+
+func TestGuard_Concurrent(t *testing.T) {
+
+	place := func(limits risk.Limits, n int) int {
+
+		engine := paper.New()
+		src := slowOpenOrders{engine}
+		chain := risk.NewChain(limits, risk.NewPositionCheck(engine, src), risk.NewOpenOrdersCheck(src))
+
+		// Guards of one subaccount share the limits
+		guards := []*risk.Guard{chain.Wrap(engine, ""), chain.Wrap(engine, "")}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		placed := 0
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(g *risk.Guard) {
+				defer wg.Done()
+				if err := g.PlaceOrder(limit(models.Buy, "90", "1"), &models.Order{}); err == nil {
+					mu.Lock()
+					placed++
+					mu.Unlock()
+				} else if _, ok := risk.AsRejection(err); !ok {
+					t.Error(err)
+				}
+			}(guards[i%len(guards)])
+		}
+		wg.Wait()
+		return placed
+	}
+
+	if placed := place(risk.Limits{MaxOpenOrders: 3}, 20); placed != 3 {
+		t.Fatalf("Placed %d orders, max 3", placed)
+	}
+	if placed := place(risk.Limits{MaxPosition: d("5")}, 20); placed != 5 {
+		t.Fatalf("Placed %d orders, max position 5", placed)
+	}
+}
@@ -0,0 +1,91 @@
+package testtickers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/tickers"
+)
+
+func TestCache_UpdateAndGet(t *testing.T) {
+
+	cache := tickers.New(nil, tickers.WithMaxAge(time.Second))
+
+	if _, ok := cache.Get("BTC-PERP"); ok {
+		t.Fatal("Empty cache should not have a quote")
+	}
+	if !cache.IsStale("BTC-PERP") {
+		t.Fatal("Unknown market should be stale")
+	}
+
+	now := time.Now()
+	cache.Update("BTC-PERP", models.Ticker{
+		Bid:  decimal.NewFromInt(100),
+		Ask:  decimal.NewFromInt(101),
+		Time: models.FTXTime{Time: now},
+	}, now)
+	cache.Update("ETH-PERP", models.Ticker{
+		Bid:  decimal.NewFromInt(10),
+		Ask:  decimal.NewFromInt(11),
+		Time: models.FTXTime{Time: now.Add(-time.Minute)},
+	}, now)
+
+	q, ok := cache.Get("BTC-PERP")
+	if !ok {
+		t.Fatal("Quote should exist")
+	}
+	if !q.Ticker.Bid.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("Unexpected bid: %v", q.Ticker.Bid)
+	}
+	if cache.IsStale("BTC-PERP") {
+		t.Fatal("BTC-PERP should not be stale")
+	}
+	if !cache.IsStale("ETH-PERP") {
+		t.Fatal("ETH-PERP should be stale")
+	}
+
+	stale := cache.Stale()
+	if len(stale) != 1 || stale[0] != "ETH-PERP" {
+		t.Fatalf("Unexpected stale markets: %v", stale)
+	}
+
+	if n := len(cache.Snapshot()); n != 2 {
+		t.Fatalf("Expected 2 quotes, got %d", n)
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+
+	cache := tickers.New(nil)
+	markets := []string{"BTC-PERP", "ETH-PERP", "SOL-PERP", "FTT-PERP"}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				cache.Update(markets[(i+j)%len(markets)], models.Ticker{
+					Last: decimal.NewFromInt(int64(j)),
+					Time: models.FTXTime{Time: time.Now()},
+				}, time.Now())
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				cache.Get(markets[j%len(markets)])
+				cache.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(cache.Markets()); n != len(markets) {
+		t.Fatalf("Expected %d markets, got %d", len(markets), n)
+	}
+}
@@ -0,0 +1,79 @@
+//go:build !windows
+// +build !windows
+
+package testwatchdog
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/watchdog"
+)
+
+// cpuTime returns the user and system time the process has used.
+func cpuTime(t *testing.T) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		t.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+func TestWatchdog_StreamDown(t *testing.T) {
+
+	srv := silentServer(t)
+	defer srv.Close()
+
+	cancels := &exchange{}
+	client := api.New(api.WithAuth("key", "secret"))
+
+	stream := api.NewStream(client)
+	stream.SetURL("ws" + strings.TrimPrefix(srv.URL, "http"))
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	if _, err := stream.SubscribeToTickers(ctx, "BTC-PERP"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := watchdog.New(
+		client,
+		watchdog.WithStream(stream, 0),
+		watchdog.WithCheckInterval(10*time.Millisecond),
+		watchdog.WithHTTPClient(&http.Client{Transport: cancels}))
+
+	events := w.Run(ctx)
+
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Reason != watchdog.StreamDown {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watchdog did not trip on the stopped stream")
+	}
+
+	// Still down: no second trip, and the loop waits on its ticker
+	wall, cpu := time.Now(), cpuTime(t)
+	select {
+	case event := <-events:
+		t.Fatalf("Unexpected second event: %+v", event)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if used, elapsed := cpuTime(t)-cpu, time.Since(wall); used > elapsed/2 {
+		t.Fatalf("Watchdog busy while tripped: %v of CPU in %v", used, elapsed)
+	}
+	if n := cancels.count(); n != 1 {
+		t.Fatalf("Unexpected cancel count: %d", n)
+	}
+}
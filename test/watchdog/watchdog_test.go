@@ -0,0 +1,215 @@
+package testwatchdog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+	"github.com/sanjujosh/go-ftx/watchdog"
+)
+
+type cancel struct {
+	subAccount string
+	params     models.CancelAllParams
+}
+
+type exchange struct {
+	mu      sync.Mutex
+	cancels []cancel
+}
+
+func (e *exchange) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if req.Method == http.MethodDelete && req.URL.Path == "/api/orders" {
+		c := cancel{subAccount: req.Header.Get("FTX-SUBACCOUNT")}
+		if err := json.NewDecoder(req.Body).Decode(&c.params); err != nil {
+			return nil, err
+		}
+		e.cancels = append(e.cancels, c)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"success": true, "result": "Orders queued for cancellation"})
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+func (e *exchange) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.cancels)
+}
+
+func TestWatchdog_AliveTimeout(t *testing.T) {
+
+	trading, cancels := &exchange{}, &exchange{}
+
+	client := api.New(
+		api.WithAuth("key", "secret"),
+		api.WithHTTPClient(&http.Client{Transport: trading}))
+
+	w := watchdog.New(
+		client,
+		watchdog.WithAliveTimeout(100*time.Millisecond),
+		watchdog.WithCheckInterval(10*time.Millisecond),
+		watchdog.WithSubAccounts("", "mm"),
+		watchdog.WithMarkets("BTC-PERP"),
+		watchdog.WithConditionalOnly(),
+		watchdog.WithHTTPClient(&http.Client{Transport: cancels}))
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	events := w.Run(ctx)
+
+	// Keeping the watchdog fed holds it off
+	deadline := time.Now().Add(250 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		w.Alive()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := cancels.count(); n != 0 {
+		t.Fatalf("Unexpected cancels while alive: %d", n)
+	}
+
+	var event watchdog.Event
+	select {
+	case event = <-events:
+	case <-time.After(time.Second):
+		t.Fatal("Watchdog did not trip")
+	}
+
+	if event.Reason != watchdog.AliveLapsed || len(event.Results) != 2 {
+		t.Fatalf("Unexpected event: %+v", event)
+	}
+	for _, r := range event.Results {
+		if r.Err != nil || r.Market != "BTC-PERP" {
+			t.Fatalf("Unexpected result: %+v", r)
+		}
+	}
+
+	if trading.count() != 0 {
+		t.Fatal("Cancels went through the trading client")
+	}
+
+	cancels.mu.Lock()
+	subAccounts := []string{}
+	for _, c := range cancels.cancels {
+		if c.params.Market == nil || *c.params.Market != "BTC-PERP" ||
+			c.params.ConditionalOrdersOnly == nil || !*c.params.ConditionalOrdersOnly {
+			t.Fatalf("Unexpected cancel params: %+v", c.params)
+		}
+		subAccounts = append(subAccounts, c.subAccount)
+	}
+	cancels.mu.Unlock()
+	sort.Strings(subAccounts)
+	if len(subAccounts) != 2 || subAccounts[0] != "" || subAccounts[1] != "mm" {
+		t.Fatalf("Unexpected subaccounts: %v", subAccounts)
+	}
+
+	// Still lapsed: no second trip until the watchdog rearms
+	time.Sleep(100 * time.Millisecond)
+	if n := cancels.count(); n != 2 {
+		t.Fatalf("Unexpected cancel count: %d", n)
+	}
+
+	w.Alive()
+	time.Sleep(30 * time.Millisecond)
+
+	select {
+	case event = <-events:
+		if event.Reason != watchdog.AliveLapsed {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watchdog did not rearm")
+	}
+	if n := cancels.count(); n != 4 {
+		t.Fatalf("Unexpected cancel count: %d", n)
+	}
+}
+
+// silentServer reads the stream but never answers its pings.
+func silentServer(t *testing.T) *httptest.Server {
+
+	upgrader := websocket.Upgrader{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		defer conn.Close()
+
+		conn.SetPingHandler(func(string) error { return nil })
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestWatchdog_HeartbeatLapsed(t *testing.T) {
+
+	srv := silentServer(t)
+	defer srv.Close()
+
+	cancels := &exchange{}
+	client := api.New(api.WithAuth("key", "secret"))
+
+	stream := api.NewStream(client)
+	stream.SetURL("ws" + strings.TrimPrefix(srv.URL, "http"))
+	// Pinged several times within the allowed delay, each ping unanswered
+	stream.SetPingPeriod(20 * time.Millisecond)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	if _, err := stream.SubscribeToTickers(ctx, "BTC-PERP"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := watchdog.New(
+		client,
+		watchdog.WithStream(stream, 0),
+		watchdog.WithHeartbeat(100*time.Millisecond),
+		watchdog.WithCheckInterval(10*time.Millisecond),
+		watchdog.WithHTTPClient(&http.Client{Transport: cancels}))
+
+	events := w.Run(ctx)
+
+	select {
+	case event := <-events:
+		if event.Reason != watchdog.HeartbeatLapsed {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watchdog did not trip on unanswered pings")
+	}
+
+	if ping := stream.UnansweredPing(); ping.IsZero() || !stream.LastPing().After(ping) {
+		t.Fatalf("Unexpected pings: first unanswered %v, last %v", ping, stream.LastPing())
+	}
+}
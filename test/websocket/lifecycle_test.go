@@ -0,0 +1,190 @@
+package testws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const tickerMsg = `{"channel":"ticker","market":"BTC-PERP","type":"update",` +
+	`"data":{"bid":100,"ask":101,"last":100,"time":1650000000.25}}`
+
+func server(t *testing.T, closeAfterSend bool) *httptest.Server {
+
+	upgrader := websocket.Upgrader{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		defer conn.Close()
+
+		// Wait for the subscription before sending
+		if _, _, err = conn.ReadMessage(); err != nil {
+			return
+		}
+		if err = conn.WriteMessage(websocket.TextMessage, []byte(tickerMsg)); err != nil {
+			return
+		}
+		if closeAfterSend {
+			return
+		}
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func stream(srv *httptest.Server) *api.Stream {
+	s := api.NewStream(api.New())
+	s.SetURL("ws" + strings.TrimPrefix(srv.URL, "http"))
+	s.SetReconnectionCount(1)
+	s.SetReconnectionInterval(10 * time.Millisecond)
+	return s
+}
+
+func TestStream_CloseOnCancel(t *testing.T) {
+
+	srv := server(t, false)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := stream(srv)
+
+	tickersC, err := s.SubscribeToTickers(ctx, "BTC-PERP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ticker := <-tickersC:
+		if ticker.Symbol != "BTC-PERP" {
+			t.Fatalf("Unexpected symbol: %s", ticker.Symbol)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for ticker")
+	}
+
+	cancel()
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream did not stop")
+	}
+
+	if _, ok := <-tickersC; ok {
+		t.Fatal("Ticker channel should be closed")
+	}
+	if err = s.Err(); err != nil {
+		t.Fatalf("Err should be nil after cancel: %v", err)
+	}
+}
+
+func TestStream_Close(t *testing.T) {
+
+	srv := server(t, false)
+	defer srv.Close()
+
+	s := stream(srv)
+
+	tickersC, err := s.SubscribeToTickers(context.Background(), "BTC-PERP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tickersC
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-tickersC; ok {
+		t.Fatal("Ticker channel should be closed")
+	}
+}
+
+// dropServer serves one connection, drops it after the first ticker and
+// refuses every later one so that reconnection fails.
+func dropServer(t *testing.T) *httptest.Server {
+
+	upgrader := websocket.Upgrader{}
+	var served int32
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if atomic.AddInt32(&served, 1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+
+		if _, _, err = conn.ReadMessage(); err != nil {
+			conn.Close()
+			return
+		}
+		if err = conn.WriteMessage(websocket.TextMessage, []byte(tickerMsg)); err != nil {
+			t.Log(err)
+		}
+		// No close frame: the client sees a read failure
+		conn.Close()
+	}))
+}
+
+func TestStream_TerminalError(t *testing.T) {
+
+	srv := dropServer(t)
+	defer srv.Close()
+
+	s := stream(srv)
+
+	tickersC, err := s.SubscribeToTickers(context.Background(), "BTC-PERP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tickersC
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream did not stop")
+	}
+
+	if err = s.Err(); err == nil {
+		t.Fatal("Err should hold the terminal read error")
+	}
+	if _, ok := <-tickersC; ok {
+		t.Fatal("Ticker channel should be closed")
+	}
+}
+
+func TestStream_SlowReaderDoesNotBlock(t *testing.T) {
+
+	s := api.NewStream(api.New())
+
+	// Nobody reads the channel: sends past its buffer are dropped
+	for i := 0; i < 300; i++ {
+		s.SendToChannel(models.TickerChannel, &models.TickerResponse{})
+	}
+
+	if n := s.Dropped(); n != 300-256 {
+		t.Fatalf("Expected %d dropped, got %d", 300-256, n)
+	}
+}
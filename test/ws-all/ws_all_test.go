@@ -35,7 +35,10 @@ func Test_WsAll(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ordersC, err := ftx.Stream.SubscribeToOrders(ctx, symbols...)
+	ordersC, err := ftx.Stream.SubscribeToOrders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
 	tickersC, err := ftx.Stream.SubscribeToTickers(ctx, symbols...)
 	if err != nil {
 		t.Fatal(err)
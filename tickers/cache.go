@@ -0,0 +1,306 @@
+package tickers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	defaultMaxAge       = 10 * time.Second
+	defaultPollInterval = 5 * time.Second
+)
+
+type Quote struct {
+	Market     string
+	Ticker     models.Ticker
+	ReceivedAt time.Time
+}
+
+func (q *Quote) Age(now time.Time) time.Duration {
+	return now.Sub(q.Ticker.Time.Time)
+}
+
+func (q *Quote) IsStale(now time.Time, maxAge time.Duration) bool {
+	return q.Age(now) > maxAge
+}
+
+type Option func(c *Cache)
+
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(c *Cache) {
+		c.maxAge = maxAge
+	}
+}
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Cache) {
+		c.pollInterval = interval
+	}
+}
+
+func WithStream(stream *api.Stream) Option {
+	return func(c *Cache) {
+		c.stream = stream
+	}
+}
+
+// Cache keeps the latest ticker per market. Reads never take a lock:
+// the market index is copied on write when a new market shows up and
+// each entry holds its latest *Quote in an atomic.Value.
+type Cache struct {
+	client       *api.Client
+	stream       *api.Stream
+	mu           *sync.Mutex
+	entries      atomic.Value // map[string]*atomic.Value
+	maxAge       time.Duration
+	pollInterval time.Duration
+	err          error
+}
+
+func New(client *api.Client, opts ...Option) *Cache {
+
+	c := &Cache{
+		client:       client,
+		mu:           &sync.Mutex{},
+		maxAge:       defaultMaxAge,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.stream == nil && client != nil {
+		c.stream = &client.Stream
+	}
+	c.entries.Store(make(map[string]*atomic.Value))
+
+	return c
+}
+
+func (c *Cache) load() map[string]*atomic.Value {
+	return c.entries.Load().(map[string]*atomic.Value)
+}
+
+func (c *Cache) Update(market string, ticker models.Ticker, receivedAt time.Time) {
+
+	q := &Quote{Market: market, Ticker: ticker, ReceivedAt: receivedAt}
+
+	if v, ok := c.load()[market]; ok {
+		v.Store(q)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old := c.load()
+	if v, ok := old[market]; ok {
+		v.Store(q)
+		return
+	}
+
+	entries := make(map[string]*atomic.Value, len(old)+1)
+	for k, v := range old {
+		entries[k] = v
+	}
+	v := &atomic.Value{}
+	v.Store(q)
+	entries[market] = v
+
+	c.entries.Store(entries)
+}
+
+func (c *Cache) Get(market string) (Quote, bool) {
+	v, ok := c.load()[market]
+	if !ok {
+		return Quote{}, false
+	}
+	return *v.Load().(*Quote), true
+}
+
+func (c *Cache) Snapshot() map[string]Quote {
+	entries := c.load()
+	result := make(map[string]Quote, len(entries))
+	for k, v := range entries {
+		result[k] = *v.Load().(*Quote)
+	}
+	return result
+}
+
+func (c *Cache) Markets() []string {
+	entries := c.load()
+	result := make([]string, 0, len(entries))
+	for k := range entries {
+		result = append(result, k)
+	}
+	return result
+}
+
+func (c *Cache) MaxAge() time.Duration {
+	return c.maxAge
+}
+
+// IsStale reports true for unknown markets and for quotes whose
+// Ticker.Time is older than the configured max age.
+func (c *Cache) IsStale(market string) bool {
+	q, ok := c.Get(market)
+	if !ok {
+		return true
+	}
+	return q.IsStale(time.Now(), c.maxAge)
+}
+
+func (c *Cache) Stale() []string {
+	now, result := time.Now(), make([]string, 0)
+	for k, v := range c.load() {
+		if v.Load().(*Quote).IsStale(now, c.maxAge) {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// Run subscribes to the ticker channel and falls back to polling
+// GetMarkets if the subscription cannot be made or the channel closes
+// later, e.g. after a terminal stream error. An empty markets list means
+// every listed market.
+func (c *Cache) Run(ctx context.Context, markets ...string) error {
+
+	fallback := func(err error) {
+		c.setErr(err)
+		c.client.Logger.Debugf("ticker subscription lost, polling: %+v", err)
+		go c.Poll(ctx)
+	}
+
+	if err := c.subscribe(ctx, markets, fallback); err != nil {
+		fallback(err)
+	}
+
+	return nil
+}
+
+// Err returns why the subscription of Run was lost, nil while it holds.
+func (c *Cache) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Cache) setErr(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+func (c *Cache) Subscribe(ctx context.Context, markets ...string) error {
+	return c.subscribe(ctx, markets, nil)
+}
+
+// subscribe calls closed if the ticker channel closes before ctx is done.
+func (c *Cache) subscribe(ctx context.Context, markets []string, closed func(err error)) (err error) {
+
+	if c.stream == nil {
+		return errors.New("Nil stream")
+	}
+
+	if len(markets) == 0 {
+		if markets, err = c.marketNames(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	tickersC, err := c.stream.SubscribeToTickers(ctx, markets...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ticker, ok := <-tickersC:
+				if !ok {
+					if closed != nil && ctx.Err() == nil {
+						err := c.stream.Err()
+						if err == nil {
+							err = errors.New("Ticker channel closed")
+						}
+						closed(errors.WithStack(err))
+					}
+					return
+				}
+				if ticker != nil {
+					c.Update(ticker.Symbol, ticker.Ticker, time.Now())
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *Cache) Poll(ctx context.Context) error {
+
+	for {
+
+		if err := c.Refresh(); err != nil {
+			c.client.Logger.Debugf("ticker poll: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// Refresh loads every market from REST. Markets carry no quote time so
+// the receive time is used as Ticker.Time.
+func (c *Cache) Refresh() error {
+
+	markets, err := c.client.Markets.GetMarkets()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	now := time.Now()
+
+	for _, m := range markets {
+		if m == nil {
+			continue
+		}
+		c.Update(m.Name, models.Ticker{
+			Bid:  m.Bid,
+			Ask:  m.Ask,
+			Last: m.Last,
+			Time: models.FTXTime{Time: now},
+		}, now)
+	}
+
+	return nil
+}
+
+func (c *Cache) marketNames() ([]string, error) {
+
+	markets, err := c.client.Markets.GetMarkets()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(markets))
+	for _, m := range markets {
+		if m != nil && m.Enabled {
+			result = append(result, m.Name)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,309 @@
+package watchdog
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sanjujosh/go-ftx/api"
+	"github.com/sanjujosh/go-ftx/models"
+)
+
+const (
+	defaultCheckInterval = time.Second
+	defaultCancelTimeout = 10 * time.Second
+	defaultBufferSize    = 16
+)
+
+type Reason string
+
+const (
+	StreamDown      = Reason("stream_down")
+	StreamSilent    = Reason("stream_silent")
+	HeartbeatLapsed = Reason("heartbeat_lapsed")
+	AliveLapsed     = Reason("alive_lapsed")
+)
+
+// CancelResult is the outcome of one cancel all call. SubAccount is empty
+// for the main account and Market for every market.
+type CancelResult struct {
+	SubAccount string
+	Market     string
+	Result     string
+	Err        error
+}
+
+// Event is emitted every time the watchdog trips.
+type Event struct {
+	Reason  Reason
+	Time    time.Time
+	Results []CancelResult
+}
+
+type Option func(w *Watchdog)
+
+// WithStream trips when the stream stops or no message is read for
+// maxSilence. Zero only watches for the stream stopping.
+func WithStream(stream *api.Stream, maxSilence time.Duration) Option {
+	return func(w *Watchdog) {
+		w.stream, w.maxSilence = stream, maxSilence
+	}
+}
+
+// WithHeartbeat trips when a ping is not answered within maxDelay. Lower
+// the ping period with Stream.SetPingPeriod so lapses are noticed in time.
+func WithHeartbeat(maxDelay time.Duration) Option {
+	return func(w *Watchdog) {
+		w.maxPongDelay = maxDelay
+	}
+}
+
+// WithAliveTimeout trips when Alive is not called for timeout.
+func WithAliveTimeout(timeout time.Duration) Option {
+	return func(w *Watchdog) {
+		w.aliveTimeout = timeout
+	}
+}
+
+// WithMarkets limits the cancel to the markets.
+func WithMarkets(markets ...string) Option {
+	return func(w *Watchdog) {
+		w.markets = markets
+	}
+}
+
+func WithConditionalOnly() Option {
+	return func(w *Watchdog) {
+		w.conditionalOnly = true
+	}
+}
+
+// WithSubAccounts cancels on each subaccount, "" being the main account.
+// The default is the account of the client.
+func WithSubAccounts(nicknames ...string) Option {
+	return func(w *Watchdog) {
+		w.subAccounts = nicknames
+	}
+}
+
+// WithHTTPClient sets the HTTP client cancels are sent with. The default
+// has its own connection pool and a timeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(w *Watchdog) {
+		w.httpClient = client
+	}
+}
+
+func WithCheckInterval(interval time.Duration) Option {
+	return func(w *Watchdog) {
+		w.checkInterval = interval
+	}
+}
+
+// Watchdog is a dead man's switch: it cancels resting orders when the
+// stream, its heartbeat or the application stops showing signs of life.
+// It trips once per lapse and rearms when every check passes again.
+type Watchdog struct {
+	client          *api.Client
+	stream          *api.Stream
+	httpClient      *http.Client
+	cancelClients   []*api.Client
+	mu              *sync.Mutex
+	lastAlive       time.Time
+	started         time.Time
+	tripped         bool
+	maxSilence      time.Duration
+	maxPongDelay    time.Duration
+	aliveTimeout    time.Duration
+	markets         []string
+	conditionalOnly bool
+	subAccounts     []string
+	checkInterval   time.Duration
+}
+
+func New(client *api.Client, opts ...Option) *Watchdog {
+
+	w := &Watchdog{
+		client:        client,
+		mu:            &sync.Mutex{},
+		checkInterval: defaultCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.httpClient == nil {
+		w.httpClient = &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   defaultCancelTimeout,
+		}
+	}
+
+	if w.subAccounts == nil {
+		w.cancelClients = []*api.Client{client.Clone(api.WithHTTPClient(w.httpClient))}
+	}
+	for _, nickname := range w.subAccounts {
+		c := client.Clone(api.WithHTTPClient(w.httpClient))
+		c.SubAccount = nil
+		if nickname != "" {
+			name := nickname
+			c.SubAccount = &name
+		}
+		w.cancelClients = append(w.cancelClients, c)
+	}
+
+	return w
+}
+
+// Alive records a sign of life from the application.
+func (w *Watchdog) Alive() {
+	w.mu.Lock()
+	w.lastAlive = time.Now()
+	w.mu.Unlock()
+}
+
+// since returns how long ago t was, counting from started if t is earlier.
+func since(now, started, t time.Time) time.Duration {
+	if t.Before(started) {
+		t = started
+	}
+	return now.Sub(t)
+}
+
+// Check returns the first lapsed condition, or "" if all is well.
+func (w *Watchdog) Check(now time.Time) Reason {
+
+	w.mu.Lock()
+	lastAlive, started := w.lastAlive, w.started
+	w.mu.Unlock()
+
+	if w.stream != nil {
+		select {
+		case <-w.stream.Done():
+			return StreamDown
+		default:
+		}
+		if w.maxSilence > 0 && since(now, started, w.stream.LastMessage()) > w.maxSilence {
+			return StreamSilent
+		}
+		if w.maxPongDelay > 0 {
+			ping := w.stream.UnansweredPing()
+			if !ping.IsZero() && now.Sub(ping) > w.maxPongDelay {
+				return HeartbeatLapsed
+			}
+		}
+	}
+
+	if w.aliveTimeout > 0 && since(now, started, lastAlive) > w.aliveTimeout {
+		return AliveLapsed
+	}
+
+	return ""
+}
+
+// CancelAll cancels the orders on every configured account and market.
+func (w *Watchdog) CancelAll() []CancelResult {
+
+	markets := w.markets
+	if len(markets) == 0 {
+		markets = []string{""}
+	}
+
+	results := make([]CancelResult, 0, len(w.cancelClients)*len(markets))
+
+	for _, c := range w.cancelClients {
+		for _, market := range markets {
+
+			params := &models.CancelAllParams{}
+			if market != "" {
+				params.Market = api.PtrString(market)
+			}
+			if w.conditionalOnly {
+				params.ConditionalOrdersOnly = api.PtrBool(true)
+			}
+
+			result := CancelResult{Market: market}
+			if c.SubAccount != nil {
+				result.SubAccount = *c.SubAccount
+			}
+			result.Result, result.Err = c.Orders.CancelAllOrders(params)
+
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+func (w *Watchdog) trip(reason Reason, now time.Time) Event {
+
+	event := Event{Reason: reason, Time: now, Results: w.CancelAll()}
+
+	w.client.Logger.Debugf("watchdog tripped: %s", reason)
+	for _, r := range event.Results {
+		if r.Err != nil {
+			w.client.Logger.Debugf(
+				"watchdog cancel %q %q: %+v", r.SubAccount, r.Market, r.Err)
+		}
+	}
+
+	return event
+}
+
+// Run checks the conditions until ctx is done and emits an event each time
+// the watchdog trips.
+func (w *Watchdog) Run(ctx context.Context) <-chan Event {
+
+	w.mu.Lock()
+	w.started = time.Now()
+	w.mu.Unlock()
+
+	events := make(chan Event, defaultBufferSize)
+
+	go func() {
+
+		defer close(events)
+
+		ticker := time.NewTicker(w.checkInterval)
+		defer ticker.Stop()
+
+		var done <-chan struct{}
+		if w.stream != nil {
+			done = w.stream.Done()
+		}
+
+		for {
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-done:
+				// A stopped stream stays stopped, Check reports it on
+				// every tick from here on
+				done = nil
+			}
+
+			now := time.Now()
+			reason := w.Check(now)
+
+			if reason == "" {
+				w.tripped = false
+				continue
+			}
+			if w.tripped {
+				continue
+			}
+			w.tripped = true
+
+			select {
+			case events <- w.trip(reason, now):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}